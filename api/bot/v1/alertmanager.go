@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	sentry "github.com/getsentry/sentry-go"
+
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/container"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/logs"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/telegram"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/modules/alertmanager"
+)
+
+// maxWebhookSize bounds the payloads of Alertmanager, a group of a few
+// hundred alerts fits.
+const maxWebhookSize = 4 << 20
+
+// Alertmanager receives the notifications of an Alertmanager webhook
+// receiver and forwards them to the chats of $ALERTMANAGER_ROUTES. It
+// answers 5xx when a chat couldn't be notified, so that Alertmanager
+// retries, the retry skips the chats which were notified.
+func Alertmanager(w http.ResponseWriter, r *http.Request) {
+	defer sentry.Flush(2 * time.Second)
+
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	logger := logs.NewLogger()
+
+	module, err := container.Lookup(alertmanager.ModuleName)
+	if errors.Is(err, container.ErrNotRegistered) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	receiver, ok := module.(alertmanager.Alertmanager)
+	if err != nil || !ok {
+		logger.Errorf("Module `alertmanager` isn't usable: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if !receiver.Authorize(r.Header.Get("Authorization")) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	webhook := &alertmanager.Webhook{}
+
+	err = json.NewDecoder(io.LimitReader(r.Body, maxWebhookSize)).Decode(webhook)
+	if err != nil {
+		logger.Errorf("Fail parsing the alerts: %v", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	err = receiver.Receive(telegram.NewTelegram(os.Getenv("TELEGRAM_TOKEN")), webhook)
+	if err != nil {
+		logger.Errorf("Fail forwarding %d alert(s) of %s: %v",
+			len(webhook.Alerts), webhook.GroupKey, err)
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -4,15 +4,15 @@ import (
 	"fmt"
 	"net/http"
 	"os"
-	"strings"
 	"time"
 
 	sentry "github.com/getsentry/sentry-go"
 
 	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/container"
 	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/logs"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/mux"
 	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/telegram"
-	"github.com/hung0913208/telegram-bot-for-kubernetes/modules/cluster"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/modules"
 )
 
 func init() {
@@ -32,9 +32,19 @@ func init() {
 	}
 	defer sentry.Flush(2 * time.Second)
 
-	err = container.Register("cluster", cluster.NewModule())
+	err = modules.Register()
 	if err != nil {
-		container.Terminate("Can't register module `cluster`", 3)
+		container.Terminate(err.Error(), 3)
+	}
+
+	if os.Getenv("TELEGRAM_PUBLISH_COMMANDS") == "true" {
+		me := telegram.NewTelegram(os.Getenv("TELEGRAM_TOKEN"))
+		logger := logs.NewLogger()
+
+		err = mux.NewMux(me, logger).PublishCommands()
+		if err != nil {
+			logger.Errorf("Fail publishing commands: %v", err)
+		}
 	}
 }
 
@@ -45,6 +55,12 @@ func Handler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	secret := os.Getenv("TELEGRAM_SECRET_TOKEN")
+	if len(secret) > 0 && r.Header.Get(telegram.SecretTokenHeader) != secret {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
 	me := telegram.NewTelegram(os.Getenv("TELEGRAM_TOKEN"))
 	logger := logs.NewLogger()
 	updateMsg, err := me.ParseIncomingRequest(r.Body)
@@ -54,27 +70,13 @@ func Handler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-    command := strings.Trim(updateMsg.Message.Text, " ")
-    needAnswer := false
-    
-    if updateMsg.Message.Chat.Type == "private" {
-        needAnswer = true
-    }
-
-    if strings.Contains(command, os.Getenv("TELEGRAM_ALIAS")) {
-        needAnswer = true
-    }
-
-    if needAnswer {
-		err = me.ReplyMessage(updateMsg.Message.Chat.ID, "test test test")
-
-		if err != nil {
-			logger.Errorf(
-				"reply message to %d fail: \n\n%v",
-				updateMsg.Message.Chat.ID,
-				err,
-			)
-			return
-		}
+	err = mux.NewMux(me, logger).Dispatch(updateMsg)
+	if err != nil {
+		logger.Errorf(
+			"handle %s update %d fail: \n\n%v",
+			mux.KindOf(updateMsg),
+			updateMsg.UpdateID,
+			err,
+		)
 	}
 }
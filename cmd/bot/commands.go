@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/container"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/logs"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/mux"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/telegram"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/modules"
+)
+
+func runCommands(args []string) error {
+	if len(args) < 1 {
+		return errors.New("expect one of publish, delete or list")
+	}
+
+	flags := flag.NewFlagSet("commands "+args[0], flag.ContinueOnError)
+	token := flags.String("token", os.Getenv("TELEGRAM_TOKEN"), "bot token, default to $TELEGRAM_TOKEN")
+
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	if err := container.Init(); err != nil {
+		return err
+	}
+
+	if err := modules.Register(); err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "publish":
+		me, err := newTelegram(*token)
+		if err != nil {
+			return err
+		}
+
+		if err = mux.NewMux(me, logs.NewLogger()).PublishCommands(); err != nil {
+			return err
+		}
+
+		fmt.Println("Command menu is published")
+
+	case "delete":
+		me, err := newTelegram(*token)
+		if err != nil {
+			return err
+		}
+
+		for _, scope := range []string{
+			telegram.ScopeDefault,
+			telegram.ScopeAllPrivateChats,
+			telegram.ScopeAllGroupChats,
+			telegram.ScopeAllChatAdministrators,
+		} {
+			err = me.DeleteMyCommands(&telegram.BotCommandScope{Type: scope}, "")
+			if err != nil {
+				return err
+			}
+		}
+
+		fmt.Println("Command menu is deleted")
+
+	case "list":
+		commands := mux.NewMux(telegram.NewTelegram(*token), logs.NewLogger()).Commands()
+
+		for _, command := range commands {
+			scopes := command.Scopes
+			if len(scopes) == 0 {
+				scopes = []string{telegram.ScopeDefault}
+			}
+
+			fmt.Printf("/%-20s %-40s [%s]\n",
+				command.Name,
+				command.Description,
+				strings.Join(scopes, ", "))
+		}
+
+	default:
+		return fmt.Errorf("unknown action %q", args[0])
+	}
+
+	return nil
+}
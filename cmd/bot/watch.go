@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/container"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/jobs"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/logs"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/mux"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/modules"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/modules/alert"
+)
+
+// runWatch pushes the alerts of the registered clusters to the subscribed
+// chats and runs the jobs handed over by the webhook until it's interrupted.
+// It must run as a long-lived process next to the webhook, sharing its
+// $REDIS_URL to read the subscriptions and the jobs.
+func runWatch(args []string) error {
+	flags := flag.NewFlagSet("watch", flag.ContinueOnError)
+	token := flags.String("token", os.Getenv("TELEGRAM_TOKEN"), "bot token, default to $TELEGRAM_TOKEN")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	me, err := newTelegram(*token)
+	if err != nil {
+		return err
+	}
+
+	if err = container.Init(); err != nil {
+		return err
+	}
+
+	if err = modules.Register(); err != nil {
+		return err
+	}
+
+	store, err := mux.DefaultStore()
+	if err != nil {
+		return err
+	}
+
+	// A store in memory would only see what this process saves
+	if !store.Shared() {
+		return errors.New("REDIS_URL must be set to share the subscriptions and the jobs with the webhook")
+	}
+
+	module, err := container.Lookup(alert.ModuleName)
+	if err != nil {
+		return err
+	}
+
+	watcher, ok := module.(alert.Alert)
+	if !ok {
+		return errors.New("module `alert` isn't an alert.Alert")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	logger := logs.NewLogger()
+	worker := jobs.NewWorker(store, me, logger)
+	stopped := make(chan error, 1)
+
+	go func() {
+		stopped <- worker.Run(ctx)
+	}()
+
+	err = watcher.Watch(ctx, me, logger)
+
+	// The worker waits for its running jobs, which resume elsewhere when
+	// they're interrupted
+	stop()
+
+	if workerErr := <-stopped; err == nil {
+		err = workerErr
+	}
+
+	return err
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/telegram"
+)
+
+func runWebhook(args []string) error {
+	if len(args) < 1 {
+		return errors.New("expect one of set, delete or info")
+	}
+
+	flags := flag.NewFlagSet("webhook "+args[0], flag.ContinueOnError)
+	token := flags.String("token", os.Getenv("TELEGRAM_TOKEN"), "bot token, default to $TELEGRAM_TOKEN")
+
+	switch args[0] {
+	case "set":
+		url := flags.String("url", "", "HTTPS url receiving the updates")
+		secret := flags.String("secret", os.Getenv("TELEGRAM_SECRET_TOKEN"), "secret token, default to $TELEGRAM_SECRET_TOKEN")
+		allowed := flags.String("allowed-updates", "", "comma separated list of update types, e.g. message,callback_query")
+		maxConnections := flags.Int("max-connections", 0, "maximum simultaneous connections, 1-100")
+		ipAddress := flags.String("ip-address", "", "fixed IP address used instead of DNS")
+		dropPending := flags.Bool("drop-pending", false, "drop all pending updates")
+
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+
+		config := telegram.WebhookConfig{
+			URL:                *url,
+			IPAddress:          *ipAddress,
+			MaxConnections:     *maxConnections,
+			DropPendingUpdates: *dropPending,
+			SecretToken:        *secret,
+		}
+
+		if len(*allowed) > 0 {
+			for _, update := range strings.Split(*allowed, ",") {
+				config.AllowedUpdates = append(config.AllowedUpdates,
+					strings.TrimSpace(update))
+			}
+		}
+
+		me, err := newTelegram(*token)
+		if err != nil {
+			return err
+		}
+
+		if err = me.SetWebhook(config); err != nil {
+			return err
+		}
+
+		fmt.Printf("Webhook is set to %s\n", config.URL)
+
+	case "delete":
+		dropPending := flags.Bool("drop-pending", false, "drop all pending updates")
+
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+
+		me, err := newTelegram(*token)
+		if err != nil {
+			return err
+		}
+
+		if err = me.DeleteWebhook(*dropPending); err != nil {
+			return err
+		}
+
+		fmt.Println("Webhook is deleted, the bot can now use polling mode")
+
+	case "info":
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+
+		me, err := newTelegram(*token)
+		if err != nil {
+			return err
+		}
+
+		info, err := me.GetWebhookInfo()
+		if err != nil {
+			return err
+		}
+
+		printWebhookInfo(info)
+
+	default:
+		return fmt.Errorf("unknown action %q", args[0])
+	}
+
+	return nil
+}
+
+func newTelegram(token string) (telegram.Telegram, error) {
+	if len(token) == 0 {
+		return nil, errors.New("please provide the bot token with -token or $TELEGRAM_TOKEN")
+	}
+
+	return telegram.NewTelegram(token), nil
+}
+
+func printWebhookInfo(info *telegram.WebhookInfo) {
+	if !info.IsSet() {
+		fmt.Println("Webhook:          not set (polling mode)")
+	} else {
+		fmt.Printf("Webhook:          %s\n", info.URL)
+	}
+
+	fmt.Printf("Pending updates:  %d\n", info.PendingUpdateCount)
+
+	if info.MaxConnections > 0 {
+		fmt.Printf("Max connections:  %d\n", info.MaxConnections)
+	}
+
+	if len(info.IPAddress) > 0 {
+		fmt.Printf("IP address:       %s\n", info.IPAddress)
+	}
+
+	if len(info.AllowedUpdates) > 0 {
+		fmt.Printf("Allowed updates:  %s\n", strings.Join(info.AllowedUpdates, ", "))
+	}
+
+	if info.LastErrorDate > 0 {
+		fmt.Printf("Last error:       %s at %s\n",
+			info.LastErrorMessage,
+			time.Unix(int64(info.LastErrorDate), 0).Format(time.RFC3339))
+	}
+}
@@ -0,0 +1,106 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+)
+
+type fileLogImpl struct {
+	mutex sync.Mutex
+	path  string
+}
+
+// NewFileLog appends the entries as JSON lines to the file at path, the file
+// is opened in append-only mode for every entry so that rotating it is safe.
+func NewFileLog(path string) Log {
+	return &fileLogImpl{path: path}
+}
+
+func (self *fileLogImpl) Init() error {
+	if len(self.path) == 0 {
+		return errors.New("AUDIT_DSN, STORAGE_DSN or AUDIT_FILE must be set to keep the audit log")
+	}
+
+	file, err := os.OpenFile(self.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	return file.Close()
+}
+
+func (self *fileLogImpl) Deinit() error {
+	return nil
+}
+
+func (self *fileLogImpl) Record(entry Entry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	file, err := os.OpenFile(self.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(append(line, '\n'))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+func (self *fileLogImpl) Query(filter Filter) ([]Entry, error) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	file, err := os.Open(self.path)
+	if os.IsNotExist(err) {
+		return []Entry{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	// Keep a window of the newest matching entries while scanning from the
+	// oldest one.
+	window := make([]Entry, 0, filter.limit())
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		entry := Entry{}
+
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+
+		if !filter.Match(entry) {
+			continue
+		}
+
+		if len(window) == filter.limit() {
+			window = window[1:]
+		}
+		window = append(window, entry)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	entries := make([]Entry, len(window))
+	for i, entry := range window {
+		entries[len(window)-1-i] = entry
+	}
+
+	return entries, nil
+}
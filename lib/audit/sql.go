@@ -0,0 +1,205 @@
+package audit
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"time"
+
+	// Register the driver of MySQL compatible servers, such as TiDB.
+	_ "github.com/go-sql-driver/mysql"
+)
+
+// sqlSchema creates the table of the entries on MySQL compatible servers.
+// Times are stored as Unix milliseconds.
+const sqlSchema = `CREATE TABLE IF NOT EXISTS audit_entries (
+	id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+	created_at BIGINT NOT NULL,
+	user_id BIGINT NOT NULL,
+	username VARCHAR(64) NOT NULL,
+	chat_id BIGINT NOT NULL,
+	command VARCHAR(64) NOT NULL,
+	args TEXT NOT NULL,
+	cluster VARCHAR(255) NOT NULL,
+	namespace VARCHAR(255) NOT NULL,
+	resource VARCHAR(255) NOT NULL,
+	confirmation VARCHAR(16) NOT NULL,
+	result VARCHAR(16) NOT NULL,
+	error TEXT NOT NULL,
+	duration_ms BIGINT NOT NULL
+)`
+
+const sqlColumns = `created_at, user_id, username, chat_id, command, args, cluster,
+	namespace, resource, confirmation, result, error, duration_ms`
+
+type sqlLogImpl struct {
+	driver string
+	dsn    string
+	db     *sql.DB
+	shared bool
+}
+
+// NewSQLLog stores the entries in the table audit_entries of the database
+// opened with driver and dsn, the table is created if it doesn't exist.
+func NewSQLLog(driver, dsn string) Log {
+	return &sqlLogImpl{
+		driver: driver,
+		dsn:    dsn,
+	}
+}
+
+// NewSQLLogWithDB stores the entries in the table audit_entries of db, which
+// is owned and migrated by the caller.
+func NewSQLLogWithDB(db *sql.DB) Log {
+	return &sqlLogImpl{
+		db:     db,
+		shared: true,
+	}
+}
+
+func (self *sqlLogImpl) Init() error {
+	if self.shared {
+		return nil
+	}
+
+	db, err := sql.Open(self.driver, self.dsn)
+	if err != nil {
+		return err
+	}
+
+	if _, err = db.Exec(sqlSchema); err != nil {
+		db.Close()
+		return err
+	}
+
+	self.db = db
+	return nil
+}
+
+func (self *sqlLogImpl) Deinit() error {
+	if self.db == nil || self.shared {
+		return nil
+	}
+
+	return self.db.Close()
+}
+
+func (self *sqlLogImpl) Record(entry Entry) error {
+	args, err := json.Marshal(entry.Args)
+	if err != nil {
+		return err
+	}
+
+	_, err = self.db.Exec(
+		`INSERT INTO audit_entries (`+sqlColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		entry.Time.UnixMilli(),
+		entry.UserID,
+		entry.Username,
+		entry.ChatID,
+		entry.Command,
+		string(args),
+		entry.Cluster,
+		entry.Namespace,
+		entry.Resource,
+		entry.Confirmation,
+		entry.Result,
+		entry.Error,
+		entry.Duration.Milliseconds(),
+	)
+	return err
+}
+
+func (self *sqlLogImpl) Query(filter Filter) ([]Entry, error) {
+	conditions := []string{"created_at >= ?"}
+	params := []interface{}{filter.Since.UnixMilli()}
+
+	if filter.UserID != 0 {
+		conditions = append(conditions, "user_id = ?")
+		params = append(params, filter.UserID)
+	}
+
+	if len(filter.Username) > 0 {
+		conditions = append(conditions, "LOWER(username) = ?")
+		params = append(params, strings.ToLower(filter.Username))
+	}
+
+	limit := " LIMIT ?"
+
+	if filter.Clusters != nil {
+		// The entries of several clusters are matched once read, the limit
+		// is then applied while reading
+		condition := "cluster LIKE '%,%'"
+
+		if len(filter.Clusters) > 0 {
+			condition = "cluster IN (?" + strings.Repeat(", ?", len(filter.Clusters)-1) +
+				") OR " + condition
+
+			for _, cluster := range filter.Clusters {
+				params = append(params, cluster)
+			}
+		}
+
+		conditions = append(conditions, "("+condition+")")
+		limit = ""
+	} else {
+		params = append(params, filter.limit())
+	}
+
+	rows, err := self.db.Query(
+		`SELECT `+sqlColumns+` FROM audit_entries
+		WHERE `+strings.Join(conditions, " AND ")+`
+		ORDER BY id DESC`+limit,
+		params...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := make([]Entry, 0)
+
+	for rows.Next() {
+		var createdAt, durationMs int64
+		var args string
+
+		entry := Entry{}
+
+		err = rows.Scan(
+			&createdAt,
+			&entry.UserID,
+			&entry.Username,
+			&entry.ChatID,
+			&entry.Command,
+			&args,
+			&entry.Cluster,
+			&entry.Namespace,
+			&entry.Resource,
+			&entry.Confirmation,
+			&entry.Result,
+			&entry.Error,
+			&durationMs,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		if err = json.Unmarshal([]byte(args), &entry.Args); err != nil {
+			return nil, err
+		}
+
+		entry.Time = time.UnixMilli(createdAt)
+		entry.Duration = time.Duration(durationMs) * time.Millisecond
+
+		if filter.Clusters != nil && !filter.Match(entry) {
+			continue
+		}
+
+		entries = append(entries, entry)
+		if len(entries) == filter.limit() {
+			break
+		}
+	}
+
+	return entries, rows.Err()
+}
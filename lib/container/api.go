@@ -7,6 +7,9 @@ import (
 	"os"
 )
 
+// ErrNotRegistered is returned by Lookup for a name without module.
+var ErrNotRegistered = errors.New("hasn't been registered")
+
 type Module interface {
 	Init() error
 	Deinit() error
@@ -72,6 +75,31 @@ func Register(name string, module Module) error {
 	return nil
 }
 
+func Lookup(name string) (Module, error) {
+	if iContainerManager == nil {
+		return nil, errors.New("Please call container.Init() first")
+	}
+
+	wrap, ok := iContainerManager.mapping[name]
+	if !ok {
+		return nil, fmt.Errorf("Object %s %w", name, ErrNotRegistered)
+	}
+
+	return wrap.module, nil
+}
+
+func Names() []string {
+	if iContainerManager == nil {
+		return []string{}
+	}
+
+	names := make([]string, len(iContainerManager.modules))
+	for name, wrap := range iContainerManager.mapping {
+		names[wrap.index] = name
+	}
+	return names
+}
+
 func Terminate(msg string, exitCode int) {
 	if iContainerManager != nil {
 		for _, wrap := range iContainerManager.mapping {
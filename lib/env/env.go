@@ -0,0 +1,40 @@
+package env
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Int reads the positive number of the variable name, fallback when it's
+// unset.
+func Int(name string, fallback int) (int, error) {
+	value := os.Getenv(name)
+	if len(value) == 0 {
+		return fallback, nil
+	}
+
+	number, err := strconv.Atoi(value)
+	if err != nil || number < 1 {
+		return 0, fmt.Errorf("%s must be a positive number", name)
+	}
+
+	return number, nil
+}
+
+// Duration reads the positive duration of the variable name, like 10m,
+// fallback when it's unset.
+func Duration(name string, fallback time.Duration) (time.Duration, error) {
+	value := os.Getenv(name)
+	if len(value) == 0 {
+		return fallback, nil
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		return 0, fmt.Errorf("%s must be a positive duration like 10m", name)
+	}
+
+	return duration, nil
+}
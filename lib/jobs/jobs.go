@@ -0,0 +1,124 @@
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/state"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/telegram"
+)
+
+const (
+	// pendingKey is the set of the ids of the jobs left to run.
+	pendingKey = "jobs:pending"
+)
+
+// ErrNotShared is returned when a job is enqueued in a store the worker
+// can't see.
+var ErrNotShared = errors.New("REDIS_URL must be set to run this in the background, the worker of `bot watch` reads its jobs from it")
+
+// Job is a long running action handed over by a request of the webhook to
+// the worker of `bot watch`, since a webhook must answer within seconds.
+type Job struct {
+	ID         string          `json:"id"`
+	Kind       string          `json:"kind"`
+	Payload    json.RawMessage `json:"payload"`
+	EnqueuedAt time.Time       `json:"enqueued_at"`
+}
+
+// Decode reads the payload of the job into value.
+func (self Job) Decode(value interface{}) error {
+	return json.Unmarshal(self.Payload, value)
+}
+
+// Handler runs a job, ctx is done when the worker stops or loses the lease
+// of the job. A job interrupted this way runs again on the next worker, so
+// handlers must resume from the state they saved rather than start over.
+type Handler func(ctx context.Context, bot telegram.Telegram, job Job) error
+
+var (
+	mutex    sync.Mutex
+	handlers = make(map[string]Handler)
+)
+
+// Handle registers the handler of the jobs of kind, the modules register
+// theirs when they're initialized.
+func Handle(kind string, handler Handler) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	handlers[kind] = handler
+}
+
+func handlerOf(kind string) (Handler, bool) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	handler, ok := handlers[kind]
+	return handler, ok
+}
+
+// Enqueue saves a job of kind with payload for the worker and returns its
+// id. It fails with ErrNotShared unless the store is shared with the worker.
+func Enqueue(store state.Store, kind string, payload interface{}) (string, error) {
+	if !store.Shared() {
+		return "", ErrNotShared
+	}
+
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+
+	id, err := newJobID()
+	if err != nil {
+		return "", err
+	}
+
+	job := Job{
+		ID:         id,
+		Kind:       kind,
+		Payload:    encoded,
+		EnqueuedAt: time.Now(),
+	}
+
+	if journal := currentJournal(); journal != nil {
+		if err = journal.Enqueued(job); err != nil {
+			return "", fmt.Errorf("Can't record job %s: %v", kind, err)
+		}
+	}
+
+	if err = store.Set(jobKey(id), job, 0); err != nil {
+		return "", err
+	}
+
+	if _, err = store.Add(pendingKey, id); err != nil {
+		return "", fmt.Errorf("Can't enqueue job %s: %v", kind, err)
+	}
+
+	return id, nil
+}
+
+func newJobID() (string, error) {
+	buffer := make([]byte, 8)
+
+	if _, err := rand.Read(buffer); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(buffer), nil
+}
+
+func jobKey(id string) string {
+	return "jobs:job:" + id
+}
+
+func leaseKey(id string) string {
+	return "jobs:lease:" + id
+}
@@ -0,0 +1,40 @@
+package jobs
+
+import (
+	"sync"
+)
+
+// Journal keeps a durable record of the jobs beside the store, so that the
+// jobs survive a store losing its data, e.g. Redis restarted without
+// persistence.
+type Journal interface {
+	// Enqueued records a job handed over to the worker.
+	Enqueued(job Job) error
+	// Started records that a worker runs job.
+	Started(job Job) error
+	// Finished records the end of job, err is its failure if any.
+	Finished(job Job, err error) error
+	// Unfinished returns the jobs enqueued and not finished yet.
+	Unfinished() ([]Job, error)
+}
+
+var (
+	journalMutex sync.Mutex
+	journal      Journal
+)
+
+// UseJournal records the jobs in the journal, the bot uses its database when
+// one is configured.
+func UseJournal(value Journal) {
+	journalMutex.Lock()
+	defer journalMutex.Unlock()
+
+	journal = value
+}
+
+func currentJournal() Journal {
+	journalMutex.Lock()
+	defer journalMutex.Unlock()
+
+	return journal
+}
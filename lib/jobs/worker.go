@@ -0,0 +1,254 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/logs"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/state"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/telegram"
+)
+
+const (
+	// pollInterval spaces the checks of the pending jobs.
+	pollInterval = 2 * time.Second
+	// leaseTTL is how long a job stays with a worker which stopped renewing
+	// it, e.g. because it crashed, before another worker takes it over.
+	leaseTTL = time.Minute
+)
+
+// Worker runs the jobs enqueued by the instances of the bot.
+type Worker interface {
+	// Run takes the pending jobs until ctx is done, then waits for the
+	// running ones to stop.
+	Run(ctx context.Context) error
+}
+
+type workerImpl struct {
+	mutex   sync.Mutex
+	store   state.Store
+	bot     telegram.Telegram
+	logger  logs.Logger
+	owner   string
+	running map[string]bool
+}
+
+// NewWorker runs the jobs of store, which must be shared with the webhook,
+// sending their messages with bot.
+func NewWorker(store state.Store, bot telegram.Telegram, logger logs.Logger) Worker {
+	hostname, _ := os.Hostname()
+
+	return &workerImpl{
+		store:   store,
+		bot:     bot,
+		logger:  logger,
+		owner:   fmt.Sprintf("%s-%d", hostname, os.Getpid()),
+		running: make(map[string]bool),
+	}
+}
+
+func (self *workerImpl) Run(ctx context.Context) error {
+	if !self.store.Shared() {
+		return ErrNotShared
+	}
+
+	self.restore()
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	group := sync.WaitGroup{}
+	defer group.Wait()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case <-ticker.C:
+		}
+
+		ids, err := self.store.Members(pendingKey)
+		if err != nil {
+			self.logger.Errorf("Fail listing the pending jobs: %v", err)
+			continue
+		}
+
+		for _, id := range ids {
+			if !self.claim(id) {
+				continue
+			}
+
+			group.Add(1)
+
+			go func(id string) {
+				defer group.Done()
+				self.run(ctx, id)
+			}(id)
+		}
+	}
+}
+
+// restore enqueues again the unfinished jobs of the journal which the store
+// lost.
+func (self *workerImpl) restore() {
+	journal := currentJournal()
+	if journal == nil {
+		return
+	}
+
+	unfinished, err := journal.Unfinished()
+	if err != nil {
+		self.logger.Errorf("Fail reading the journal of the jobs: %v", err)
+		return
+	}
+
+	for _, job := range unfinished {
+		found, err := self.store.Get(jobKey(job.ID), &Job{})
+		if err != nil || found {
+			continue
+		}
+
+		self.logger.Warnf("Job %s of kind %s is missing in the store, it's restored from the journal",
+			job.ID, job.Kind)
+
+		if err = self.store.Set(jobKey(job.ID), job, 0); err == nil {
+			_, err = self.store.Add(pendingKey, job.ID)
+		}
+
+		if err != nil {
+			self.logger.Errorf("Fail restoring job %s: %v", job.ID, err)
+		}
+	}
+}
+
+// claim takes the lease of a job unless it runs already.
+func (self *workerImpl) claim(id string) bool {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	if self.running[id] {
+		return false
+	}
+
+	taken, err := self.store.Lock(leaseKey(id), self.owner, leaseTTL)
+	if err != nil {
+		self.logger.Errorf("Fail taking job %s: %v", id, err)
+		return false
+	}
+
+	if taken {
+		self.running[id] = true
+	}
+
+	return taken
+}
+
+// run runs a claimed job while renewing its lease. A job is forgotten once
+// its handler returns, unless it was interrupted, then it's left to the
+// next worker.
+func (self *workerImpl) run(parent context.Context, id string) {
+	defer func() {
+		self.mutex.Lock()
+		delete(self.running, id)
+		self.mutex.Unlock()
+
+		self.store.Unlock(leaseKey(id), self.owner)
+	}()
+
+	job := Job{}
+
+	found, err := self.store.Get(jobKey(id), &job)
+	if err != nil {
+		self.logger.Errorf("Fail loading job %s: %v", id, err)
+		return
+	}
+
+	handler, ok := handlerOf(job.Kind)
+
+	if !found || !ok {
+		if found {
+			self.logger.Errorf("Job %s of kind %s has no handler, it's dropped", id, job.Kind)
+			self.record(job, fmt.Errorf("Kind %s has no handler", job.Kind))
+		}
+
+		self.forget(id)
+		return
+	}
+
+	if journal := currentJournal(); journal != nil {
+		if err = journal.Started(job); err != nil {
+			self.logger.Warnf("Fail recording the start of job %s: %v", id, err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+
+	go self.renew(ctx, cancel, id)
+
+	err = handler(ctx, self.bot, job)
+
+	if err != nil && ctx.Err() != nil {
+		self.logger.Warnf("Job %s of kind %s is interrupted, it will resume on the next worker", id, job.Kind)
+		return
+	}
+
+	if err != nil {
+		self.logger.Errorf("Job %s of kind %s fails: %v", id, job.Kind, err)
+	}
+
+	self.record(job, err)
+	self.forget(id)
+}
+
+// record writes the end of job in the journal.
+func (self *workerImpl) record(job Job, err error) {
+	journal := currentJournal()
+	if journal == nil {
+		return
+	}
+
+	if recordErr := journal.Finished(job, err); recordErr != nil {
+		self.logger.Warnf("Fail recording the end of job %s: %v", job.ID, recordErr)
+	}
+}
+
+// renew extends the lease of a job until ctx is done, it cancels the job
+// when the lease is lost.
+func (self *workerImpl) renew(ctx context.Context, cancel context.CancelFunc, id string) {
+	ticker := time.NewTicker(leaseTTL / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-ticker.C:
+		}
+
+		taken, err := self.store.Lock(leaseKey(id), self.owner, leaseTTL)
+		if err != nil {
+			self.logger.Warnf("Fail renewing the lease of job %s: %v", id, err)
+			continue
+		}
+
+		if !taken {
+			self.logger.Errorf("Job %s was taken over by another worker", id)
+			cancel()
+			return
+		}
+	}
+}
+
+func (self *workerImpl) forget(id string) {
+	if _, err := self.store.Remove(pendingKey, id); err != nil {
+		self.logger.Errorf("Fail removing job %s: %v", id, err)
+	}
+
+	self.store.Delete(jobKey(id))
+}
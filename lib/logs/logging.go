@@ -81,24 +81,22 @@ func (self *loggerImpl) writeLog(msg string, level logTypeEnum) error {
 			return errors.New("Please initize sentry first")
 		}
 	}
-
-    return errors.New("Crashing!!")
 }
 
 func (self *loggerImpl) Infof(format string, args ...interface{}) {
-    self.writeLog(fmt.Sprintf(format, args), eLogInfo)
+    self.writeLog(fmt.Sprintf(format, args...), eLogInfo)
 }
 
 func (self *loggerImpl) Warnf(format string, args ...interface{}) {
-    self.writeLog(fmt.Sprintf(format, args), eLogWarning)
+    self.writeLog(fmt.Sprintf(format, args...), eLogWarning)
 }
 
 func (self *loggerImpl) Errorf(format string, args ...interface{}) {
-    self.writeLog(fmt.Sprintf(format, args), eLogError)
+    self.writeLog(fmt.Sprintf(format, args...), eLogError)
 }
 
 func (self *loggerImpl) Fatalf(format string, args ...interface{}) {
-    self.writeLog(fmt.Sprintf(format, args), eLogFatal)
+    self.writeLog(fmt.Sprintf(format, args...), eLogFatal)
 }
 
 func (self *loggerImpl) Write(b []byte) (int, error) {
@@ -0,0 +1,157 @@
+package mux
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/audit"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/rbac"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/render"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/telegram"
+)
+
+// defaultAuditSince is how far /audit looks back without since.
+const defaultAuditSince = 24 * time.Hour
+
+func newAuditEntry(user *telegram.User, chatId int64) *audit.Entry {
+	entry := &audit.Entry{
+		Time:   time.Now(),
+		ChatID: chatId,
+	}
+
+	if user != nil {
+		entry.UserID = user.ID
+		entry.Username = user.UserName
+	}
+
+	return entry
+}
+
+// record finishes entry with err and appends it to the audit log, failing
+// to audit doesn't fail the request.
+func (self *muxImpl) record(entry *audit.Entry, err error) {
+	entry.Finish(err)
+
+	if err := audit.Record(*entry); err != nil {
+		self.logger.Warnf("Fail recording audit entry of /%s: %v", entry.Command, err)
+	}
+}
+
+// auditArgs lists the arguments of the callback as key=value.
+func (self *Callback) auditArgs() []string {
+	args := make([]string, 0, len(self.Args))
+
+	for key, value := range self.Args {
+		args = append(args, key+"="+value)
+	}
+
+	sort.Strings(args)
+	return args
+}
+
+// showAudit implements `/audit [user] [since]` where user is an id or an
+// @username and since is a duration like 2h or 7d, or a date 2006-01-02.
+func (self *muxImpl) showAudit(ctx *Context) error {
+	log, err := audit.Default()
+	if err != nil {
+		return ctx.Reply("The audit log isn't enabled")
+	}
+
+	filter := audit.Filter{Since: time.Now().Add(-defaultAuditSince)}
+
+	for _, arg := range ctx.Args {
+		if since, err := parseSince(arg); err == nil {
+			filter.Since = since
+		} else if strings.HasPrefix(arg, "@") {
+			filter.Username = strings.TrimPrefix(arg, "@")
+		} else if userId, err := strconv.ParseInt(arg, 10, 64); err == nil {
+			filter.UserID = userId
+		} else {
+			return ctx.Reply("Usage: /audit [user id|@username] [since, e.g. 2h, 7d or 2006-01-02]")
+		}
+	}
+
+	// The admins of some clusters only read what happened on them, the
+	// entries without cluster are only read by the admins of every cluster
+	everywhere, err := rbac.Allowed(ctx.Message.From.ID, rbac.AllClusters, rbac.RoleAdmin)
+	if err != nil {
+		return err
+	}
+
+	if !everywhere {
+		filter.Clusters, err = rbac.ClustersOf(ctx.Message.From.ID, rbac.RoleAdmin)
+		if err != nil {
+			return err
+		}
+	}
+
+	entries, err := log.Query(filter)
+	if err != nil {
+		return err
+	}
+
+	if len(entries) == 0 {
+		return ctx.Reply("No audit entry matches")
+	}
+
+	table := render.Table{
+		Columns: []render.Column{
+			{Title: "TIME"},
+			{Title: "USER", MaxWidth: 12},
+			{Title: "COMMAND", MaxWidth: 16},
+			{Title: "TARGET", Wide: true},
+			{Title: "RESULT"},
+		},
+		Wide: true,
+	}
+
+	for _, entry := range entries {
+		user := strconv.FormatInt(entry.UserID, 10)
+		if len(entry.Username) > 0 {
+			user = "@" + entry.Username
+		}
+
+		target := strings.Trim(strings.Join(
+			[]string{entry.Cluster, entry.Namespace, entry.Resource}, "/"), "/")
+
+		result := entry.Result
+		if len(entry.Confirmation) > 0 {
+			result = fmt.Sprintf("%s (%s)", result, entry.Confirmation)
+		}
+
+		table.Rows = append(table.Rows, []string{
+			entry.Time.UTC().Format("01-02 15:04"),
+			user,
+			strings.Join(append([]string{entry.Command}, entry.Args...), " "),
+			target,
+			result,
+		})
+	}
+
+	return ctx.SendTable(render.NewHTML(), table)
+}
+
+func parseSince(text string) (time.Time, error) {
+	if date, err := time.Parse("2006-01-02", text); err == nil {
+		return date, nil
+	}
+
+	if days := strings.TrimSuffix(text, "d"); days != text {
+		count, err := strconv.Atoi(days)
+		if err != nil {
+			return time.Time{}, err
+		}
+
+		return time.Now().AddDate(0, 0, -count), nil
+	}
+
+	duration, err := time.ParseDuration(text)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return time.Now().Add(-duration), nil
+}
@@ -0,0 +1,217 @@
+package mux
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/audit"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/logs"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/render"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/state"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/telegram"
+)
+
+// DefaultCallbackTTL is how long a button stays valid by default.
+const DefaultCallbackTTL = 24 * time.Hour
+
+var (
+	ErrCallbackTampered = errors.New("callback data has an invalid signature")
+	ErrCallbackExpired  = errors.New("callback has expired")
+)
+
+// Callback is the action of an inline button. It's stored server-side while
+// the button only carries a short signed token, so it isn't bound by the 64
+// bytes limit of the callback data.
+type Callback struct {
+	// Module is the name of the module which created the button.
+	Module string `json:"module"`
+	// Action tells the module what to do.
+	Action string `json:"action"`
+	// Args are the parameters of the action.
+	//
+	// optional
+	Args map[string]string `json:"args,omitempty"`
+	// UserID restricts the button to a user.
+	//
+	// optional
+	UserID int64 `json:"user_id,omitempty"`
+}
+
+// Codec converts a Callback to the callback data of a button and back.
+type Codec interface {
+	Encode(callback Callback, ttl time.Duration) (string, error)
+	// Decode returns ErrCallbackTampered or ErrCallbackExpired when data
+	// can't be trusted anymore.
+	Decode(data string) (*Callback, error)
+}
+
+type codecImpl struct {
+	store  state.Store
+	secret []byte
+}
+
+func NewCodec(store state.Store, secret []byte) Codec {
+	return &codecImpl{
+		store:  store,
+		secret: secret,
+	}
+}
+
+// DefaultCodec uses the store registered as module `state` and the secret
+// $TELEGRAM_CALLBACK_SECRET, default to the token of the bot.
+func DefaultCodec() (Codec, error) {
+	store, err := DefaultStore()
+	if err != nil {
+		return nil, err
+	}
+
+	secret := os.Getenv("TELEGRAM_CALLBACK_SECRET")
+	if len(secret) == 0 {
+		secret = os.Getenv("TELEGRAM_TOKEN")
+	}
+
+	return NewCodec(store, []byte(secret)), nil
+}
+
+// Encode stores callback for ttl and returns a token made of a random id and
+// its HMAC-SHA256 signature, 28 bytes long.
+func (self *codecImpl) Encode(callback Callback, ttl time.Duration) (string, error) {
+	if len(callback.Module) == 0 || len(callback.Action) == 0 {
+		return "", errors.New("callback needs a module and an action")
+	}
+
+	if ttl <= 0 {
+		ttl = DefaultCallbackTTL
+	}
+
+	buffer := make([]byte, 8)
+	if _, err := rand.Read(buffer); err != nil {
+		return "", err
+	}
+
+	id := base64.RawURLEncoding.EncodeToString(buffer)
+
+	if err := self.store.Set(callbackKey(id), callback, ttl); err != nil {
+		return "", err
+	}
+
+	return id + "." + self.sign(id), nil
+}
+
+func (self *codecImpl) Decode(data string) (*Callback, error) {
+	parts := strings.Split(data, ".")
+	if len(parts) != 2 {
+		return nil, ErrCallbackTampered
+	}
+
+	if !hmac.Equal([]byte(parts[1]), []byte(self.sign(parts[0]))) {
+		return nil, ErrCallbackTampered
+	}
+
+	callback := &Callback{}
+
+	found, err := self.store.Get(callbackKey(parts[0]), callback)
+	if err != nil {
+		return nil, err
+	}
+
+	if !found {
+		return nil, ErrCallbackExpired
+	}
+
+	return callback, nil
+}
+
+func (self *codecImpl) sign(id string) string {
+	mac := hmac.New(sha256.New, self.secret)
+	mac.Write([]byte(id))
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:12])
+}
+
+func callbackKey(id string) string {
+	return fmt.Sprintf("mux:callback:%s", id)
+}
+
+// CallbackContext carries a pressed button being handled.
+type CallbackContext struct {
+	Telegram telegram.Telegram
+	Logger   logs.Logger
+	Query    *telegram.CallbackQuery
+	Callback *Callback
+	// Audit is recorded once the button is handled, the module fills the
+	// target and the confirmation state.
+	Audit *audit.Entry
+
+	answered bool
+}
+
+// Toast answers the query with a notification shown at the top of the chat.
+func (self *CallbackContext) Toast(text string) error {
+	return self.answer(text, false)
+}
+
+// Alert answers the query with an alert the user has to dismiss.
+func (self *CallbackContext) Alert(text string) error {
+	return self.answer(text, true)
+}
+
+// Edit replaces the message carrying the button with the text built by
+// builder and markup, the keyboard is removed when markup is nil.
+func (self *CallbackContext) Edit(builder render.Builder, markup *telegram.InlineKeyboardMarkup) error {
+	message := builder.Config(0)
+	config := telegram.EditMessageConfig{
+		InlineMessageID: self.Query.InlineMessageID,
+		Text:            message.Text,
+		ParseMode:       message.ParseMode,
+		Entities:        message.Entities,
+		ReplyMarkup:     markup,
+	}
+
+	if self.Query.Message != nil {
+		config.ChatID = self.Query.Message.Chat.ID
+		config.MessageID = self.Query.Message.MessageID
+	}
+
+	_, err := self.Telegram.EditMessageText(config)
+	if errors.Is(err, telegram.ErrMessageNotModified) {
+		return nil
+	}
+
+	return err
+}
+
+// ChatID returns the chat where the button was pressed, 0 in inline mode.
+func (self *CallbackContext) ChatID() int64 {
+	if self.Query.Message == nil {
+		return 0
+	}
+
+	return self.Query.Message.Chat.ID
+}
+
+func (self *CallbackContext) answer(text string, alert bool) error {
+	if self.answered {
+		return nil
+	}
+
+	self.answered = true
+
+	// Telegram rejects notifications longer than 200 characters
+	if runes := []rune(text); len(runes) > 200 {
+		text = string(runes[:199]) + "…"
+	}
+
+	return self.Telegram.AnswerCallbackQuery(telegram.CallbackConfig{
+		CallbackQueryID: self.Query.ID,
+		Text:            text,
+		ShowAlert:       alert,
+	})
+}
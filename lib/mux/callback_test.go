@@ -0,0 +1,210 @@
+package mux
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/container"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/logs"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/state"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/telegram"
+)
+
+var registerStore sync.Once
+
+// standIn records the answers to the callback queries, the other methods of
+// telegram.Telegram aren't used by these tests.
+type standIn struct {
+	telegram.Telegram
+
+	answers []telegram.CallbackConfig
+}
+
+func (self *standIn) AnswerCallbackQuery(config telegram.CallbackConfig) error {
+	self.answers = append(self.answers, config)
+	return nil
+}
+
+func newCodec(t *testing.T, secret string) Codec {
+	store := state.NewMemoryStore()
+	if err := store.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	return NewCodec(store, []byte(secret))
+}
+
+// tamper changes the last character of the signature of data.
+func tamper(data string) string {
+	modified := []byte(data)
+	if modified[len(modified)-1] == 'A' {
+		modified[len(modified)-1] = 'B'
+	} else {
+		modified[len(modified)-1] = 'A'
+	}
+
+	return string(modified)
+}
+
+func TestCodec(t *testing.T) {
+	codec := newCodec(t, "secret")
+	callback := Callback{
+		Module: "cluster",
+		Action: "scale",
+		Args:   map[string]string{"deployment": "api", "replicas": "3"},
+		UserID: 42,
+	}
+
+	data, err := codec.Encode(callback, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(data) > 64 {
+		t.Errorf("Callback data %q is longer than 64 bytes", data)
+	}
+
+	decoded, err := codec.Decode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(*decoded, callback) {
+		t.Errorf("Expect %+v, got %+v", callback, *decoded)
+	}
+}
+
+func TestCodecTampered(t *testing.T) {
+	codec := newCodec(t, "secret")
+
+	data, err := codec.Encode(Callback{Module: "cluster", Action: "scale"}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := newCodec(t, "other").Encode(Callback{Module: "cluster", Action: "scale"}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]string{
+		"modified signature":       tamper(data),
+		"signed by another secret": other,
+		"without signature":        data[:len(data)-17],
+		"empty":                    "",
+	}
+
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := codec.Decode(data)
+			if !errors.Is(err, ErrCallbackTampered) {
+				t.Errorf("Expect ErrCallbackTampered, got %v", err)
+			}
+		})
+	}
+}
+
+func TestCodecExpired(t *testing.T) {
+	codec := newCodec(t, "secret")
+
+	data, err := codec.Encode(Callback{Module: "cluster", Action: "scale"}, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+
+	tests := map[string]string{
+		"expired": data,
+		// A well signed id the store never had
+		"unknown id": "AAAAAAAAAAA." + codec.(*codecImpl).sign("AAAAAAAAAAA"),
+	}
+
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := codec.Decode(data)
+			if !errors.Is(err, ErrCallbackExpired) {
+				t.Errorf("Expect ErrCallbackExpired, got %v", err)
+			}
+		})
+	}
+}
+
+func TestVerifyCallback(t *testing.T) {
+	t.Setenv("TELEGRAM_CALLBACK_SECRET", "secret")
+
+	registerStore.Do(func() {
+		if err := container.Register("state", state.NewMemoryStore()); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	codec, err := DefaultCodec()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := codec.Encode(Callback{Module: "cluster", Action: "scale", UserID: 42}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	shared, err := codec.Encode(Callback{Module: "cluster", Action: "scale"}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		data   string
+		userId int64
+		// alert is the answer of a rejected press, empty when it's accepted
+		alert string
+	}{
+		{name: "pressed by its user", data: data, userId: 42},
+		{name: "pressed by anyone", data: shared, userId: 7},
+		{name: "pressed by another user", data: data, userId: 7, alert: "This button isn't for you"},
+		{name: "tampered", data: tamper(data), userId: 42, alert: "This button is invalid"},
+		{
+			name:   "expired",
+			data:   "AAAAAAAAAAA." + codec.(*codecImpl).sign("AAAAAAAAAAA"),
+			userId: 42,
+			alert:  "This button has expired, please run the command again",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			bot := &standIn{}
+			query := &telegram.CallbackQuery{
+				ID:   "1",
+				From: &telegram.User{ID: test.userId},
+				Data: test.data,
+			}
+
+			callback, err := NewMux(bot, logs.NewLogger()).VerifyCallback(query)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(test.alert) == 0 {
+				if callback == nil || len(bot.answers) > 0 {
+					t.Fatalf("Expect the press to be accepted, got the answers %+v", bot.answers)
+				}
+
+				return
+			}
+
+			if callback != nil {
+				t.Fatalf("Expect the press to be rejected, got %+v", *callback)
+			}
+
+			if len(bot.answers) != 1 || bot.answers[0].Text != test.alert || !bot.answers[0].ShowAlert {
+				t.Errorf("Expect the alert %q, got %+v", test.alert, bot.answers)
+			}
+		})
+	}
+}
@@ -0,0 +1,172 @@
+package mux
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/container"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/state"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/telegram"
+)
+
+// ChatsModuleName is the name the registry of the chats is registered with.
+const ChatsModuleName = "chats"
+
+// chatsKey is the set of the ids of the registered chats, each chat is kept
+// under its own key so that the groups adding the bot at the same moment
+// don't overwrite each other.
+const chatsKey = "mux:chats"
+
+// RegisteredChat is a group or a channel the bot has been added to.
+type RegisteredChat struct {
+	ID      int64     `json:"id"`
+	Type    string    `json:"type"`
+	Title   string    `json:"title"`
+	AddedBy int64     `json:"added_by"`
+	AddedAt time.Time `json:"added_at"`
+}
+
+// Chats keeps the groups and the channels the bot is a member of.
+type Chats interface {
+	container.Module
+
+	Register(chat RegisteredChat) error
+	Unregister(chatId int64) error
+	// All returns the registered chats keyed by their id.
+	All() (map[int64]RegisteredChat, error)
+}
+
+type storeChatsImpl struct {
+	store state.Store
+}
+
+// NewStoreChats keeps the registered chats in store.
+func NewStoreChats(store state.Store) Chats {
+	return &storeChatsImpl{store: store}
+}
+
+func (self *storeChatsImpl) Init() error {
+	return nil
+}
+
+func (self *storeChatsImpl) Deinit() error {
+	return nil
+}
+
+func (self *storeChatsImpl) Register(chat RegisteredChat) error {
+	if err := self.store.Set(chatKey(chat.ID), chat, 0); err != nil {
+		return err
+	}
+
+	_, err := self.store.Add(chatsKey, strconv.FormatInt(chat.ID, 10))
+	return err
+}
+
+func (self *storeChatsImpl) Unregister(chatId int64) error {
+	if _, err := self.store.Remove(chatsKey, strconv.FormatInt(chatId, 10)); err != nil {
+		return err
+	}
+
+	return self.store.Delete(chatKey(chatId))
+}
+
+func (self *storeChatsImpl) All() (map[int64]RegisteredChat, error) {
+	members, err := self.store.Members(chatsKey)
+	if err != nil {
+		return nil, err
+	}
+
+	chats := make(map[int64]RegisteredChat)
+
+	for _, member := range members {
+		chatId, err := strconv.ParseInt(member, 10, 64)
+		if err != nil {
+			continue
+		}
+
+		chat := RegisteredChat{}
+
+		// The chat may be unregistered meanwhile
+		found, err := self.store.Get(chatKey(chatId), &chat)
+		if err != nil {
+			return nil, err
+		}
+
+		if found {
+			chats[chatId] = chat
+		}
+	}
+
+	return chats, nil
+}
+
+// DefaultStore returns the store registered as module `state`.
+func DefaultStore() (state.Store, error) {
+	module, err := container.Lookup("state")
+	if err != nil {
+		return nil, err
+	}
+
+	store, ok := module.(state.Store)
+	if !ok {
+		return nil, errors.New("Module `state` isn't a state.Store")
+	}
+
+	return store, nil
+}
+
+// DefaultChats returns the chats registered as module `chats`.
+func DefaultChats() (Chats, error) {
+	module, err := container.Lookup(ChatsModuleName)
+	if err != nil {
+		return nil, err
+	}
+
+	chats, ok := module.(Chats)
+	if !ok {
+		return nil, fmt.Errorf("Module `%s` isn't a mux.Chats", ChatsModuleName)
+	}
+
+	return chats, nil
+}
+
+// RegisteredChats returns the groups and channels the bot is a member of,
+// keyed by their id.
+func RegisteredChats() (map[int64]RegisteredChat, error) {
+	chats, err := DefaultChats()
+	if err != nil {
+		return nil, err
+	}
+
+	return chats.All()
+}
+
+func registerChat(chat telegram.Chat, addedBy int64) error {
+	chats, err := DefaultChats()
+	if err != nil {
+		return err
+	}
+
+	return chats.Register(RegisteredChat{
+		ID:      chat.ID,
+		Type:    chat.Type,
+		Title:   chat.Title,
+		AddedBy: addedBy,
+		AddedAt: time.Now(),
+	})
+}
+
+func unregisterChat(chatId int64) error {
+	chats, err := DefaultChats()
+	if err != nil {
+		return err
+	}
+
+	return chats.Unregister(chatId)
+}
+
+func chatKey(chatId int64) string {
+	return fmt.Sprintf("mux:chat:%d", chatId)
+}
@@ -0,0 +1,138 @@
+package mux
+
+import (
+	"os"
+	"strings"
+
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/audit"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/container"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/logs"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/rbac"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/render"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/telegram"
+)
+
+// CommandHandler performs a command sent by a user.
+type CommandHandler func(ctx *Context) error
+
+// Command describes a bot command provided by a module.
+type Command struct {
+	// Name is the command without the leading slash, 1-32 characters of
+	// lowercase English letters, digits and underscores.
+	Name string
+	// Description is shown in the command menu, 3-256 characters.
+	Description string
+	// Translations maps a two-letter ISO 639-1 language code to the
+	// description shown to the users using this language.
+	Translations map[string]string
+	// Scopes lists the telegram.Scope* types where the command is published
+	// and allowed to run, default to telegram.ScopeDefault.
+	Scopes []string
+	// Role is the minimal role required to run the command, modules check
+	// the role of the user on the cluster they operate by themselves.
+	//
+	// optional
+	Role rbac.Role
+	// Handler performs the command.
+	Handler CommandHandler
+}
+
+// CommandModule is a module providing commands to the bot.
+type CommandModule interface {
+	container.Module
+
+	Commands() []Command
+}
+
+// MessageModule is a module handling the messages which aren't commands,
+// such as the documents sent to the bot.
+type MessageModule interface {
+	container.Module
+
+	// HandleMessage returns false if the module isn't interested in the
+	// message, so that the next module can handle it.
+	HandleMessage(ctx *Context) (bool, error)
+}
+
+// CallbackModule is a module handling the buttons it created, the buttons
+// are routed by the Module field of their Callback.
+type CallbackModule interface {
+	container.Module
+
+	HandleCallback(ctx *CallbackContext) error
+}
+
+// Context carries a command or a message being handled.
+type Context struct {
+	Telegram telegram.Telegram
+	Logger   logs.Logger
+	Message  *telegram.Message
+	Command  string
+	Args     []string
+	// Audit is recorded once the command is handled, the module fills the
+	// target and the confirmation state. A plain message is only recorded
+	// when the module describes it.
+	Audit *audit.Entry
+}
+
+// Reply sends text back to the chat the command came from, a long text is
+// split or uploaded as a document.
+func (self *Context) Reply(text string) error {
+	_, err := self.Telegram.SendLongMessage(telegram.LongMessageConfig{
+		MessageConfig: telegram.MessageConfig{
+			ChatID: self.Message.Chat.ID,
+			Text:   text,
+		},
+	})
+	return err
+}
+
+// Send sends the text built by builder back to the chat the command came
+// from, a long text is split or uploaded as a document.
+func (self *Context) Send(builder render.Builder) error {
+	_, err := self.Telegram.SendLongMessage(telegram.LongMessageConfig{
+		MessageConfig: builder.Config(self.Message.Chat.ID),
+	})
+	return err
+}
+
+func (self Command) scopes() []string {
+	if len(self.Scopes) == 0 {
+		return []string{telegram.ScopeDefault}
+	}
+
+	return self.Scopes
+}
+
+func (self Command) hasScope(scopes ...string) bool {
+	for _, scope := range self.scopes() {
+		for _, expected := range scopes {
+			if scope == expected {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (self Command) description(languageCode string) string {
+	if translation, ok := self.Translations[languageCode]; ok {
+		return translation
+	}
+
+	return self.Description
+}
+
+// CommandText formats a command to be sent in chat, for example by a keyboard
+// button. Commands sent in groups mention the bot with $TELEGRAM_ALIAS, so
+// that the bot receives them.
+func CommandText(chat *telegram.Chat, command string, args ...string) string {
+	text := "/" + command
+
+	if alias := os.Getenv("TELEGRAM_ALIAS"); len(alias) > 0 && !chat.IsPrivate() {
+		text += "@" + strings.TrimPrefix(alias, "@")
+	}
+
+	return strings.Join(append([]string{text}, args...), " ")
+}
@@ -0,0 +1,88 @@
+package mux
+
+import (
+	"time"
+
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/telegram"
+)
+
+// Keyboard builds an inline keyboard whose buttons carry callbacks encoded
+// by a Codec. The first error is reported by Markup.
+type Keyboard interface {
+	// Button appends a button performing callback to the current row.
+	Button(text string, callback Callback) Keyboard
+	// URL appends a button opening url to the current row.
+	URL(text, url string) Keyboard
+	// Row starts a new row of buttons.
+	Row() Keyboard
+	Markup() (*telegram.InlineKeyboardMarkup, error)
+}
+
+type keyboardImpl struct {
+	codec Codec
+	ttl   time.Duration
+	rows  [][]telegram.InlineKeyboardButton
+	err   error
+}
+
+// NewKeyboard creates a keyboard whose buttons are valid for ttl, default to
+// DefaultCallbackTTL.
+func NewKeyboard(codec Codec, ttl time.Duration) Keyboard {
+	return &keyboardImpl{
+		codec: codec,
+		ttl:   ttl,
+		rows:  [][]telegram.InlineKeyboardButton{{}},
+	}
+}
+
+func (self *keyboardImpl) Button(text string, callback Callback) Keyboard {
+	if self.err != nil {
+		return self
+	}
+
+	data, err := self.codec.Encode(callback, self.ttl)
+	if err != nil {
+		self.err = err
+		return self
+	}
+
+	return self.append(telegram.InlineKeyboardButton{
+		Text:         text,
+		CallbackData: &data,
+	})
+}
+
+func (self *keyboardImpl) URL(text, url string) Keyboard {
+	return self.append(telegram.InlineKeyboardButton{
+		Text: text,
+		URL:  &url,
+	})
+}
+
+func (self *keyboardImpl) Row() Keyboard {
+	if len(self.rows[len(self.rows)-1]) > 0 {
+		self.rows = append(self.rows, []telegram.InlineKeyboardButton{})
+	}
+
+	return self
+}
+
+func (self *keyboardImpl) Markup() (*telegram.InlineKeyboardMarkup, error) {
+	if self.err != nil {
+		return nil, self.err
+	}
+
+	rows := self.rows
+	if len(rows[len(rows)-1]) == 0 {
+		rows = rows[:len(rows)-1]
+	}
+
+	return &telegram.InlineKeyboardMarkup{InlineKeyboard: rows}, nil
+}
+
+func (self *keyboardImpl) append(button telegram.InlineKeyboardButton) Keyboard {
+	last := len(self.rows) - 1
+	self.rows[last] = append(self.rows[last], button)
+
+	return self
+}
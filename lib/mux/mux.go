@@ -0,0 +1,324 @@
+package mux
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/audit"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/container"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/logs"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/rbac"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/telegram"
+)
+
+type Mux interface {
+	Commands() []Command
+	Dispatch(update *telegram.Update) error
+	HandleMessage(message *telegram.Message) (bool, error)
+	VerifyCallback(query *telegram.CallbackQuery) (*Callback, error)
+	HandleCallback(query *telegram.CallbackQuery) error
+	PublishCommands() error
+}
+
+type muxImpl struct {
+	telegram telegram.Telegram
+	logger   logs.Logger
+}
+
+func NewMux(bot telegram.Telegram, logger logs.Logger) Mux {
+	return &muxImpl{
+		telegram: bot,
+		logger:   logger,
+	}
+}
+
+// Commands collects the commands of every registered module following the
+// registration order, the first module registering a name wins.
+func (self *muxImpl) Commands() []Command {
+	commands := self.builtinCommands()
+	names := make(map[string]bool)
+
+	for _, command := range commands {
+		names[command.Name] = true
+	}
+
+	for _, name := range container.Names() {
+		module, err := container.Lookup(name)
+		if err != nil {
+			continue
+		}
+
+		provider, ok := module.(CommandModule)
+		if !ok {
+			continue
+		}
+
+		for _, command := range provider.Commands() {
+			if names[command.Name] {
+				self.logger.Warnf("command /%s of module %s is shadowed",
+					command.Name, name)
+				continue
+			}
+
+			names[command.Name] = true
+			commands = append(commands, command)
+		}
+	}
+
+	return commands
+}
+
+// HandleMessage runs the command carried by message or passes the message to
+// the modules handling plain messages, it returns false if nobody handles it.
+func (self *muxImpl) HandleMessage(message *telegram.Message) (bool, error) {
+	if message == nil {
+		return false, nil
+	}
+
+	if !message.IsCommand() {
+		return self.handlePlainMessage(message)
+	}
+
+	name := message.Command()
+
+	for _, command := range self.Commands() {
+		if command.Name != name {
+			continue
+		}
+
+		args := strings.Fields(message.CommandArguments())
+		entry := newAuditEntry(message.From, message.Chat.ID)
+		entry.Describe(name, args...)
+
+		allowed, err := self.isAllowed(command, message)
+		if err != nil {
+			self.record(entry, err)
+			return true, err
+		}
+
+		if !allowed {
+			entry.Result = audit.ResultDenied
+			self.record(entry, nil)
+
+			return true, self.telegram.ReplyMessage(message.Chat.ID,
+				fmt.Sprintf("You are not allowed to run /%s here", name))
+		}
+
+		err = command.Handler(&Context{
+			Telegram: self.telegram,
+			Logger:   self.logger,
+			Message:  message,
+			Command:  name,
+			Args:     args,
+			Audit:    entry,
+		})
+
+		self.record(entry, err)
+		return true, err
+	}
+
+	return false, nil
+}
+
+func (self *muxImpl) handlePlainMessage(message *telegram.Message) (bool, error) {
+	ctx := &Context{
+		Telegram: self.telegram,
+		Logger:   self.logger,
+		Message:  message,
+		Audit:    newAuditEntry(message.From, message.Chat.ID),
+	}
+
+	for _, name := range container.Names() {
+		module, err := container.Lookup(name)
+		if err != nil {
+			continue
+		}
+
+		handler, ok := module.(MessageModule)
+		if !ok {
+			continue
+		}
+
+		handled, err := handler.HandleMessage(ctx)
+		if len(ctx.Audit.Command) > 0 {
+			self.record(ctx.Audit, err)
+		}
+
+		if handled || err != nil {
+			return handled, err
+		}
+	}
+
+	return false, nil
+}
+
+// VerifyCallback decodes the callback of a pressed button. Tampered or
+// expired buttons and buttons pressed by the wrong user are answered with
+// an alert and nil is returned.
+func (self *muxImpl) VerifyCallback(query *telegram.CallbackQuery) (*Callback, error) {
+	codec, err := DefaultCodec()
+	if err != nil {
+		return nil, err
+	}
+
+	callback, err := codec.Decode(query.Data)
+
+	switch {
+	case errors.Is(err, ErrCallbackTampered):
+		self.logger.Warnf("user %d sent tampered callback data %q",
+			query.From.ID, query.Data)
+		return nil, self.alert(query, "This button is invalid")
+
+	case errors.Is(err, ErrCallbackExpired):
+		return nil, self.alert(query, "This button has expired, please run the command again")
+
+	case err != nil:
+		return nil, err
+
+	case callback.UserID != 0 && callback.UserID != query.From.ID:
+		return nil, self.alert(query, "This button isn't for you")
+	}
+
+	return callback, nil
+}
+
+// HandleCallback routes a pressed button to the module which created it. The
+// query is answered with the toast or the alert chosen by the module, or
+// with an alert showing the error of the module.
+func (self *muxImpl) HandleCallback(query *telegram.CallbackQuery) error {
+	callback, err := self.VerifyCallback(query)
+	if callback == nil || err != nil {
+		return err
+	}
+
+	if callback.Module == tableModule && callback.Action == pageAction {
+		return self.turnPage(query, callback)
+	}
+
+	module, err := container.Lookup(callback.Module)
+	if err != nil {
+		return self.alert(query, "This button isn't supported anymore")
+	}
+
+	handler, ok := module.(CallbackModule)
+	if !ok {
+		return self.alert(query, "This button isn't supported anymore")
+	}
+
+	ctx := &CallbackContext{
+		Telegram: self.telegram,
+		Logger:   self.logger,
+		Query:    query,
+		Callback: callback,
+		Audit:    newAuditEntry(query.From, 0),
+	}
+
+	ctx.Audit.ChatID = ctx.ChatID()
+	ctx.Audit.Describe(callback.Module+"."+callback.Action, callback.auditArgs()...)
+
+	err = handler.HandleCallback(ctx)
+	self.record(ctx.Audit, err)
+	if err != nil {
+		if answerErr := ctx.Alert(fmt.Sprintf("Failed: %v", err)); answerErr != nil {
+			self.logger.Warnf("Fail answering callback %s: %v", query.ID, answerErr)
+		}
+
+		return err
+	}
+
+	// Stop the loading animation of the button
+	return ctx.Toast("")
+}
+
+func (self *muxImpl) alert(query *telegram.CallbackQuery, text string) error {
+	return self.telegram.AnswerCallbackQuery(telegram.CallbackConfig{
+		CallbackQueryID: query.ID,
+		Text:            text,
+		ShowAlert:       true,
+	})
+}
+
+func (self *muxImpl) isAllowed(command Command, message *telegram.Message) (bool, error) {
+	if command.Role > rbac.RoleNone {
+		if message.From == nil {
+			return false, nil
+		}
+
+		allowed, err := rbac.Allowed(message.From.ID, "", command.Role)
+		if !allowed || err != nil {
+			return false, err
+		}
+	}
+
+	if command.hasScope(telegram.ScopeDefault) {
+		return true, nil
+	}
+
+	if message.Chat.IsPrivate() {
+		return command.hasScope(telegram.ScopeAllPrivateChats), nil
+	}
+
+	if command.hasScope(telegram.ScopeAllGroupChats) {
+		return true, nil
+	}
+
+	if !command.hasScope(telegram.ScopeAllChatAdministrators) || message.From == nil {
+		return false, nil
+	}
+
+	member, err := self.telegram.GetChatMember(message.Chat.ID, message.From.ID)
+	if err != nil {
+		return false, err
+	}
+
+	return member.IsCreator() || member.IsAdministrator(), nil
+}
+
+func (self *muxImpl) builtinCommands() []Command {
+	return []Command{
+		{
+			Name:        "start",
+			Description: "Start talking with the bot",
+			Scopes:      []string{telegram.ScopeAllPrivateChats},
+			Handler:     self.help,
+		},
+		{
+			Name:        "help",
+			Description: "List the commands you can run",
+			Handler:     self.help,
+		},
+		{
+			Name:        "audit",
+			Description: "Show the audit log, filtered by user and since",
+			Role:        rbac.RoleAdmin,
+			Handler:     self.showAudit,
+		},
+	}
+}
+
+func (self *muxImpl) help(ctx *Context) error {
+	var builder strings.Builder
+
+	languageCode := ""
+	if ctx.Message.From != nil {
+		languageCode = ctx.Message.From.LanguageCode
+	}
+
+	builder.WriteString("Available commands:\n")
+
+	for _, command := range self.Commands() {
+		allowed, err := self.isAllowed(command, ctx.Message)
+		if err != nil {
+			return err
+		}
+
+		if allowed {
+			builder.WriteString(fmt.Sprintf("/%s - %s\n",
+				command.Name,
+				command.description(languageCode)))
+		}
+	}
+
+	return ctx.Reply(builder.String())
+}
@@ -0,0 +1,97 @@
+package mux
+
+import (
+	"sort"
+
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/telegram"
+)
+
+// publishedScopes are the scopes the command menu is published to. Telegram
+// shows the narrowest matching scope, so group administrators see the
+// all_chat_administrators list instead of the all_group_chats one.
+var publishedScopes = []string{
+	telegram.ScopeDefault,
+	telegram.ScopeAllPrivateChats,
+	telegram.ScopeAllGroupChats,
+	telegram.ScopeAllChatAdministrators,
+}
+
+// PublishCommands registers the command menu of every scope and every
+// language the commands are translated to.
+func (self *muxImpl) PublishCommands() error {
+	commands := self.Commands()
+	languages := []string{""}
+	seen := make(map[string]bool)
+
+	for _, command := range commands {
+		for languageCode := range command.Translations {
+			if !seen[languageCode] {
+				seen[languageCode] = true
+				languages = append(languages, languageCode)
+			}
+		}
+	}
+
+	sort.Strings(languages[1:])
+
+	for _, scope := range publishedScopes {
+		for _, languageCode := range languages {
+			botCommands := menuOf(commands, scope, languageCode)
+			botScope := &telegram.BotCommandScope{Type: scope}
+
+			if len(botCommands) == 0 {
+				err := self.telegram.DeleteMyCommands(botScope, languageCode)
+				if err != nil {
+					return err
+				}
+				continue
+			}
+
+			err := self.telegram.SetMyCommands(telegram.CommandsConfig{
+				Commands:     botCommands,
+				Scope:        botScope,
+				LanguageCode: languageCode,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func menuOf(commands []Command, scope, languageCode string) []telegram.BotCommand {
+	var expected []string
+
+	switch scope {
+	case telegram.ScopeAllPrivateChats:
+		expected = []string{telegram.ScopeDefault, telegram.ScopeAllPrivateChats}
+
+	case telegram.ScopeAllGroupChats:
+		expected = []string{telegram.ScopeDefault, telegram.ScopeAllGroupChats}
+
+	case telegram.ScopeAllChatAdministrators:
+		expected = []string{
+			telegram.ScopeDefault,
+			telegram.ScopeAllGroupChats,
+			telegram.ScopeAllChatAdministrators,
+		}
+
+	default:
+		expected = []string{scope}
+	}
+
+	menu := make([]telegram.BotCommand, 0)
+
+	for _, command := range commands {
+		if command.hasScope(expected...) {
+			menu = append(menu, telegram.BotCommand{
+				Command:     command.Name,
+				Description: command.description(languageCode),
+			})
+		}
+	}
+
+	return menu
+}
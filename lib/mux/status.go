@@ -0,0 +1,115 @@
+package mux
+
+import (
+	"errors"
+	"time"
+
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/render"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/telegram"
+)
+
+// DefaultStatusInterval spaces the edits of a status message, Telegram
+// allows about 20 messages per minute in a group.
+const DefaultStatusInterval = 3 * time.Second
+
+// Status is a message edited in place to show the progress of a long
+// running action, instead of flooding the chat with a message per step.
+type Status interface {
+	// Update edits the message unless it was edited less than the interval
+	// ago, the skipped texts are dropped since a later one replaces them.
+	Update(builder render.Builder, markup *telegram.InlineKeyboardMarkup) error
+	// Finish always edits the message with the final text.
+	Finish(builder render.Builder, markup *telegram.InlineKeyboardMarkup) error
+	ChatID() int64
+	MessageID() int
+}
+
+type statusImpl struct {
+	telegram  telegram.Telegram
+	chatId    int64
+	messageId int
+	interval  time.Duration
+	edited    time.Time
+}
+
+// NewStatus edits the message messageId of chatId.
+func NewStatus(bot telegram.Telegram, chatId int64, messageId int) Status {
+	return &statusImpl{
+		telegram:  bot,
+		chatId:    chatId,
+		messageId: messageId,
+		interval:  DefaultStatusInterval,
+		edited:    time.Now(),
+	}
+}
+
+// SendStatus sends the first text of a status message to chatId, replying
+// to replyTo if it isn't 0.
+func SendStatus(
+	bot telegram.Telegram,
+	chatId int64,
+	replyTo int,
+	builder render.Builder,
+) (Status, error) {
+	config := builder.Config(chatId)
+	config.ReplyToMessageID = replyTo
+
+	message, err := bot.SendMessage(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewStatus(bot, chatId, message.MessageID), nil
+}
+
+func (self *statusImpl) Update(
+	builder render.Builder,
+	markup *telegram.InlineKeyboardMarkup,
+) error {
+	if time.Since(self.edited) < self.interval {
+		return nil
+	}
+
+	err := self.edit(builder, markup)
+	if errors.Is(err, telegram.ErrTooManyRequests) {
+		return nil
+	}
+
+	return err
+}
+
+func (self *statusImpl) Finish(
+	builder render.Builder,
+	markup *telegram.InlineKeyboardMarkup,
+) error {
+	return self.edit(builder, markup)
+}
+
+func (self *statusImpl) ChatID() int64 {
+	return self.chatId
+}
+
+func (self *statusImpl) MessageID() int {
+	return self.messageId
+}
+
+func (self *statusImpl) edit(builder render.Builder, markup *telegram.InlineKeyboardMarkup) error {
+	message := builder.Config(self.chatId)
+
+	_, err := self.telegram.EditMessageText(telegram.EditMessageConfig{
+		ChatID:      self.chatId,
+		MessageID:   self.messageId,
+		Text:        message.Text,
+		ParseMode:   message.ParseMode,
+		Entities:    message.Entities,
+		ReplyMarkup: markup,
+	})
+
+	self.edited = time.Now()
+
+	if errors.Is(err, telegram.ErrMessageNotModified) {
+		return nil
+	}
+
+	return err
+}
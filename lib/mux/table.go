@@ -0,0 +1,161 @@
+package mux
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/render"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/telegram"
+)
+
+// The buttons of the tables sent by SendTable are handled by the mux itself,
+// under a module name no module can register.
+const (
+	tableModule = "mux"
+	pageAction  = "page"
+)
+
+// pagedTable is what a message sent by SendTable shows, it's kept in the
+// store as long as the buttons of the message are valid.
+type pagedTable struct {
+	// Header is the HTML shown above the table.
+	Header string       `json:"header"`
+	Table  render.Table `json:"table"`
+}
+
+// SendTable sends table after the HTML built by header back to the chat the
+// command came from. A table of several pages is sent with buttons turning
+// its pages, only the author of the command can press them.
+func (self *Context) SendTable(header render.Builder, table render.Table) error {
+	if table.Pages() <= 1 {
+		return self.Send(table.Render(header, 0))
+	}
+
+	store, err := DefaultStore()
+	if err != nil {
+		return err
+	}
+
+	buffer := make([]byte, 8)
+	if _, err := rand.Read(buffer); err != nil {
+		return err
+	}
+
+	id := base64.RawURLEncoding.EncodeToString(buffer)
+	paged := pagedTable{Header: header.String(), Table: table}
+
+	if err := store.Set(tableKey(id), paged, DefaultCallbackTTL); err != nil {
+		return err
+	}
+
+	var userId int64
+	if self.Message.From != nil {
+		userId = self.Message.From.ID
+	}
+
+	text, markup, err := paged.page(id, 0, userId)
+	if err != nil {
+		return err
+	}
+
+	_, err = self.Telegram.SendMessage(telegram.MessageConfig{
+		ChatID:      self.Message.Chat.ID,
+		Text:        text,
+		ParseMode:   telegram.ModeHTML,
+		ReplyMarkup: markup,
+	})
+	return err
+}
+
+// turnPage edits a message sent by SendTable to show the page of callback.
+func (self *muxImpl) turnPage(query *telegram.CallbackQuery, callback *Callback) error {
+	store, err := DefaultStore()
+	if err != nil {
+		return err
+	}
+
+	id := callback.Args["table"]
+	paged := pagedTable{}
+
+	found, err := store.Get(tableKey(id), &paged)
+	if err != nil {
+		return err
+	} else if !found {
+		return self.alert(query, "This button has expired, please run the command again")
+	}
+
+	page, err := strconv.Atoi(callback.Args["page"])
+	if err != nil || page < 0 || page >= paged.Table.Pages() {
+		return self.alert(query, "This button is invalid")
+	}
+
+	text, markup, err := paged.page(id, page, callback.UserID)
+	if err != nil {
+		return err
+	}
+
+	config := telegram.EditMessageConfig{
+		InlineMessageID: query.InlineMessageID,
+		Text:            text,
+		ParseMode:       telegram.ModeHTML,
+		ReplyMarkup:     markup,
+	}
+
+	if query.Message != nil {
+		config.ChatID = query.Message.Chat.ID
+		config.MessageID = query.Message.MessageID
+	}
+
+	_, err = self.telegram.EditMessageText(config)
+	if err != nil && !errors.Is(err, telegram.ErrMessageNotModified) {
+		return err
+	}
+
+	// Stop the loading animation of the button
+	return self.telegram.AnswerCallbackQuery(telegram.CallbackConfig{
+		CallbackQueryID: query.ID,
+	})
+}
+
+// page renders page of the table and its buttons, restricted to userId.
+func (self pagedTable) page(
+	id string,
+	page int,
+	userId int64,
+) (string, *telegram.InlineKeyboardMarkup, error) {
+	codec, err := DefaultCodec()
+	if err != nil {
+		return "", nil, err
+	}
+
+	var encodeErr error
+
+	markup := self.Table.Keyboard(page, func(page int) string {
+		data, err := codec.Encode(Callback{
+			Module: tableModule,
+			Action: pageAction,
+			Args: map[string]string{
+				"table": id,
+				"page":  strconv.Itoa(page),
+			},
+			UserID: userId,
+		}, DefaultCallbackTTL)
+		if err != nil && encodeErr == nil {
+			encodeErr = err
+		}
+
+		return data
+	})
+	if encodeErr != nil {
+		return "", nil, encodeErr
+	}
+
+	return self.Header + self.Table.Render(render.NewHTML(), page).String(), markup, nil
+}
+
+func tableKey(id string) string {
+	return fmt.Sprintf("mux:table:%s", id)
+}
@@ -0,0 +1,223 @@
+package mux
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/container"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/logs"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/telegram"
+)
+
+// Kinds of update, named after the field of telegram.Update carrying them.
+const (
+	UpdateMessage            = "message"
+	UpdateEditedMessage      = "edited_message"
+	UpdateChannelPost        = "channel_post"
+	UpdateEditedChannelPost  = "edited_channel_post"
+	UpdateInlineQuery        = "inline_query"
+	UpdateChosenInlineResult = "chosen_inline_result"
+	UpdateCallbackQuery      = "callback_query"
+	UpdateShippingQuery      = "shipping_query"
+	UpdatePreCheckoutQuery   = "pre_checkout_query"
+	UpdatePoll               = "poll"
+	UpdatePollAnswer         = "poll_answer"
+	UpdateMyChatMember       = "my_chat_member"
+	UpdateChatMember         = "chat_member"
+	UpdateChatJoinRequest    = "chat_join_request"
+	UpdateUnknown            = "unknown"
+)
+
+// UpdateModule is a module hooking the updates of some kinds before the mux
+// handles them.
+type UpdateModule interface {
+	container.Module
+
+	// UpdateKinds lists the Update* kinds the module wants to see.
+	UpdateKinds() []string
+	// HandleUpdate returns true to stop the mux from handling the update.
+	HandleUpdate(ctx *UpdateContext) (bool, error)
+}
+
+// UpdateContext carries an update being dispatched.
+type UpdateContext struct {
+	Telegram telegram.Telegram
+	Logger   logs.Logger
+	Kind     string
+	Update   *telegram.Update
+}
+
+// KindOf returns the kind of update.
+func KindOf(update *telegram.Update) string {
+	switch {
+	case update.Message != nil:
+		return UpdateMessage
+	case update.EditedMessage != nil:
+		return UpdateEditedMessage
+	case update.ChannelPost != nil:
+		return UpdateChannelPost
+	case update.EditedChannelPost != nil:
+		return UpdateEditedChannelPost
+	case update.InlineQuery != nil:
+		return UpdateInlineQuery
+	case update.ChosenInlineResult != nil:
+		return UpdateChosenInlineResult
+	case update.CallbackQuery != nil:
+		return UpdateCallbackQuery
+	case update.ShippingQuery != nil:
+		return UpdateShippingQuery
+	case update.PreCheckoutQuery != nil:
+		return UpdatePreCheckoutQuery
+	case update.Poll != nil:
+		return UpdatePoll
+	case update.PollAnswer != nil:
+		return UpdatePollAnswer
+	case update.MyChatMember != nil:
+		return UpdateMyChatMember
+	case update.ChatMember != nil:
+		return UpdateChatMember
+	case update.ChatJoinRequest != nil:
+		return UpdateChatJoinRequest
+	}
+
+	return UpdateUnknown
+}
+
+// Dispatch handles an update of any kind. The modules hooking its kind see it
+// first, then the mux handles messages, button presses and the membership of
+// the bot. Edited messages are only handled like new ones when
+// $TELEGRAM_HANDLE_EDITS is true, the other kinds are ignored.
+func (self *muxImpl) Dispatch(update *telegram.Update) error {
+	ctx := &UpdateContext{
+		Telegram: self.telegram,
+		Logger:   self.logger,
+		Kind:     KindOf(update),
+		Update:   update,
+	}
+
+	handled, err := self.hookUpdate(ctx)
+	if handled || err != nil {
+		return err
+	}
+
+	switch ctx.Kind {
+	case UpdateMessage:
+		return self.dispatchMessage(update.Message)
+
+	case UpdateEditedMessage:
+		if os.Getenv("TELEGRAM_HANDLE_EDITS") == "true" {
+			return self.dispatchMessage(update.EditedMessage)
+		}
+
+	case UpdateCallbackQuery:
+		return self.HandleCallback(update.CallbackQuery)
+
+	case UpdateMyChatMember:
+		return self.handleMembership(update.MyChatMember)
+	}
+
+	return nil
+}
+
+func (self *muxImpl) hookUpdate(ctx *UpdateContext) (bool, error) {
+	for _, name := range container.Names() {
+		module, err := container.Lookup(name)
+		if err != nil {
+			continue
+		}
+
+		hook, ok := module.(UpdateModule)
+		if !ok {
+			continue
+		}
+
+		for _, kind := range hook.UpdateKinds() {
+			if kind != ctx.Kind {
+				continue
+			}
+
+			handled, err := hook.HandleUpdate(ctx)
+			if handled || err != nil {
+				return handled, err
+			}
+			break
+		}
+	}
+
+	return false, nil
+}
+
+// dispatchMessage handles the messages of private chats and the messages
+// mentioning $TELEGRAM_ALIAS in groups, only the commands without alias.
+func (self *muxImpl) dispatchMessage(message *telegram.Message) error {
+	text := strings.Trim(message.Text, " ")
+	if len(text) == 0 {
+		text = strings.Trim(message.Caption, " ")
+	}
+
+	if !message.Chat.IsPrivate() {
+		alias := os.Getenv("TELEGRAM_ALIAS")
+
+		// Every text contains an empty alias
+		if len(alias) == 0 && !message.IsCommand() {
+			return nil
+		}
+
+		if len(alias) > 0 && !strings.Contains(text, alias) {
+			return nil
+		}
+	}
+
+	handled, err := self.HandleMessage(message)
+	if err != nil || handled {
+		return err
+	}
+
+	return self.telegram.ReplyMessage(message.Chat.ID,
+		"Sorry, I don't understand. Send /help to see what I can do")
+}
+
+// handleMembership registers the groups and channels the bot is added to,
+// greeting the groups, and forgets the ones it leaves.
+func (self *muxImpl) handleMembership(update *telegram.ChatMemberUpdated) error {
+	if update.Chat.IsPrivate() {
+		return nil
+	}
+
+	wasMember := isMember(update.OldChatMember)
+	nowMember := isMember(update.NewChatMember)
+
+	switch {
+	case !wasMember && nowMember:
+		if err := registerChat(update.Chat, update.From.ID); err != nil {
+			return err
+		}
+
+		if update.Chat.IsChannel() {
+			return nil
+		}
+
+		return self.telegram.ReplyMessage(update.Chat.ID, fmt.Sprintf(
+			"Hello %s! I help you to operate Kubernetes clusters from here, "+
+				"mention me with /help to see what I can do.",
+			update.Chat.Title))
+
+	case wasMember && !nowMember:
+		return unregisterChat(update.Chat.ID)
+	}
+
+	return nil
+}
+
+func isMember(member telegram.ChatMember) bool {
+	switch member.Status {
+	case "creator", "administrator", "member":
+		return true
+
+	case "restricted":
+		return member.IsMember
+	}
+
+	return false
+}
@@ -0,0 +1,220 @@
+package rbac
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/container"
+)
+
+// Role grants the permissions of the lower roles plus its own.
+type Role int
+
+const (
+	// RoleNone can't see anything.
+	RoleNone Role = iota
+	// RoleViewer reads the state of the clusters.
+	RoleViewer
+	// RoleOperator changes the workloads, e.g. restarts, scales or drains.
+	RoleOperator
+	// RoleAdmin applies manifests and reads the audit log.
+	RoleAdmin
+)
+
+// AllClusters asks RoleOf for the role bound on every cluster, ignoring the
+// bindings scoped to a single cluster.
+const AllClusters = "*"
+
+var roleNames = map[Role]string{
+	RoleNone:     "none",
+	RoleViewer:   "viewer",
+	RoleOperator: "operator",
+	RoleAdmin:    "admin",
+}
+
+func (self Role) String() string {
+	return roleNames[self]
+}
+
+// ParseRole converts the name of a role back to the role.
+func ParseRole(name string) (Role, error) {
+	for role, roleName := range roleNames {
+		if roleName == strings.ToLower(strings.TrimSpace(name)) {
+			return role, nil
+		}
+	}
+
+	return RoleNone, fmt.Errorf("Role %q doesn't exist", name)
+}
+
+// Policy tells the role of the users.
+type Policy interface {
+	container.Module
+
+	// RoleOf returns the role of userId on cluster. With an empty cluster
+	// it returns the highest role of the user on any cluster, with
+	// AllClusters the role the user has everywhere.
+	RoleOf(userId int64, cluster string) (Role, error)
+	// ClustersOf lists the clusters where userId has at least role through
+	// a binding scoped to them.
+	ClustersOf(userId int64, role Role) ([]string, error)
+}
+
+type binding struct {
+	role    Role
+	cluster string
+}
+
+type envPolicyImpl struct {
+	defaultRole Role
+	bindings    map[int64][]binding
+}
+
+// NewEnvPolicy reads the policy from $BOT_RBAC, a list of bindings separated
+// by semicolons like `1234:admin;5678:operator@staging`, binding a user to a
+// role on every cluster or on a single one. Users without binding have the
+// role of $BOT_DEFAULT_ROLE, default to none so that strangers who find the
+// bot see nothing, set it to viewer to open the read-only commands.
+func NewEnvPolicy() Policy {
+	return &envPolicyImpl{}
+}
+
+func (self *envPolicyImpl) Init() error {
+	self.defaultRole = RoleNone
+	self.bindings = make(map[int64][]binding)
+
+	if name := os.Getenv("BOT_DEFAULT_ROLE"); len(name) > 0 {
+		role, err := ParseRole(name)
+		if err != nil {
+			return err
+		}
+
+		self.defaultRole = role
+	}
+
+	for _, item := range strings.Split(os.Getenv("BOT_RBAC"), ";") {
+		if len(strings.TrimSpace(item)) == 0 {
+			continue
+		}
+
+		parts := strings.SplitN(item, ":", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("Binding %q must look like <user id>:<role>[@cluster]", item)
+		}
+
+		userId, err := strconv.ParseInt(strings.TrimSpace(parts[0]), 10, 64)
+		if err != nil {
+			return fmt.Errorf("Binding %q has an invalid user id: %v", item, err)
+		}
+
+		roleName, cluster := parts[1], ""
+		if at := strings.Index(roleName, "@"); at >= 0 {
+			roleName, cluster = roleName[:at], strings.TrimSpace(roleName[at+1:])
+		}
+
+		role, err := ParseRole(roleName)
+		if err != nil {
+			return err
+		}
+
+		self.bindings[userId] = append(self.bindings[userId], binding{
+			role:    role,
+			cluster: cluster,
+		})
+	}
+
+	return nil
+}
+
+func (self *envPolicyImpl) Deinit() error {
+	return nil
+}
+
+func (self *envPolicyImpl) RoleOf(userId int64, cluster string) (Role, error) {
+	bindings, ok := self.bindings[userId]
+	if !ok {
+		return self.defaultRole, nil
+	}
+
+	role := RoleNone
+
+	for _, binding := range bindings {
+		if Matches(binding.cluster, cluster) {
+			if binding.role > role {
+				role = binding.role
+			}
+		}
+	}
+
+	return role, nil
+}
+
+func (self *envPolicyImpl) ClustersOf(userId int64, role Role) ([]string, error) {
+	clusters := make([]string, 0)
+
+	for _, binding := range self.bindings[userId] {
+		if len(binding.cluster) > 0 && binding.role >= role {
+			clusters = append(clusters, binding.cluster)
+		}
+	}
+
+	return clusters, nil
+}
+
+// Matches tells if a binding to bindingCluster, empty for every cluster,
+// applies to cluster as RoleOf understands it.
+func Matches(bindingCluster, cluster string) bool {
+	if len(bindingCluster) == 0 {
+		return true
+	}
+
+	if cluster == AllClusters {
+		return false
+	}
+
+	return len(cluster) == 0 || bindingCluster == cluster
+}
+
+// Default returns the policy registered as module `rbac`.
+func Default() (Policy, error) {
+	module, err := container.Lookup("rbac")
+	if err != nil {
+		return nil, err
+	}
+
+	policy, ok := module.(Policy)
+	if !ok {
+		return nil, errors.New("Module `rbac` isn't a rbac.Policy")
+	}
+
+	return policy, nil
+}
+
+// Allowed checks that userId has at least the role required on cluster.
+func Allowed(userId int64, cluster string, required Role) (bool, error) {
+	policy, err := Default()
+	if err != nil {
+		return false, err
+	}
+
+	role, err := policy.RoleOf(userId, cluster)
+	if err != nil {
+		return false, err
+	}
+
+	return role >= required, nil
+}
+
+// ClustersOf lists the clusters where userId has at least the role required
+// through a binding scoped to them.
+func ClustersOf(userId int64, required Role) ([]string, error) {
+	policy, err := Default()
+	if err != nil {
+		return nil, err
+	}
+
+	return policy.ClustersOf(userId, required)
+}
@@ -0,0 +1,102 @@
+package render
+
+import (
+	"strings"
+	"unicode/utf16"
+
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/telegram"
+)
+
+// EntityBuilder builds a plain text and the entities formatting it, which
+// needs no escaping at all.
+type EntityBuilder interface {
+	Builder
+
+	Entities() []telegram.MessageEntity
+}
+
+type entityImpl struct {
+	builder  strings.Builder
+	length   int
+	entities []telegram.MessageEntity
+}
+
+func NewEntities() EntityBuilder {
+	return &entityImpl{
+		entities: make([]telegram.MessageEntity, 0),
+	}
+}
+
+// utf16Length is the length of text as counted by Telegram for the offsets
+// of the entities.
+func utf16Length(text string) int {
+	return len(utf16.Encode([]rune(text)))
+}
+
+func (self *entityImpl) append(text string, entity telegram.MessageEntity) Builder {
+	entity.Offset = self.length
+	entity.Length = utf16Length(text)
+
+	self.builder.WriteString(text)
+	self.length += entity.Length
+
+	if entity.Length > 0 {
+		self.entities = append(self.entities, entity)
+	}
+
+	return self
+}
+
+func (self *entityImpl) Text(text string) Builder {
+	self.builder.WriteString(text)
+	self.length += utf16Length(text)
+	return self
+}
+
+func (self *entityImpl) Line(text string) Builder {
+	return self.Text(text + "\n")
+}
+
+func (self *entityImpl) Bold(text string) Builder {
+	return self.append(text, telegram.MessageEntity{Type: "bold"})
+}
+
+func (self *entityImpl) Italic(text string) Builder {
+	return self.append(text, telegram.MessageEntity{Type: "italic"})
+}
+
+func (self *entityImpl) Code(text string) Builder {
+	return self.append(text, telegram.MessageEntity{Type: "code"})
+}
+
+func (self *entityImpl) Pre(text, language string) Builder {
+	self.append(text, telegram.MessageEntity{Type: "pre", Language: language})
+	return self.Text("\n")
+}
+
+func (self *entityImpl) Link(text, url string) Builder {
+	return self.append(text, telegram.MessageEntity{Type: "text_link", URL: url})
+}
+
+func (self *entityImpl) Mention(text string, userId int64) Builder {
+	return self.append(text, telegram.MessageEntity{
+		Type: "text_mention",
+		User: &telegram.User{ID: userId},
+	})
+}
+
+func (self *entityImpl) String() string {
+	return self.builder.String()
+}
+
+func (self *entityImpl) Entities() []telegram.MessageEntity {
+	return self.entities
+}
+
+func (self *entityImpl) Config(chatId int64) telegram.MessageConfig {
+	return telegram.MessageConfig{
+		ChatID:   chatId,
+		Text:     self.String(),
+		Entities: self.entities,
+	}
+}
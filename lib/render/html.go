@@ -0,0 +1,82 @@
+package render
+
+import (
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/telegram"
+)
+
+type htmlImpl struct {
+	builder strings.Builder
+}
+
+func NewHTML() Builder {
+	return &htmlImpl{}
+}
+
+// EscapeHTML escapes text to appear as is in an HTML message.
+func EscapeHTML(text string) string {
+	return html.EscapeString(text)
+}
+
+func (self *htmlImpl) Text(text string) Builder {
+	self.builder.WriteString(EscapeHTML(text))
+	return self
+}
+
+func (self *htmlImpl) Line(text string) Builder {
+	self.builder.WriteString(EscapeHTML(text))
+	self.builder.WriteString("\n")
+	return self
+}
+
+func (self *htmlImpl) Bold(text string) Builder {
+	self.builder.WriteString("<b>" + EscapeHTML(text) + "</b>")
+	return self
+}
+
+func (self *htmlImpl) Italic(text string) Builder {
+	self.builder.WriteString("<i>" + EscapeHTML(text) + "</i>")
+	return self
+}
+
+func (self *htmlImpl) Code(text string) Builder {
+	self.builder.WriteString("<code>" + EscapeHTML(text) + "</code>")
+	return self
+}
+
+func (self *htmlImpl) Pre(text, language string) Builder {
+	if len(language) == 0 {
+		self.builder.WriteString("<pre>" + EscapeHTML(text) + "</pre>\n")
+	} else {
+		self.builder.WriteString(fmt.Sprintf(
+			"<pre><code class=\"language-%s\">%s</code></pre>\n",
+			EscapeHTML(language), EscapeHTML(text)))
+	}
+
+	return self
+}
+
+func (self *htmlImpl) Link(text, url string) Builder {
+	self.builder.WriteString(fmt.Sprintf("<a href=\"%s\">%s</a>",
+		EscapeHTML(url), EscapeHTML(text)))
+	return self
+}
+
+func (self *htmlImpl) Mention(text string, userId int64) Builder {
+	return self.Link(text, fmt.Sprintf("tg://user?id=%d", userId))
+}
+
+func (self *htmlImpl) String() string {
+	return self.builder.String()
+}
+
+func (self *htmlImpl) Config(chatId int64) telegram.MessageConfig {
+	return telegram.MessageConfig{
+		ChatID:    chatId,
+		Text:      self.String(),
+		ParseMode: telegram.ModeHTML,
+	}
+}
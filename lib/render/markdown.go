@@ -0,0 +1,91 @@
+package render
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/telegram"
+)
+
+var (
+	markdownV2Escaper = strings.NewReplacer(
+		"\\", "\\\\", "_", "\\_", "*", "\\*", "[", "\\[", "]", "\\]",
+		"(", "\\(", ")", "\\)", "~", "\\~", "`", "\\`", ">", "\\>",
+		"#", "\\#", "+", "\\+", "-", "\\-", "=", "\\=", "|", "\\|",
+		"{", "\\{", "}", "\\}", ".", "\\.", "!", "\\!",
+	)
+	markdownV2CodeEscaper = strings.NewReplacer("\\", "\\\\", "`", "\\`")
+	markdownV2LinkEscaper = strings.NewReplacer("\\", "\\\\", ")", "\\)")
+)
+
+type markdownV2Impl struct {
+	builder strings.Builder
+}
+
+func NewMarkdownV2() Builder {
+	return &markdownV2Impl{}
+}
+
+// EscapeMarkdownV2 escapes text to appear as is in a MarkdownV2 message.
+func EscapeMarkdownV2(text string) string {
+	return markdownV2Escaper.Replace(text)
+}
+
+func (self *markdownV2Impl) Text(text string) Builder {
+	self.builder.WriteString(EscapeMarkdownV2(text))
+	return self
+}
+
+func (self *markdownV2Impl) Line(text string) Builder {
+	self.builder.WriteString(EscapeMarkdownV2(text))
+	self.builder.WriteString("\n")
+	return self
+}
+
+func (self *markdownV2Impl) Bold(text string) Builder {
+	self.builder.WriteString("*" + EscapeMarkdownV2(text) + "*")
+	return self
+}
+
+func (self *markdownV2Impl) Italic(text string) Builder {
+	self.builder.WriteString("_" + EscapeMarkdownV2(text) + "_")
+	return self
+}
+
+func (self *markdownV2Impl) Code(text string) Builder {
+	self.builder.WriteString("`" + markdownV2CodeEscaper.Replace(text) + "`")
+	return self
+}
+
+func (self *markdownV2Impl) Pre(text, language string) Builder {
+	if !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+
+	self.builder.WriteString("```" + language + "\n")
+	self.builder.WriteString(markdownV2CodeEscaper.Replace(text))
+	self.builder.WriteString("```\n")
+	return self
+}
+
+func (self *markdownV2Impl) Link(text, url string) Builder {
+	self.builder.WriteString(fmt.Sprintf("[%s](%s)",
+		EscapeMarkdownV2(text), markdownV2LinkEscaper.Replace(url)))
+	return self
+}
+
+func (self *markdownV2Impl) Mention(text string, userId int64) Builder {
+	return self.Link(text, fmt.Sprintf("tg://user?id=%d", userId))
+}
+
+func (self *markdownV2Impl) String() string {
+	return self.builder.String()
+}
+
+func (self *markdownV2Impl) Config(chatId int64) telegram.MessageConfig {
+	return telegram.MessageConfig{
+		ChatID:    chatId,
+		Text:      self.String(),
+		ParseMode: telegram.ModeMarkdownV2,
+	}
+}
@@ -0,0 +1,41 @@
+package render
+
+import (
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/telegram"
+)
+
+// Builder builds a formatted message piece by piece, every piece is escaped
+// for the target format so that names, labels and logs never break it.
+type Builder interface {
+	// Text appends plain text.
+	Text(text string) Builder
+	// Line appends text followed by a newline.
+	Line(text string) Builder
+	Bold(text string) Builder
+	Italic(text string) Builder
+	Code(text string) Builder
+	// Pre appends a block of preformatted text, language may be empty.
+	Pre(text, language string) Builder
+	Link(text, url string) Builder
+	// Mention links text to the profile of a user without username.
+	Mention(text string, userId int64) Builder
+
+	// String returns the formatted text.
+	String() string
+	// Config returns the parameters to send the text to chatId.
+	Config(chatId int64) telegram.MessageConfig
+}
+
+// Format chooses the builder of a parse mode.
+func Format(parseMode string) Builder {
+	switch parseMode {
+	case telegram.ModeMarkdownV2:
+		return NewMarkdownV2()
+
+	case telegram.ModeHTML:
+		return NewHTML()
+
+	default:
+		return NewEntities()
+	}
+}
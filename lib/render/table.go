@@ -0,0 +1,249 @@
+package render
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/telegram"
+)
+
+const (
+	// DefaultTableWidth fits a monospace line on most phone screens.
+	DefaultTableWidth = 42
+	// DefaultPageSize is the number of rows of each page.
+	DefaultPageSize = 20
+
+	columnSeparator = "  "
+	minColumnWidth  = 4
+	ellipsis        = "…"
+)
+
+// Column describes a column of a Table.
+type Column struct {
+	// Title is shown in the header, like the columns of kubectl.
+	Title string
+	// MaxWidth truncates the cells when the table isn't wide, 0 means the
+	// column only shrinks to fit Table.Width.
+	MaxWidth int
+	// Wide columns are only shown in wide mode.
+	Wide bool
+	// AlignRight aligns numbers and durations to the right.
+	AlignRight bool
+}
+
+// Table renders rows in aligned columns inside a pre block, split into pages
+// navigated with inline buttons when it has too many rows.
+type Table struct {
+	Columns []Column
+	Rows    [][]string
+	// Wide shows every column without truncating the cells.
+	Wide bool
+	// Width bounds the length of a line when the table isn't wide, default
+	// to DefaultTableWidth.
+	Width int
+	// PageSize is the number of rows of each page, default to
+	// DefaultPageSize.
+	PageSize int
+}
+
+// Pages returns the number of pages of the table.
+func (self Table) Pages() int {
+	pageSize := self.pageSize()
+
+	if len(self.Rows) == 0 {
+		return 1
+	}
+
+	return (len(self.Rows) + pageSize - 1) / pageSize
+}
+
+// Lines renders the header and the rows of page, starting at 0.
+func (self Table) Lines(page int) []string {
+	columns := self.visibleColumns()
+	widths := self.widths(columns)
+	lines := make([]string, 0, self.pageSize()+1)
+
+	header := make([]string, len(columns))
+	for i, column := range columns {
+		header[i] = self.Columns[column].Title
+	}
+
+	lines = append(lines, self.line(columns, widths, header))
+
+	start := page * self.pageSize()
+	end := start + self.pageSize()
+
+	if start > len(self.Rows) {
+		start = len(self.Rows)
+	}
+
+	if end > len(self.Rows) {
+		end = len(self.Rows)
+	}
+
+	for _, row := range self.Rows[start:end] {
+		lines = append(lines, self.line(columns, widths, row))
+	}
+
+	return lines
+}
+
+// Render appends page, starting at 0, to builder as a pre block followed by
+// the page number when there are several pages.
+func (self Table) Render(builder Builder, page int) Builder {
+	builder.Pre(strings.Join(self.Lines(page), "\n"), "")
+
+	if pages := self.Pages(); pages > 1 {
+		builder.Italic(fmt.Sprintf("Page %d/%d, %d rows", page+1, pages, len(self.Rows)))
+		builder.Text("\n")
+	}
+
+	return builder
+}
+
+// Config returns the message showing page of the table in HTML, with the
+// navigation buttons when the table has several pages.
+func (self Table) Config(chatId int64, page int, callbackData func(page int) string) telegram.MessageConfig {
+	config := self.Render(NewHTML(), page).Config(chatId)
+
+	if keyboard := self.Keyboard(page, callbackData); keyboard != nil {
+		config.ReplyMarkup = keyboard
+	}
+
+	return config
+}
+
+// Keyboard returns the buttons navigating from page to its neighbours, or
+// nil when the table has one page. callbackData encodes the page a button
+// leads to.
+func (self Table) Keyboard(page int, callbackData func(page int) string) *telegram.InlineKeyboardMarkup {
+	pages := self.Pages()
+	if pages <= 1 {
+		return nil
+	}
+
+	row := make([]telegram.InlineKeyboardButton, 0, 3)
+	button := func(text string, page int) telegram.InlineKeyboardButton {
+		data := callbackData(page)
+		return telegram.InlineKeyboardButton{Text: text, CallbackData: &data}
+	}
+
+	if page > 0 {
+		row = append(row, button("« Prev", page-1))
+	}
+
+	row = append(row, button(fmt.Sprintf("%d/%d", page+1, pages), page))
+
+	if page < pages-1 {
+		row = append(row, button("Next »", page+1))
+	}
+
+	return &telegram.InlineKeyboardMarkup{
+		InlineKeyboard: [][]telegram.InlineKeyboardButton{row},
+	}
+}
+
+func (self Table) pageSize() int {
+	if self.PageSize <= 0 {
+		return DefaultPageSize
+	}
+
+	return self.PageSize
+}
+
+func (self Table) visibleColumns() []int {
+	columns := make([]int, 0, len(self.Columns))
+
+	for i, column := range self.Columns {
+		if self.Wide || !column.Wide {
+			columns = append(columns, i)
+		}
+	}
+
+	return columns
+}
+
+// widths computes the width of the visible columns. In narrow mode the
+// columns are capped by their MaxWidth, then the widest ones shrink until a
+// line fits in Width.
+func (self Table) widths(columns []int) []int {
+	widths := make([]int, len(columns))
+
+	for i, column := range columns {
+		widths[i] = utf8.RuneCountInString(self.Columns[column].Title)
+
+		for _, row := range self.Rows {
+			if column < len(row) && utf8.RuneCountInString(row[column]) > widths[i] {
+				widths[i] = utf8.RuneCountInString(row[column])
+			}
+		}
+
+		if maxWidth := self.Columns[column].MaxWidth; !self.Wide && maxWidth > 0 && widths[i] > maxWidth {
+			widths[i] = maxWidth
+		}
+	}
+
+	if self.Wide {
+		return widths
+	}
+
+	width := self.Width
+	if width <= 0 {
+		width = DefaultTableWidth
+	}
+
+	for {
+		total := len(columnSeparator) * (len(widths) - 1)
+		widest := 0
+
+		for i, columnWidth := range widths {
+			total += columnWidth
+
+			if columnWidth > widths[widest] {
+				widest = i
+			}
+		}
+
+		if total <= width || widths[widest] <= minColumnWidth {
+			return widths
+		}
+
+		widths[widest]--
+	}
+}
+
+func (self Table) line(columns []int, widths []int, row []string) string {
+	cells := make([]string, len(columns))
+
+	for i, column := range columns {
+		cell := ""
+		if column < len(row) {
+			cell = ellipsize(row[column], widths[i])
+		}
+
+		padding := strings.Repeat(" ", widths[i]-utf8.RuneCountInString(cell))
+
+		if self.Columns[column].AlignRight {
+			cells[i] = padding + cell
+		} else {
+			cells[i] = cell + padding
+		}
+	}
+
+	return strings.TrimRight(strings.Join(cells, columnSeparator), " ")
+}
+
+// ellipsize cuts text to width characters, ending with an ellipsis when it
+// was cut.
+func ellipsize(text string, width int) string {
+	if utf8.RuneCountInString(text) <= width {
+		return text
+	}
+
+	if width <= 1 {
+		return string([]rune(text)[:width])
+	}
+
+	return string([]rune(text)[:width-1]) + ellipsis
+}
@@ -0,0 +1,151 @@
+package state
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+type memoryEntry struct {
+	value    []byte
+	deadline time.Time
+}
+
+type memoryImpl struct {
+	mutex   sync.Mutex
+	entries map[string]memoryEntry
+	sets    map[string]map[string]bool
+}
+
+func NewMemoryStore() Store {
+	return &memoryImpl{}
+}
+
+func (self *memoryImpl) Init() error {
+	self.entries = make(map[string]memoryEntry)
+	self.sets = make(map[string]map[string]bool)
+	return nil
+}
+
+func (self *memoryImpl) Deinit() error {
+	return nil
+}
+
+func (self *memoryImpl) Get(key string, value interface{}) (bool, error) {
+	self.mutex.Lock()
+	entry, ok := self.entries[key]
+
+	if ok && !entry.deadline.IsZero() && time.Now().After(entry.deadline) {
+		delete(self.entries, key)
+		ok = false
+	}
+	self.mutex.Unlock()
+
+	if !ok {
+		return false, nil
+	}
+
+	return true, json.Unmarshal(entry.value, value)
+}
+
+func (self *memoryImpl) Set(key string, value interface{}, ttl time.Duration) error {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	entry := memoryEntry{value: encoded}
+	if ttl > 0 {
+		entry.deadline = time.Now().Add(ttl)
+	}
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	self.entries[key] = entry
+	return nil
+}
+
+func (self *memoryImpl) Delete(key string) error {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	delete(self.entries, key)
+	return nil
+}
+
+func (self *memoryImpl) Shared() bool {
+	return false
+}
+
+func (self *memoryImpl) Lock(key, owner string, ttl time.Duration) (bool, error) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	entry, ok := self.entries[key]
+	if ok && (entry.deadline.IsZero() || time.Now().Before(entry.deadline)) &&
+		string(entry.value) != owner {
+		return false, nil
+	}
+
+	self.entries[key] = memoryEntry{value: []byte(owner), deadline: time.Now().Add(ttl)}
+	return true, nil
+}
+
+func (self *memoryImpl) Unlock(key, owner string) error {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	if entry, ok := self.entries[key]; ok && string(entry.value) == owner {
+		delete(self.entries, key)
+	}
+
+	return nil
+}
+
+func (self *memoryImpl) Add(key, member string) (bool, error) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	set, ok := self.sets[key]
+	if !ok {
+		set = make(map[string]bool)
+		self.sets[key] = set
+	}
+
+	if set[member] {
+		return false, nil
+	}
+
+	set[member] = true
+	return true, nil
+}
+
+func (self *memoryImpl) Remove(key, member string) (bool, error) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	set := self.sets[key]
+	if !set[member] {
+		return false, nil
+	}
+
+	delete(set, member)
+	if len(set) == 0 {
+		delete(self.sets, key)
+	}
+
+	return true, nil
+}
+
+func (self *memoryImpl) Members(key string) ([]string, error) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	members := make([]string, 0, len(self.sets[key]))
+	for member := range self.sets[key] {
+		members = append(members, member)
+	}
+
+	return members, nil
+}
@@ -0,0 +1,112 @@
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// lockScript takes a lock unless another owner holds it, the owner taking it
+// again only extends its ttl.
+var lockScript = redis.NewScript(`
+local owner = redis.call("GET", KEYS[1])
+if owner == false or owner == ARGV[1] then
+	redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2])
+	return 1
+end
+return 0
+`)
+
+// unlockScript releases a lock only if its owner asks for it.
+var unlockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+type redisImpl struct {
+	url    string
+	client *redis.Client
+}
+
+func NewRedisStore(url string) Store {
+	return &redisImpl{url: url}
+}
+
+func (self *redisImpl) Init() error {
+	options, err := redis.ParseURL(self.url)
+	if err != nil {
+		return err
+	}
+
+	self.client = redis.NewClient(options)
+	return nil
+}
+
+func (self *redisImpl) Deinit() error {
+	if self.client == nil {
+		return nil
+	}
+
+	return self.client.Close()
+}
+
+func (self *redisImpl) Get(key string, value interface{}) (bool, error) {
+	encoded, err := self.client.Get(context.Background(), key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	return true, json.Unmarshal(encoded, value)
+}
+
+func (self *redisImpl) Set(key string, value interface{}, ttl time.Duration) error {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	return self.client.Set(context.Background(), key, encoded, ttl).Err()
+}
+
+func (self *redisImpl) Delete(key string) error {
+	return self.client.Del(context.Background(), key).Err()
+}
+
+func (self *redisImpl) Shared() bool {
+	return true
+}
+
+func (self *redisImpl) Lock(key, owner string, ttl time.Duration) (bool, error) {
+	taken, err := lockScript.Run(context.Background(), self.client,
+		[]string{key}, owner, ttl.Milliseconds()).Int()
+	if err != nil {
+		return false, err
+	}
+
+	return taken == 1, nil
+}
+
+func (self *redisImpl) Unlock(key, owner string) error {
+	return unlockScript.Run(context.Background(), self.client, []string{key}, owner).Err()
+}
+
+func (self *redisImpl) Add(key, member string) (bool, error) {
+	added, err := self.client.SAdd(context.Background(), key, member).Result()
+	return added == 1, err
+}
+
+func (self *redisImpl) Remove(key, member string) (bool, error) {
+	removed, err := self.client.SRem(context.Background(), key, member).Result()
+	return removed == 1, err
+}
+
+func (self *redisImpl) Members(key string) ([]string, error) {
+	return self.client.SMembers(context.Background(), key).Result()
+}
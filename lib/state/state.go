@@ -0,0 +1,52 @@
+package state
+
+import (
+	"os"
+	"time"
+
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/container"
+)
+
+// Store keeps the state shared by the requests of the bot, such as the
+// pending confirmations. Values are encoded as JSON.
+type Store interface {
+	container.Module
+
+	// Get decodes the value of key into value, it returns false if the key
+	// doesn't exist or has expired.
+	Get(key string, value interface{}) (bool, error)
+	// Set stores value under key, a zero ttl keeps it forever.
+	Set(key string, value interface{}, ttl time.Duration) error
+	// Delete removes key, deleting a missing key isn't an error.
+	Delete(key string) error
+
+	// Shared tells if every instance of the bot sees the same store, the
+	// work handed over between instances needs it.
+	Shared() bool
+
+	// Lock takes key for owner during ttl and returns false when another
+	// owner holds it, locking it again as owner extends the ttl.
+	Lock(key, owner string, ttl time.Duration) (bool, error)
+	// Unlock releases key if owner holds it.
+	Unlock(key, owner string) error
+
+	// Add inserts member into the set key, it returns false when member was
+	// already there.
+	Add(key, member string) (bool, error)
+	// Remove takes member out of the set key, it returns false when member
+	// wasn't there.
+	Remove(key, member string) (bool, error)
+	// Members lists the set key in no particular order.
+	Members(key string) ([]string, error)
+}
+
+// NewStore creates the store configured by the environment: Redis when
+// REDIS_URL is set, otherwise a store in memory which is only shared by the
+// requests served by the same instance.
+func NewStore() Store {
+	if url := os.Getenv("REDIS_URL"); len(url) > 0 {
+		return NewRedisStore(url)
+	}
+
+	return NewMemoryStore()
+}
@@ -0,0 +1,29 @@
+package telegram
+
+// CallbackConfig contains the parameters of an answerCallbackQuery call.
+type CallbackConfig struct {
+	// CallbackQueryID is the identifier of the query to be answered.
+	CallbackQueryID string `json:"callback_query_id"`
+	// Text of the notification, 0-200 characters. If empty, nothing is
+	// shown to the user.
+	//
+	// optional
+	Text string `json:"text,omitempty"`
+	// ShowAlert shows an alert instead of a notification at the top of the
+	// chat screen.
+	//
+	// optional
+	ShowAlert bool `json:"show_alert,omitempty"`
+	// URL opened by the client of the user.
+	//
+	// optional
+	URL string `json:"url,omitempty"`
+	// CacheTime is how many seconds the result may be cached client-side.
+	//
+	// optional
+	CacheTime int `json:"cache_time,omitempty"`
+}
+
+func (self *telegramImpl) AnswerCallbackQuery(config CallbackConfig) error {
+	return self.request("answerCallbackQuery", config, nil)
+}
@@ -0,0 +1,75 @@
+package telegram
+
+import (
+	"errors"
+)
+
+// Types of BotCommandScope, commands of a narrower scope override the
+// commands of a wider one for the users covered by both.
+const (
+	ScopeDefault               = "default"
+	ScopeAllPrivateChats       = "all_private_chats"
+	ScopeAllGroupChats         = "all_group_chats"
+	ScopeAllChatAdministrators = "all_chat_administrators"
+	ScopeChat                  = "chat"
+	ScopeChatAdministrators    = "chat_administrators"
+	ScopeChatMember            = "chat_member"
+)
+
+// CommandsConfig contains the parameters of a setMyCommands call.
+type CommandsConfig struct {
+	// Commands is the list of commands, at most 100 items.
+	Commands []BotCommand `json:"commands"`
+	// Scope describes the users for whom the commands are relevant, default
+	// to BotCommandScope with type ScopeDefault.
+	//
+	// optional
+	Scope *BotCommandScope `json:"scope,omitempty"`
+	// LanguageCode is a two-letter ISO 639-1 code. If empty, the commands
+	// apply to all users from the scope which have no dedicated commands for
+	// their language.
+	//
+	// optional
+	LanguageCode string `json:"language_code,omitempty"`
+}
+
+func (self *telegramImpl) SetMyCommands(config CommandsConfig) error {
+	if len(config.Commands) == 0 {
+		return errors.New("list of commands must not be empty, use DeleteMyCommands instead")
+	}
+
+	return self.request("setMyCommands", config, nil)
+}
+
+func (self *telegramImpl) DeleteMyCommands(scope *BotCommandScope, languageCode string) error {
+	return self.request("deleteMyCommands", CommandsConfig{
+		Scope:        scope,
+		LanguageCode: languageCode,
+	}, nil)
+}
+
+func (self *telegramImpl) SetChatMenuButton(chatId int64, button MenuButton) error {
+	params := map[string]interface{}{
+		"menu_button": button,
+	}
+
+	if chatId != 0 {
+		params["chat_id"] = chatId
+	}
+
+	return self.request("setChatMenuButton", params, nil)
+}
+
+func (self *telegramImpl) GetChatMember(chatId, userId int64) (*ChatMember, error) {
+	member := &ChatMember{}
+
+	err := self.request("getChatMember", map[string]int64{
+		"chat_id": chatId,
+		"user_id": userId,
+	}, member)
+	if err != nil {
+		return nil, err
+	}
+
+	return member, nil
+}
@@ -0,0 +1,62 @@
+package telegram
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+)
+
+func (self *telegramImpl) GetFile(fileId string) (*File, error) {
+	file := &File{}
+
+	err := self.request("getFile", map[string]string{"file_id": fileId}, file)
+	if err != nil {
+		return nil, err
+	}
+
+	return file, nil
+}
+
+// DownloadFile fetches the content of file, which must come from GetFile.
+// Files larger than limit bytes are rejected, a zero limit disables the
+// check.
+func (self *telegramImpl) DownloadFile(file *File, limit int64) ([]byte, error) {
+	if len(file.FilePath) == 0 {
+		return nil, fmt.Errorf("File %s has no path, please call GetFile first", file.FileID)
+	}
+
+	if limit > 0 && int64(file.FileSize) > limit {
+		return nil, fmt.Errorf("File %s is larger than %d bytes", file.FileID, limit)
+	}
+
+	resp, err := http.Get(file.Link(self.token))
+	if err != nil {
+		return nil, err
+	}
+	defer func(body io.ReadCloser) {
+		if err := body.Close(); err != nil {
+			log.Println("failed to close response body")
+		}
+	}(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Status %q while downloading %s", resp.Status, file.FileID)
+	}
+
+	reader := io.Reader(resp.Body)
+	if limit > 0 {
+		reader = io.LimitReader(resp.Body, limit+1)
+	}
+
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	if limit > 0 && int64(len(content)) > limit {
+		return nil, fmt.Errorf("File %s is larger than %d bytes", file.FileID, limit)
+	}
+
+	return content, nil
+}
@@ -0,0 +1,90 @@
+package telegram
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// Errors returned by the Telegram API which callers usually handle, they are
+// matched by errors.Is against the Error returned by the client:
+//
+//	if errors.Is(err, telegram.ErrBotBlocked) {
+//		// unsubscribe the chat
+//	}
+//
+// Use errors.As to access the code, the description and the parameters:
+//
+//	var apiErr telegram.Error
+//	if errors.As(err, &apiErr) {
+//		time.Sleep(time.Duration(apiErr.RetryAfter) * time.Second)
+//	}
+var (
+	ErrUnauthorized       = errors.New("bot token is invalid")
+	ErrBotBlocked         = errors.New("bot was blocked or kicked from the chat")
+	ErrChatNotFound       = errors.New("chat not found")
+	ErrMessageTooLong     = errors.New("message is too long")
+	ErrMessageNotModified = errors.New("message is not modified")
+	ErrTooManyRequests    = errors.New("too many requests")
+	ErrChatMigrated       = errors.New("group chat was upgraded to a supergroup")
+)
+
+func newError(resp *APIResponse, status string) Error {
+	err := Error{
+		Code:    resp.ErrorCode,
+		Message: resp.Description,
+	}
+
+	if len(err.Message) == 0 {
+		err.Message = status
+	}
+
+	if resp.Parameters != nil {
+		err.ResponseParameters = *resp.Parameters
+	}
+
+	return err
+}
+
+// Is reports whether the error matches one of the Err* errors.
+func (e Error) Is(target error) bool {
+	description := strings.ToLower(e.Message)
+
+	switch target {
+	case ErrUnauthorized:
+		return e.Code == http.StatusUnauthorized
+
+	case ErrBotBlocked:
+		// A 403 also reports missing rights, e.g. "not enough rights to
+		// send text messages to the chat", while the bot is still there
+		return e.Code == http.StatusForbidden && containsAny(description,
+			"blocked", "kicked", "deactivated", "not a member", "can't initiate")
+
+	case ErrChatNotFound:
+		return strings.Contains(description, "chat not found")
+
+	case ErrMessageTooLong:
+		return strings.Contains(description, "too long")
+
+	case ErrMessageNotModified:
+		return strings.Contains(description, "message is not modified")
+
+	case ErrTooManyRequests:
+		return e.Code == http.StatusTooManyRequests || e.RetryAfter > 0
+
+	case ErrChatMigrated:
+		return e.MigrateToChatID != 0
+	}
+
+	return false
+}
+
+func containsAny(text string, parts ...string) bool {
+	for _, part := range parts {
+		if strings.Contains(text, part) {
+			return true
+		}
+	}
+
+	return false
+}
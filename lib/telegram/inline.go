@@ -0,0 +1,49 @@
+package telegram
+
+import (
+	"errors"
+)
+
+// InlineConfig contains the parameters of an answerInlineQuery call.
+type InlineConfig struct {
+	// InlineQueryID is the identifier of the answered query.
+	InlineQueryID string `json:"inline_query_id"`
+	// Results are InlineQueryResult* values, at most 50.
+	Results []interface{} `json:"results"`
+	// CacheTime is how many seconds the result may be cached on the server,
+	// default to 300.
+	//
+	// optional
+	CacheTime int `json:"cache_time"`
+	// IsPersonal caches the results only for the user who sent the query.
+	//
+	// optional
+	IsPersonal bool `json:"is_personal,omitempty"`
+	// NextOffset is sent back by the client to get more results, empty
+	// when there are no more results.
+	//
+	// optional
+	NextOffset string `json:"next_offset,omitempty"`
+	// SwitchPMText shows a button switching to the private chat with the
+	// bot above the results.
+	//
+	// optional
+	SwitchPMText string `json:"switch_pm_text,omitempty"`
+	// SwitchPMParameter is the deep-linking parameter of /start sent when
+	// the user presses the switch button.
+	//
+	// optional
+	SwitchPMParameter string `json:"switch_pm_parameter,omitempty"`
+}
+
+func (self *telegramImpl) AnswerInlineQuery(config InlineConfig) error {
+	if len(config.Results) > 50 {
+		return errors.New("an inline query can't have more than 50 results")
+	}
+
+	if config.Results == nil {
+		config.Results = []interface{}{}
+	}
+
+	return self.request("answerInlineQuery", config, nil)
+}
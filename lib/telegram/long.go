@@ -0,0 +1,557 @@
+package telegram
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// DefaultDocumentThreshold is the length above which SendLongMessage uploads
+// the text as a document instead of splitting it into several messages.
+const DefaultDocumentThreshold = 4 * MaxMessageLength
+
+// partHeaderLength is reserved in every part for the "Part i/n" header.
+const partHeaderLength = 16
+
+var htmlTagPattern = regexp.MustCompile(`<(/?)([a-zA-Z0-9-]+)[^>]*>`)
+
+// LongMessageConfig contains the parameters of SendLongMessage.
+type LongMessageConfig struct {
+	MessageConfig
+	// MaxLength is the maximum length of each part, default to
+	// MaxMessageLength.
+	//
+	// optional
+	MaxLength int
+	// DocumentThreshold is the length above which the text is uploaded as a
+	// document, default to DefaultDocumentThreshold. A negative value always
+	// splits the text.
+	//
+	// optional
+	DocumentThreshold int
+	// FileName is the name of the uploaded document, default to output.txt.
+	//
+	// optional
+	FileName string
+	// Document is the content of the uploaded document, default to Text.
+	// Use it to upload the plain output when Text carries markup.
+	//
+	// optional
+	Document string
+	// Caption of the uploaded document.
+	//
+	// optional
+	Caption string
+}
+
+// markdownV2Markers are the delimiters of the inline entities of MarkdownV2,
+// the two characters ones first.
+var markdownV2Markers = []string{"__", "||", "*", "_", "~"}
+
+// blockState tracks the formatting blocks left open at the end of a part, so
+// that they can be closed there and reopened at the start of the next one.
+// With MarkdownV2 the inline entities, e.g. bold, are tracked as well.
+type blockState struct {
+	parseMode string
+	open      []string
+}
+
+// SendLongMessage sends a text of any length. A text longer than MaxLength is
+// split on line boundaries into numbered parts, keeping pre and code blocks
+// balanced in each part, or uploaded as a .txt document when it's longer than
+// DocumentThreshold. Entities can't be split, so a long text with entities is
+// always uploaded.
+func (self *telegramImpl) SendLongMessage(config LongMessageConfig) ([]*Message, error) {
+	if config.MaxLength <= 0 || config.MaxLength > MaxMessageLength {
+		config.MaxLength = MaxMessageLength
+	}
+
+	if config.DocumentThreshold == 0 {
+		config.DocumentThreshold = DefaultDocumentThreshold
+	}
+
+	length := utf8.RuneCountInString(config.Text)
+
+	if length <= config.MaxLength {
+		message, err := self.SendMessage(config.MessageConfig)
+		if err != nil {
+			return nil, err
+		}
+
+		return []*Message{message}, nil
+	}
+
+	if (config.DocumentThreshold > 0 && length > config.DocumentThreshold) ||
+		len(config.Entities) > 0 {
+		message, err := self.sendAsDocument(config)
+		if err != nil {
+			return nil, err
+		}
+
+		return []*Message{message}, nil
+	}
+
+	parts := SplitMessage(config.Text, config.ParseMode,
+		config.MaxLength-partHeaderLength)
+	messages := make([]*Message, 0, len(parts))
+
+	for i, part := range parts {
+		partConfig := config.MessageConfig
+		partConfig.Text = fmt.Sprintf("Part %d/%d\n%s", i+1, len(parts), part)
+
+		// Only the first part replies and only the last one has the keyboard
+		if i > 0 {
+			partConfig.ReplyToMessageID = 0
+		}
+
+		if i < len(parts)-1 {
+			partConfig.ReplyMarkup = nil
+		}
+
+		message, err := self.SendMessage(partConfig)
+		if err != nil {
+			return messages, err
+		}
+
+		messages = append(messages, message)
+	}
+
+	return messages, nil
+}
+
+func (self *telegramImpl) sendAsDocument(config LongMessageConfig) (*Message, error) {
+	content := config.Document
+	if len(content) == 0 {
+		content = config.Text
+	}
+
+	fileName := config.FileName
+	if len(fileName) == 0 {
+		fileName = "output.txt"
+	}
+
+	return self.SendDocument(DocumentConfig{
+		ChatID: config.ChatID,
+		Document: InputFile{
+			Name:   fileName,
+			Reader: strings.NewReader(content),
+		},
+		Caption:             config.Caption,
+		DisableNotification: config.DisableNotification,
+		ReplyToMessageID:    config.ReplyToMessageID,
+		ReplyMarkup:         config.ReplyMarkup,
+	})
+}
+
+// SplitMessage splits text into parts of at most maxLength characters. Lines
+// are kept whole unless a single line is longer than maxLength, and the code
+// blocks of Markdown, the entities of MarkdownV2 or the tags of HTML opened
+// in a part are closed at its end and reopened at the start of the next
+// part.
+func SplitMessage(text, parseMode string, maxLength int) []string {
+	parts := make([]string, 0)
+	state := blockState{parseMode: parseMode}
+	current := strings.Builder{}
+	currentLength := 0
+	openingLength := 0
+
+	flush := func() {
+		closing := state.closing()
+
+		if state.fenced() && !strings.HasSuffix(current.String(), "\n") {
+			current.WriteString("\n")
+		}
+
+		current.WriteString(closing)
+		parts = append(parts, current.String())
+		current.Reset()
+
+		opening := state.opening()
+		current.WriteString(opening)
+		currentLength = utf8.RuneCountInString(opening)
+		openingLength = currentLength
+	}
+
+	for _, line := range strings.SplitAfter(text, "\n") {
+		for len(line) > 0 {
+			// The previous part already closed the blocks this line closes,
+			// reopening them would leave an empty part
+			if len(parts) > 0 && len(state.open) > 0 && currentLength == openingLength &&
+				strings.TrimSpace(line) == state.closing() {
+				state = blockState{parseMode: parseMode}
+				current.Reset()
+				currentLength = 0
+				openingLength = 0
+				break
+			}
+
+			next := state.next(line)
+			need := utf8.RuneCountInString(line) + next.closingLength()
+
+			if currentLength+need <= maxLength {
+				current.WriteString(line)
+				currentLength += utf8.RuneCountInString(line)
+				state = next
+				break
+			}
+
+			if currentLength > openingLength {
+				flush()
+				continue
+			}
+
+			// The line doesn't fit even in an empty part, cut it
+			size := maxLength - currentLength - state.closingLength()
+			head, tail := cutLine(line, parseMode, size)
+
+			// The blocks opened by the head are closed in this part too, and
+			// a tail only closing them would leave an empty part
+			for size > 1 && (currentLength+utf8.RuneCountInString(head)+
+				state.next(head).closingLength() > maxLength ||
+				strings.TrimSuffix(tail, "\n") == state.next(head).closing()) {
+				size--
+				head, tail = cutLine(line, parseMode, size)
+			}
+
+			current.WriteString(head)
+			currentLength += utf8.RuneCountInString(head)
+			state = state.next(head)
+			line = tail
+
+			// The newline preceding the closing fence ends the line already
+			if line == "\n" && state.fenced() {
+				line = ""
+			}
+
+			flush()
+		}
+	}
+
+	if currentLength > openingLength {
+		flush()
+	}
+
+	return parts
+}
+
+// cutLine cuts line after at most size characters, without breaking the
+// tags and the character references of HTML, nor the escapes, the links and
+// the delimiters of MarkdownV2.
+func cutLine(line, parseMode string, size int) (string, string) {
+	if size < 1 {
+		size = 1
+	}
+
+	runes := []rune(line)
+	if len(runes) <= size {
+		return line, ""
+	}
+
+	head := string(runes[:size])
+
+	if parseMode == ModeHTML {
+		lastTag := strings.LastIndex(head, "<")
+		lastRef := strings.LastIndex(head, "&")
+
+		switch {
+		case lastTag >= 0 && lastTag > strings.LastIndex(head, ">"):
+			head = cutBefore(line, head, lastTag, ">")
+
+		case lastRef >= 0 && lastRef > strings.LastIndex(head, ";"):
+			head = cutBefore(line, head, lastRef, ";")
+		}
+	}
+
+	if parseMode == ModeMarkdownV2 {
+		head = cutMarkdownV2(head, line[len(head):])
+	}
+
+	return head, line[len(head):]
+}
+
+// cutBefore cuts head before the tag or the character reference starting at
+// index, or after its end when it starts the line since the cut has to move
+// forward.
+func cutBefore(line, head string, index int, end string) string {
+	if index > 0 {
+		return head[:index]
+	}
+
+	if last := strings.Index(line, end); last >= 0 {
+		return line[:last+len(end)]
+	}
+
+	return line
+}
+
+// cutMarkdownV2 shortens head so that it doesn't end inside an escape, a
+// link or a delimiter of two characters continued by tail.
+func cutMarkdownV2(head, tail string) string {
+	if link := lastUnescaped(head, '['); link > 0 && link > lastUnescaped(head, ')') {
+		return head[:link]
+	}
+
+	for len(head) > 1 {
+		last := head[len(head)-1]
+
+		switch {
+		// A backslash escapes the first character of tail
+		case last == '\\' && !escaped(head, len(head)-1):
+			head = head[:len(head)-1]
+
+		case strings.IndexByte("_|`", last) >= 0 && len(tail) > 0 && tail[0] == last &&
+			!escaped(head, len(head)-1):
+			tail = head[len(head)-1:] + tail
+			head = head[:len(head)-1]
+
+		default:
+			return head
+		}
+	}
+
+	return head
+}
+
+// escaped tells if the character of text at index is escaped by a backslash.
+func escaped(text string, index int) bool {
+	count := 0
+
+	for index > 0 && text[index-1] == '\\' {
+		count++
+		index--
+	}
+
+	return count%2 == 1
+}
+
+func lastUnescaped(text string, char byte) int {
+	for i := len(text) - 1; i >= 0; i-- {
+		if text[i] == char && !escaped(text, i) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func (self blockState) next(line string) blockState {
+	open := make([]string, len(self.open))
+	copy(open, self.open)
+
+	switch self.parseMode {
+	case ModeMarkdownV2:
+		open = nextMarkdownV2(open, line)
+
+	case ModeMarkdown:
+		if strings.Count(line, "```")%2 == 0 {
+			break
+		}
+
+		if len(open) == 0 {
+			fence := strings.TrimSpace(line)
+			open = append(open, fence[strings.Index(fence, "```"):])
+		} else {
+			open = open[:0]
+		}
+
+	case ModeHTML:
+		for _, match := range htmlTagPattern.FindAllStringSubmatch(line, -1) {
+			if len(match[1]) == 0 {
+				open = append(open, match[0])
+				continue
+			}
+
+			for i := len(open) - 1; i >= 0; i-- {
+				if tagName(open[i]) == match[2] {
+					open = append(open[:i], open[i+1:]...)
+					break
+				}
+			}
+		}
+	}
+
+	return blockState{parseMode: self.parseMode, open: open}
+}
+
+// nextMarkdownV2 follows the entities of MarkdownV2 opened and closed by
+// line, the pre blocks are kept with their language and the escaped
+// characters are skipped.
+func nextMarkdownV2(open []string, line string) []string {
+	for i := 0; i < len(line); {
+		top := ""
+		if len(open) > 0 {
+			top = open[len(open)-1]
+		}
+
+		switch {
+		case line[i] == '\\':
+			i += 2
+
+		case strings.HasPrefix(top, "```"):
+			if strings.HasPrefix(line[i:], "```") {
+				open = open[:len(open)-1]
+				i += 3
+			} else {
+				i++
+			}
+
+		case top == "`":
+			if line[i] == '`' {
+				open = open[:len(open)-1]
+			}
+			i++
+
+		case strings.HasPrefix(line[i:], "```"):
+			// The language runs until the end of the line
+			rest := strings.TrimRight(line[i+3:], "\n")
+
+			if strings.Contains(rest, "```") || strings.ContainsAny(rest, " \t") {
+				open = append(open, "```")
+				i += 3
+			} else {
+				open = append(open, "```"+rest)
+				i += 3 + len(rest)
+			}
+
+		case line[i] == '`':
+			open = append(open, "`")
+			i++
+
+		case strings.HasPrefix(line[i:], "]("):
+			// The URL of a link holds no entity
+			i += 2
+			for i < len(line) && line[i] != ')' {
+				if line[i] == '\\' {
+					i++
+				}
+				i++
+			}
+
+		default:
+			marker := ""
+			for _, candidate := range markdownV2Markers {
+				if strings.HasPrefix(line[i:], candidate) {
+					marker = candidate
+					break
+				}
+			}
+
+			if len(marker) == 0 {
+				i++
+				continue
+			}
+
+			open = toggleMarker(open, marker)
+			i += len(marker)
+		}
+	}
+
+	return open
+}
+
+// toggleMarker closes the innermost entity of marker, or opens one.
+func toggleMarker(open []string, marker string) []string {
+	for i := len(open) - 1; i >= 0; i-- {
+		if open[i] == marker {
+			return append(open[:i], open[i+1:]...)
+		}
+	}
+
+	return append(open, marker)
+}
+
+func (self blockState) opening() string {
+	if len(self.open) == 0 {
+		return ""
+	}
+
+	switch self.parseMode {
+	case ModeHTML:
+		return strings.Join(self.open, "")
+
+	case ModeMarkdownV2:
+		opening := strings.Builder{}
+
+		for _, marker := range self.open {
+			opening.WriteString(marker)
+
+			if strings.HasPrefix(marker, "```") {
+				opening.WriteString("\n")
+			}
+		}
+
+		return opening.String()
+	}
+
+	return self.open[0] + "\n"
+}
+
+func (self blockState) closing() string {
+	if len(self.open) == 0 {
+		return ""
+	}
+
+	switch self.parseMode {
+	case ModeHTML:
+		closing := strings.Builder{}
+
+		for i := len(self.open) - 1; i >= 0; i-- {
+			closing.WriteString("</" + tagName(self.open[i]) + ">")
+		}
+
+		return closing.String()
+
+	case ModeMarkdownV2:
+		closing := strings.Builder{}
+
+		for i := len(self.open) - 1; i >= 0; i-- {
+			marker := self.open[i]
+			if strings.HasPrefix(marker, "```") {
+				marker = "```"
+			}
+
+			closing.WriteString(marker)
+		}
+
+		return closing.String()
+	}
+
+	return "```"
+}
+
+// fenced tells if a code block of Markdown is open, its closing fence goes
+// on a line of its own.
+func (self blockState) fenced() bool {
+	if self.parseMode == ModeHTML {
+		return false
+	}
+
+	for _, marker := range self.open {
+		if strings.HasPrefix(marker, "```") {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (self blockState) closingLength() int {
+	length := utf8.RuneCountInString(self.closing())
+
+	// One more character for the newline which may precede the closing fence
+	if self.fenced() {
+		length++
+	}
+
+	return length
+}
+
+func tagName(tag string) string {
+	match := htmlTagPattern.FindStringSubmatch(tag)
+	if match == nil {
+		return ""
+	}
+
+	return match[2]
+}
@@ -0,0 +1,212 @@
+package telegram
+
+import (
+	"reflect"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSplitMessage(t *testing.T) {
+	tests := []struct {
+		name      string
+		text      string
+		parseMode string
+		maxLength int
+		parts     []string
+	}{
+		{
+			name:      "short",
+			text:      "pods are running\n",
+			maxLength: 32,
+			parts:     []string{"pods are running\n"},
+		},
+		{
+			name:      "line longer than maxLength",
+			text:      "abcdefghijklmnopqrstuvwxyz",
+			maxLength: 10,
+			parts:     []string{"abcdefghij", "klmnopqrst", "uvwxyz"},
+		},
+		{
+			name:      "open pre block of Markdown",
+			text:      "```\nline one\nline two\nline three\n```\n",
+			parseMode: ModeMarkdown,
+			maxLength: 20,
+			parts: []string{
+				"```\nline one\n```",
+				"```\nline two\n```",
+				"```\nline three\n```\n",
+			},
+		},
+		{
+			name:      "open pre block of MarkdownV2",
+			text:      "```go\nline one\nline two\nline three\n```\n",
+			parseMode: ModeMarkdownV2,
+			maxLength: 20,
+			parts: []string{
+				"```go\nline one\n```",
+				"```go\nline two\n```",
+				"```go\nline three\n```",
+			},
+		},
+		{
+			name:      "open pre block of HTML",
+			text:      "<pre>line one\nline two\nline three</pre>\n",
+			parseMode: ModeHTML,
+			maxLength: 24,
+			parts: []string{
+				"<pre>line one\n</pre>",
+				"<pre>line two\n</pre>",
+				"<pre>line three</pre>\n",
+			},
+		},
+		{
+			name:      "entity of MarkdownV2 spanning a cut",
+			text:      "*bold one\nbold two*\n",
+			parseMode: ModeMarkdownV2,
+			maxLength: 12,
+			parts:     []string{"*bold one\n*", "*bold two*\n"},
+		},
+		{
+			name:      "delimiter of MarkdownV2 at the cut",
+			text:      "abcd__ef__",
+			parseMode: ModeMarkdownV2,
+			maxLength: 6,
+			parts:     []string{"abcd", "__ef__"},
+		},
+		{
+			name:      "escape of MarkdownV2 at the cut",
+			text:      "abcdefghi\\.jk",
+			parseMode: ModeMarkdownV2,
+			maxLength: 10,
+			parts:     []string{"abcdefghi", "\\.jk"},
+		},
+		{
+			name:      "tag of HTML spanning a cut",
+			text:      "<b>bold one\nbold two</b>\n",
+			parseMode: ModeHTML,
+			maxLength: 16,
+			parts:     []string{"<b>bold one\n</b>", "<b>bold two</b>\n"},
+		},
+		{
+			name:      "tag of HTML at the cut",
+			text:      "ab <b>cdefgh</b>",
+			parseMode: ModeHTML,
+			maxLength: 12,
+			parts:     []string{"ab <b>cd</b>", "<b>efgh</b>"},
+		},
+		{
+			name:      "character reference of HTML at the cut",
+			text:      "abc &amp; defghij",
+			parseMode: ModeHTML,
+			maxLength: 8,
+			parts:     []string{"abc ", "&amp; de", "fghij"},
+		},
+		{
+			name:      "unclosed tags of HTML",
+			text:      "<b>open\nnever closed\n",
+			parseMode: ModeHTML,
+			maxLength: 14,
+			parts:     []string{"<b>open\n</b>", "<b>never c</b>", "<b>losed\n</b>"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			parts := SplitMessage(test.text, test.parseMode, test.maxLength)
+
+			if !reflect.DeepEqual(parts, test.parts) {
+				t.Fatalf("Expect parts %q, got %q", test.parts, parts)
+			}
+
+			for _, part := range parts {
+				if utf8.RuneCountInString(part) > test.maxLength {
+					t.Errorf("Part %q is longer than %d", part, test.maxLength)
+				}
+			}
+		})
+	}
+}
+
+func TestCutLine(t *testing.T) {
+	tests := []struct {
+		name      string
+		line      string
+		parseMode string
+		size      int
+		head      string
+		tail      string
+	}{
+		{
+			name: "plain",
+			line: "abcdefgh",
+			size: 5,
+			head: "abcde",
+			tail: "fgh",
+		},
+		{
+			name: "multibyte",
+			line: "ñandú ñandú",
+			size: 5,
+			head: "ñandú",
+			tail: " ñandú",
+		},
+		{
+			name:      "escape of MarkdownV2",
+			line:      "abcdefgh\\.ijk",
+			parseMode: ModeMarkdownV2,
+			size:      9,
+			head:      "abcdefgh",
+			tail:      "\\.ijk",
+		},
+		{
+			name:      "escaped backslash of MarkdownV2",
+			line:      "abcdefg\\\\ijk",
+			parseMode: ModeMarkdownV2,
+			size:      9,
+			head:      "abcdefg\\\\",
+			tail:      "ijk",
+		},
+		{
+			name:      "link of MarkdownV2",
+			line:      "abcd [link](http://x.y/z) end",
+			parseMode: ModeMarkdownV2,
+			size:      8,
+			head:      "abcd ",
+			tail:      "[link](http://x.y/z) end",
+		},
+		{
+			name:      "tag of HTML",
+			line:      "ab <b>cdefgh</b>",
+			parseMode: ModeHTML,
+			size:      5,
+			head:      "ab ",
+			tail:      "<b>cdefgh</b>",
+		},
+		{
+			name:      "tag of HTML starting the line",
+			line:      "<code>abc</code>",
+			parseMode: ModeHTML,
+			size:      3,
+			head:      "<code>",
+			tail:      "abc</code>",
+		},
+		{
+			name:      "character reference of HTML",
+			line:      "abc &amp; def",
+			parseMode: ModeHTML,
+			size:      6,
+			head:      "abc ",
+			tail:      "&amp; def",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			head, tail := cutLine(test.line, test.parseMode, test.size)
+
+			if head != test.head || tail != test.tail {
+				t.Fatalf("Expect %q and %q, got %q and %q", test.head, test.tail, head, tail)
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package telegram
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// Parse modes of a formatted text.
+const (
+	ModeMarkdown   = "Markdown"
+	ModeMarkdownV2 = "MarkdownV2"
+	ModeHTML       = "HTML"
+)
+
+// MaxMessageLength is the maximum length of a text message after entities
+// parsing.
+const MaxMessageLength = 4096
+
+// MessageConfig contains the parameters of a sendMessage call.
+type MessageConfig struct {
+	// ChatID is the identifier of the target chat.
+	ChatID int64 `json:"chat_id"`
+	// Text of the message, 1-4096 characters after entities parsing.
+	Text string `json:"text"`
+	// ParseMode is one of the Mode* constants.
+	//
+	// optional
+	ParseMode string `json:"parse_mode,omitempty"`
+	// Entities appear in the text, used instead of ParseMode.
+	//
+	// optional
+	Entities []MessageEntity `json:"entities,omitempty"`
+	// DisableWebPagePreview disables link previews for links in this message.
+	//
+	// optional
+	DisableWebPagePreview bool `json:"disable_web_page_preview,omitempty"`
+	// DisableNotification sends the message silently.
+	//
+	// optional
+	DisableNotification bool `json:"disable_notification,omitempty"`
+	// ReplyToMessageID is the ID of the original message, if the message is
+	// a reply.
+	//
+	// optional
+	ReplyToMessageID int `json:"reply_to_message_id,omitempty"`
+	// ReplyMarkup is an InlineKeyboardMarkup, a ReplyKeyboardMarkup, a
+	// ReplyKeyboardRemove or a ForceReply.
+	//
+	// optional
+	ReplyMarkup interface{} `json:"reply_markup,omitempty"`
+}
+
+func (self *telegramImpl) SendMessage(config MessageConfig) (*Message, error) {
+	if len(config.Text) == 0 {
+		return nil, errors.New("message text must not be empty")
+	}
+
+	message := &Message{}
+
+	err := self.request("sendMessage", config, message)
+	if err != nil {
+		return nil, err
+	}
+
+	return message, nil
+}
+
+// EditMessageConfig contains the parameters of an editMessageText call.
+type EditMessageConfig struct {
+	// ChatID and MessageID identify a message sent by the bot.
+	//
+	// optional
+	ChatID int64 `json:"chat_id,omitempty"`
+	// optional
+	MessageID int `json:"message_id,omitempty"`
+	// InlineMessageID identifies a message sent via the bot in inline mode,
+	// used instead of ChatID and MessageID.
+	//
+	// optional
+	InlineMessageID string `json:"inline_message_id,omitempty"`
+	// Text is the new text of the message.
+	Text string `json:"text"`
+	// optional
+	ParseMode string `json:"parse_mode,omitempty"`
+	// optional
+	Entities []MessageEntity `json:"entities,omitempty"`
+	// optional
+	DisableWebPagePreview bool `json:"disable_web_page_preview,omitempty"`
+	// ReplyMarkup replaces the inline keyboard, which is removed when nil.
+	//
+	// optional
+	ReplyMarkup *InlineKeyboardMarkup `json:"reply_markup,omitempty"`
+}
+
+// EditMessageText changes the text of a message. It returns nil instead of
+// the message when the edited message was sent in inline mode.
+func (self *telegramImpl) EditMessageText(config EditMessageConfig) (*Message, error) {
+	if len(config.Text) == 0 {
+		return nil, errors.New("message text must not be empty")
+	}
+
+	var result json.RawMessage
+
+	err := self.request("editMessageText", config, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	// Telegram returns true instead of the message in inline mode
+	if !strings.HasPrefix(string(result), "{") {
+		return nil, nil
+	}
+
+	message := &Message{}
+	if err = json.Unmarshal(result, message); err != nil {
+		return nil, err
+	}
+
+	return message, nil
+}
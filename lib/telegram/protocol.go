@@ -21,7 +21,9 @@ type APIResponse struct {
 
 // Error is an error containing extra information returned by the Telegram API.
 type Error struct {
-	Code    int
+	// Code is the error_code of the response, mostly an HTTP status code.
+	Code int
+	// Message is the human-readable description of the error.
 	Message string
 	ResponseParameters
 }
@@ -0,0 +1,342 @@
+package telegram
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// queueSweepInterval spaces the evictions of the idle chats, so that a long
+// running process doesn't keep a bucket for every chat it ever talked to.
+const queueSweepInterval = time.Minute
+
+// Job performs a request toward chatId, the chat id may differ from the one
+// the job was queued with when the group has migrated to a supergroup.
+type Job func(chatId int64) error
+
+// Queue sends outbound requests while respecting the flood limits of
+// Telegram: a global limit for the whole bot and a limit per chat. Requests
+// toward a chat are performed in the order they are queued.
+type Queue interface {
+	// Enqueue schedules job and returns a channel receiving its result.
+	Enqueue(chatId int64, job Job) <-chan error
+	// Send schedules job and waits for its result.
+	Send(chatId int64, job Job) error
+	// Broadcast schedules job for every chat and waits for all of them,
+	// only the failed chats are reported.
+	Broadcast(chatIds []int64, job Job) map[int64]error
+	// Close waits until every queued job is done.
+	Close()
+}
+
+type QueueConfig struct {
+	// GlobalRate is the number of requests per second for the whole bot,
+	// default to 30.
+	GlobalRate float64
+	// GlobalBurst default to GlobalRate.
+	GlobalBurst int
+	// ChatRate is the number of requests per second toward a private chat,
+	// default to 1.
+	ChatRate float64
+	// GroupRate is the number of requests per second toward a group or a
+	// channel, default to 20 per minute.
+	GroupRate float64
+	// ChatBurst is the burst allowed for each chat, default to 1.
+	ChatBurst int
+	// MaxRetries is how many times a request is retried after a flood
+	// control error, default to 3.
+	MaxRetries int
+	// OnMigrate is called when a group is found to be migrated to a
+	// supergroup, the following jobs of the group are sent to the new chat.
+	//
+	// optional
+	OnMigrate func(from, to int64)
+}
+
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+type queuedJob struct {
+	job  Job
+	done chan error
+}
+
+type chatQueue struct {
+	bucket  *tokenBucket
+	jobs    []*queuedJob
+	running bool
+}
+
+type queueImpl struct {
+	mutex       sync.Mutex
+	waiter      sync.WaitGroup
+	config      QueueConfig
+	global      *tokenBucket
+	chats       map[int64]*chatQueue
+	migrated    map[int64]int64
+	pausedUntil time.Time
+	sweptAt     time.Time
+}
+
+func NewQueue(config QueueConfig) Queue {
+	if config.GlobalRate <= 0 {
+		config.GlobalRate = 30
+	}
+
+	if config.GlobalBurst <= 0 {
+		config.GlobalBurst = int(config.GlobalRate)
+	}
+
+	if config.ChatRate <= 0 {
+		config.ChatRate = 1
+	}
+
+	if config.GroupRate <= 0 {
+		config.GroupRate = 20.0 / 60.0
+	}
+
+	if config.ChatBurst <= 0 {
+		config.ChatBurst = 1
+	}
+
+	if config.MaxRetries <= 0 {
+		config.MaxRetries = 3
+	}
+
+	return &queueImpl{
+		config:   config,
+		global:   newTokenBucket(config.GlobalRate, config.GlobalBurst),
+		chats:    make(map[int64]*chatQueue),
+		migrated: make(map[int64]int64),
+		sweptAt:  time.Now(),
+	}
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	return &tokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// delay returns how long to wait until a token is available.
+func (self *tokenBucket) delay(now time.Time) time.Duration {
+	self.tokens += now.Sub(self.last).Seconds() * self.rate
+	self.last = now
+
+	if self.tokens > self.burst {
+		self.tokens = self.burst
+	}
+
+	if self.tokens >= 1 {
+		return 0
+	}
+
+	return time.Duration((1 - self.tokens) / self.rate * float64(time.Second))
+}
+
+func (self *tokenBucket) take() {
+	self.tokens--
+}
+
+// full tells if the bucket has refilled, a new bucket would then behave the
+// same.
+func (self *tokenBucket) full(now time.Time) bool {
+	return self.tokens+now.Sub(self.last).Seconds()*self.rate >= self.burst
+}
+
+func (self *queueImpl) Enqueue(chatId int64, job Job) <-chan error {
+	done := make(chan error, 1)
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	self.sweep(time.Now())
+
+	chatId = self.resolve(chatId)
+	queue, ok := self.chats[chatId]
+
+	if !ok {
+		rate := self.config.ChatRate
+
+		// Ids of groups, supergroups and channels are negative
+		if chatId < 0 {
+			rate = self.config.GroupRate
+		}
+
+		queue = &chatQueue{bucket: newTokenBucket(rate, self.config.ChatBurst)}
+		self.chats[chatId] = queue
+	}
+
+	queue.jobs = append(queue.jobs, &queuedJob{job: job, done: done})
+	self.waiter.Add(1)
+
+	if !queue.running {
+		queue.running = true
+		go self.drain(chatId, queue)
+	}
+
+	return done
+}
+
+func (self *queueImpl) Send(chatId int64, job Job) error {
+	return <-self.Enqueue(chatId, job)
+}
+
+func (self *queueImpl) Broadcast(chatIds []int64, job Job) map[int64]error {
+	results := make(map[int64]<-chan error)
+	failures := make(map[int64]error)
+
+	for _, chatId := range chatIds {
+		results[chatId] = self.Enqueue(chatId, job)
+	}
+
+	for chatId, result := range results {
+		if err := <-result; err != nil {
+			failures[chatId] = err
+		}
+	}
+
+	return failures
+}
+
+func (self *queueImpl) Close() {
+	self.waiter.Wait()
+}
+
+// sweep forgets the chats having nothing to send whose bucket has refilled,
+// the caller holds the mutex.
+func (self *queueImpl) sweep(now time.Time) {
+	if now.Sub(self.sweptAt) < queueSweepInterval {
+		return
+	}
+
+	self.sweptAt = now
+
+	for chatId, queue := range self.chats {
+		if !queue.running && len(queue.jobs) == 0 && queue.bucket.full(now) {
+			delete(self.chats, chatId)
+		}
+	}
+}
+
+func (self *queueImpl) resolve(chatId int64) int64 {
+	for {
+		newChatId, ok := self.migrated[chatId]
+		if !ok {
+			return chatId
+		}
+
+		chatId = newChatId
+	}
+}
+
+func (self *queueImpl) drain(chatId int64, queue *chatQueue) {
+	for {
+		self.mutex.Lock()
+		if len(queue.jobs) == 0 {
+			queue.running = false
+			self.mutex.Unlock()
+			return
+		}
+
+		next := queue.jobs[0]
+		queue.jobs = queue.jobs[1:]
+		self.mutex.Unlock()
+
+		next.done <- self.perform(chatId, queue.bucket, next.job)
+		self.waiter.Done()
+	}
+}
+
+func (self *queueImpl) perform(chatId int64, bucket *tokenBucket, job Job) error {
+	retries := 0
+
+	for {
+		self.wait(bucket)
+
+		err := job(chatId)
+		if err == nil {
+			return nil
+		}
+
+		apiErr := Error{}
+		if !errors.As(err, &apiErr) {
+			return err
+		}
+
+		if errors.Is(apiErr, ErrChatMigrated) && apiErr.MigrateToChatID != chatId {
+			self.migrate(chatId, apiErr.MigrateToChatID)
+
+			chatId = apiErr.MigrateToChatID
+			continue
+		}
+
+		if !errors.Is(apiErr, ErrTooManyRequests) || retries >= self.config.MaxRetries {
+			return err
+		}
+
+		retries++
+
+		if apiErr.RetryAfter > 0 {
+			self.pause(time.Duration(apiErr.RetryAfter) * time.Second)
+		} else {
+			self.pause(time.Duration(retries) * time.Second)
+		}
+	}
+}
+
+// wait blocks until both the global bucket and the chat bucket have a token
+// and the queue isn't paused by a flood control error.
+func (self *queueImpl) wait(bucket *tokenBucket) {
+	for {
+		self.mutex.Lock()
+
+		now := time.Now()
+		delay := self.pausedUntil.Sub(now)
+
+		if delay <= 0 {
+			delay = bucket.delay(now)
+		}
+
+		if delay <= 0 {
+			delay = self.global.delay(now)
+		}
+
+		if delay <= 0 {
+			bucket.take()
+			self.global.take()
+			self.mutex.Unlock()
+			return
+		}
+
+		self.mutex.Unlock()
+		time.Sleep(delay)
+	}
+}
+
+func (self *queueImpl) pause(duration time.Duration) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	until := time.Now().Add(duration)
+	if until.After(self.pausedUntil) {
+		self.pausedUntil = until
+	}
+}
+
+func (self *queueImpl) migrate(from, to int64) {
+	self.mutex.Lock()
+	self.migrated[from] = to
+	self.mutex.Unlock()
+
+	if self.config.OnMigrate != nil {
+		self.config.OnMigrate(from, to)
+	}
+}
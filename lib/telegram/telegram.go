@@ -7,13 +7,41 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"mime/multipart"
 	"net/http"
 	"strconv"
 )
 
+const (
+	// SecretTokenHeader is the header Telegram uses to forward the secret
+	// token configured by SetWebhook with every webhook request.
+	SecretTokenHeader = "X-Telegram-Bot-Api-Secret-Token"
+
+	apiEndpoint = "https://api.telegram.org/bot%s/%s"
+)
+
 type Telegram interface {
 	ParseIncomingRequest(reader io.Reader) (*Update, error)
 	ReplyMessage(chatId int64, text string) error
+	SendMessage(config MessageConfig) (*Message, error)
+	EditMessageText(config EditMessageConfig) (*Message, error)
+	SendLongMessage(config LongMessageConfig) ([]*Message, error)
+	SendDocument(config DocumentConfig) (*Message, error)
+	SendPhoto(config PhotoConfig) (*Message, error)
+	SendMediaGroup(config MediaGroupConfig) ([]*Message, error)
+	GetFile(fileId string) (*File, error)
+	DownloadFile(file *File, limit int64) ([]byte, error)
+	AnswerCallbackQuery(config CallbackConfig) error
+	AnswerInlineQuery(config InlineConfig) error
+
+	SetWebhook(config WebhookConfig) error
+	DeleteWebhook(dropPendingUpdates bool) error
+	GetWebhookInfo() (*WebhookInfo, error)
+
+	SetMyCommands(config CommandsConfig) error
+	DeleteMyCommands(scope *BotCommandScope, languageCode string) error
+	SetChatMenuButton(chatId int64, button MenuButton) error
+	GetChatMember(chatId, userId int64) (*ChatMember, error)
 }
 
 type telegramImpl struct {
@@ -46,15 +74,87 @@ func (self *telegramImpl) ReplyMessage(chatId int64, text string) error {
 		"chat_id": strconv.FormatInt(chatId, 10),
 		"text":    text,
 	}
-	replyMsg, err := json.Marshal(replyObj)
+
+	return self.request("sendMessage", replyObj, nil)
+}
+
+// request calls the bot API method with params encoded as JSON and decodes
+// the result of a successful call into result, if it isn't nil. Failures
+// reported by Telegram are returned as Error.
+func (self *telegramImpl) request(method string, params interface{}, result interface{}) error {
+	body, err := json.Marshal(params)
 	if err != nil {
 		return err
 	}
 
+	return self.post(method, "application/json", bytes.NewBuffer(body), result)
+}
+
+// upload calls the bot API method as a multipart/form-data request carrying
+// params and the files having a Reader, the body is streamed while the files
+// are read. Files referenced by FileID or URL are passed as plain params.
+func (self *telegramImpl) upload(
+	method string,
+	params map[string]string,
+	files []uploadFile,
+	result interface{},
+) error {
+	reader, pipe := io.Pipe()
+	writer := multipart.NewWriter(pipe)
+
+	go func() {
+		err := writeMultipart(writer, params, files)
+		if err == nil {
+			err = writer.Close()
+		}
+
+		pipe.CloseWithError(err)
+	}()
+
+	return self.post(method, writer.FormDataContentType(), reader, result)
+}
+
+func writeMultipart(
+	writer *multipart.Writer,
+	params map[string]string,
+	files []uploadFile,
+) error {
+	for key, value := range params {
+		if err := writer.WriteField(key, value); err != nil {
+			return err
+		}
+	}
+
+	for _, file := range files {
+		if file.Reader == nil {
+			if err := writer.WriteField(file.field, file.reference()); err != nil {
+				return err
+			}
+			continue
+		}
+
+		part, err := writer.CreateFormFile(file.field, file.name())
+		if err != nil {
+			return err
+		}
+
+		if _, err = io.Copy(part, file.Reader); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (self *telegramImpl) post(
+	method, contentType string,
+	body io.Reader,
+	result interface{},
+) error {
 	resp, err := http.Post(
-		fmt.Sprintf("https://api.telegram.org/bot%s/sendMessage", self.token),
-		"application/json",
-		bytes.NewBuffer(replyMsg),
+		fmt.Sprintf(apiEndpoint, self.token, method),
+		contentType,
+		body,
 	)
 	if err != nil {
 		return err
@@ -65,15 +165,24 @@ func (self *telegramImpl) ReplyMessage(chatId int64, text string) error {
 		}
 	}(resp.Body)
 
-	if resp.StatusCode != http.StatusOK {
-		errMsg := &APIResponse{}
-		err := json.NewDecoder(resp.Body).Decode(&errMsg)
+	apiResp := &APIResponse{}
+	err = json.NewDecoder(resp.Body).Decode(apiResp)
 
+	if resp.StatusCode != http.StatusOK {
 		if err != nil {
 			return fmt.Errorf("Error parsing response: %v", err)
 		}
 
-		return fmt.Errorf("Status %q: %s", resp.Status, errMsg.Description)
+		return newError(apiResp, resp.Status)
+	} else if err != nil {
+		return fmt.Errorf("Error parsing response: %v", err)
+	} else if !apiResp.Ok {
+		return newError(apiResp, resp.Status)
 	}
-	return nil
+
+	if result == nil || len(apiResp.Result) == 0 {
+		return nil
+	}
+
+	return json.Unmarshal(apiResp.Result, result)
 }
@@ -0,0 +1,306 @@
+package telegram
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// InputFile is a file to send. Exactly one of Reader, FileID and URL must be
+// set: Reader uploads a new file, FileID reuses a file already stored on the
+// Telegram servers and URL lets Telegram download the file itself.
+type InputFile struct {
+	// Name is the file name shown to the users when Reader is uploaded.
+	Name string
+	// Reader streams the content of a new file.
+	Reader io.Reader
+	// FileID is the identifier returned by a previous send, see FileIDOf.
+	FileID string
+	// URL is an HTTP url of the file.
+	URL string
+}
+
+// DocumentConfig contains the parameters of a sendDocument call.
+type DocumentConfig struct {
+	ChatID   int64     `json:"chat_id"`
+	Document InputFile `json:"-"`
+	// Caption of the document, 0-1024 characters after entities parsing.
+	//
+	// optional
+	Caption string `json:"caption,omitempty"`
+	// ParseMode of the caption, one of the Mode* constants.
+	//
+	// optional
+	ParseMode string `json:"parse_mode,omitempty"`
+	// CaptionEntities appear in the caption, used instead of ParseMode.
+	//
+	// optional
+	CaptionEntities []MessageEntity `json:"caption_entities,omitempty"`
+	// DisableContentTypeDetection keeps Telegram from detecting the content
+	// type of the uploaded file.
+	//
+	// optional
+	DisableContentTypeDetection bool `json:"disable_content_type_detection,omitempty"`
+	// optional
+	DisableNotification bool `json:"disable_notification,omitempty"`
+	// optional
+	ReplyToMessageID int `json:"reply_to_message_id,omitempty"`
+	// optional
+	ReplyMarkup interface{} `json:"reply_markup,omitempty"`
+}
+
+// PhotoConfig contains the parameters of a sendPhoto call.
+type PhotoConfig struct {
+	ChatID int64     `json:"chat_id"`
+	Photo  InputFile `json:"-"`
+	// Caption of the photo, 0-1024 characters after entities parsing.
+	//
+	// optional
+	Caption string `json:"caption,omitempty"`
+	// optional
+	ParseMode string `json:"parse_mode,omitempty"`
+	// optional
+	CaptionEntities []MessageEntity `json:"caption_entities,omitempty"`
+	// optional
+	DisableNotification bool `json:"disable_notification,omitempty"`
+	// optional
+	ReplyToMessageID int `json:"reply_to_message_id,omitempty"`
+	// optional
+	ReplyMarkup interface{} `json:"reply_markup,omitempty"`
+}
+
+// InputMedia is an item of a media group.
+type InputMedia struct {
+	// Type of the media, "photo" or "document". Documents can't be mixed
+	// with photos in the same group.
+	Type  string    `json:"type"`
+	Media InputFile `json:"-"`
+	// optional
+	Caption string `json:"caption,omitempty"`
+	// optional
+	ParseMode string `json:"parse_mode,omitempty"`
+	// optional
+	CaptionEntities []MessageEntity `json:"caption_entities,omitempty"`
+}
+
+// MediaGroupConfig contains the parameters of a sendMediaGroup call.
+type MediaGroupConfig struct {
+	ChatID int64 `json:"chat_id"`
+	// Media is the list of 2-10 items of the group.
+	Media []InputMedia `json:"-"`
+	// optional
+	DisableNotification bool `json:"disable_notification,omitempty"`
+	// optional
+	ReplyToMessageID int `json:"reply_to_message_id,omitempty"`
+}
+
+type uploadFile struct {
+	InputFile
+
+	field string
+}
+
+type inputMediaParam struct {
+	InputMedia
+
+	Media string `json:"media"`
+}
+
+func (self *telegramImpl) SendDocument(config DocumentConfig) (*Message, error) {
+	message := &Message{}
+
+	err := self.send("sendDocument", config, []uploadFile{
+		{InputFile: config.Document, field: "document"},
+	}, message)
+	if err != nil {
+		return nil, err
+	}
+
+	return message, nil
+}
+
+func (self *telegramImpl) SendPhoto(config PhotoConfig) (*Message, error) {
+	message := &Message{}
+
+	err := self.send("sendPhoto", config, []uploadFile{
+		{InputFile: config.Photo, field: "photo"},
+	}, message)
+	if err != nil {
+		return nil, err
+	}
+
+	return message, nil
+}
+
+func (self *telegramImpl) SendMediaGroup(config MediaGroupConfig) ([]*Message, error) {
+	if len(config.Media) < 2 || len(config.Media) > 10 {
+		return nil, errors.New("a media group must have 2-10 items")
+	}
+
+	media := make([]inputMediaParam, 0, len(config.Media))
+	files := make([]uploadFile, 0, len(config.Media))
+
+	for i, item := range config.Media {
+		file := uploadFile{InputFile: item.Media, field: fmt.Sprintf("file%d", i)}
+
+		if err := file.validate(); err != nil {
+			return nil, err
+		}
+
+		media = append(media, inputMediaParam{
+			InputMedia: item,
+			Media:      file.reference(),
+		})
+
+		if file.Reader != nil {
+			files = append(files, file)
+		}
+	}
+
+	params, err := paramsOf(config)
+	if err != nil {
+		return nil, err
+	}
+
+	encoded, err := json.Marshal(media)
+	if err != nil {
+		return nil, err
+	}
+
+	params["media"] = string(encoded)
+	messages := make([]*Message, 0)
+
+	if len(files) == 0 {
+		err = self.request("sendMediaGroup", params, &messages)
+	} else {
+		err = self.upload("sendMediaGroup", params, files, &messages)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return messages, nil
+}
+
+// FileIDOf returns the identifier of the document or the largest photo sent
+// with message, it can be used as InputFile.FileID to send the same file
+// again without uploading it.
+func FileIDOf(message *Message) string {
+	if message == nil {
+		return ""
+	}
+
+	if message.Document != nil {
+		return message.Document.FileID
+	}
+
+	if len(message.Photo) > 0 {
+		return message.Photo[len(message.Photo)-1].FileID
+	}
+
+	return ""
+}
+
+// send calls method with the params of config and files, the request is only
+// a multipart one when a file must be uploaded.
+func (self *telegramImpl) send(
+	method string,
+	config interface{},
+	files []uploadFile,
+	result interface{},
+) error {
+	params, err := paramsOf(config)
+	if err != nil {
+		return err
+	}
+
+	uploading := false
+
+	for _, file := range files {
+		if err := file.validate(); err != nil {
+			return err
+		}
+
+		if file.Reader != nil {
+			uploading = true
+		} else {
+			params[file.field] = file.reference()
+		}
+	}
+
+	if !uploading {
+		return self.request(method, params, result)
+	}
+
+	return self.upload(method, params, files, result)
+}
+
+func (self uploadFile) validate() error {
+	set := 0
+
+	for _, ok := range []bool{
+		self.Reader != nil,
+		len(self.FileID) > 0,
+		len(self.URL) > 0,
+	} {
+		if ok {
+			set++
+		}
+	}
+
+	if set != 1 {
+		return fmt.Errorf("%s needs exactly one of Reader, FileID or URL", self.field)
+	}
+
+	return nil
+}
+
+// reference returns how the file is referred to in params.
+func (self uploadFile) reference() string {
+	if len(self.FileID) > 0 {
+		return self.FileID
+	}
+
+	if len(self.URL) > 0 {
+		return self.URL
+	}
+
+	return "attach://" + self.field
+}
+
+func (self uploadFile) name() string {
+	if len(self.Name) > 0 {
+		return self.Name
+	}
+
+	return self.field
+}
+
+// paramsOf flattens the JSON encoding of config into form values, strings
+// are kept as is while the other values keep their JSON encoding.
+func paramsOf(config interface{}) (map[string]string, error) {
+	encoded, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := make(map[string]json.RawMessage)
+	if err = json.Unmarshal(encoded, &fields); err != nil {
+		return nil, err
+	}
+
+	params := make(map[string]string)
+
+	for key, value := range fields {
+		var text string
+
+		if err := json.Unmarshal(value, &text); err == nil {
+			params[key] = text
+		} else {
+			params[key] = string(value)
+		}
+	}
+
+	return params, nil
+}
@@ -0,0 +1,63 @@
+package telegram
+
+import (
+	"errors"
+)
+
+// WebhookConfig contains the parameters of a setWebhook call.
+type WebhookConfig struct {
+	// URL is the HTTPS url to send updates to.
+	URL string `json:"url"`
+	// IPAddress is the fixed IP address which will be used to send webhook
+	// requests instead of the IP address resolved through DNS.
+	//
+	// optional
+	IPAddress string `json:"ip_address,omitempty"`
+	// MaxConnections is the maximum allowed number of simultaneous HTTPS
+	// connections to the webhook for update delivery, 1-100.
+	//
+	// optional
+	MaxConnections int `json:"max_connections,omitempty"`
+	// AllowedUpdates is the list of update types the bot should receive,
+	// e.g. "message", "callback_query". An empty list keeps the previous
+	// setting.
+	//
+	// optional
+	AllowedUpdates []string `json:"allowed_updates,omitempty"`
+	// DropPendingUpdates drops all pending updates.
+	//
+	// optional
+	DropPendingUpdates bool `json:"drop_pending_updates,omitempty"`
+	// SecretToken is sent in the SecretTokenHeader header of every webhook
+	// request, 1-256 characters of A-Z, a-z, 0-9, _ and -.
+	//
+	// optional
+	SecretToken string `json:"secret_token,omitempty"`
+}
+
+func (self *telegramImpl) SetWebhook(config WebhookConfig) error {
+	if len(config.URL) == 0 {
+		return errors.New("webhook url must not be empty")
+	}
+
+	return self.request("setWebhook", config, nil)
+}
+
+func (self *telegramImpl) DeleteWebhook(dropPendingUpdates bool) error {
+	params := map[string]bool{
+		"drop_pending_updates": dropPendingUpdates,
+	}
+
+	return self.request("deleteWebhook", params, nil)
+}
+
+func (self *telegramImpl) GetWebhookInfo() (*WebhookInfo, error) {
+	info := &WebhookInfo{}
+
+	err := self.request("getWebhookInfo", map[string]string{}, info)
+	if err != nil {
+		return nil, err
+	}
+
+	return info, nil
+}
@@ -0,0 +1,366 @@
+package alert
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/audit"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/container"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/env"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/logs"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/mux"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/rbac"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/render"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/state"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/telegram"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/modules/cluster"
+)
+
+const ModuleName = "alert"
+
+// subscriptionsKey is the set of the subscriptions of every chat encoded in
+// JSON, the watcher reads them from the store shared with the instances
+// answering the commands. A set is updated atomically by the instances
+// running in parallel.
+const subscriptionsKey = "alert:subscriptions"
+
+type Alert interface {
+	container.Module
+
+	Commands() []mux.Command
+
+	// Watch follows the registered clusters and pushes the alerts to the
+	// subscribed chats until ctx is done.
+	Watch(ctx context.Context, bot telegram.Telegram, logger logs.Logger) error
+}
+
+// Subscription sends the alerts of a rule about a cluster, or only about one
+// of its namespaces, to a chat.
+type Subscription struct {
+	ChatID    int64  `json:"chat_id"`
+	Cluster   string `json:"cluster"`
+	Namespace string `json:"namespace,omitempty"`
+	Rule      string `json:"rule"`
+}
+
+// Match tells if the subscription covers event.
+func (self Subscription) Match(event Event) bool {
+	if self.Cluster != event.Cluster {
+		return false
+	}
+
+	if len(self.Namespace) > 0 && self.Namespace != event.Namespace {
+		return false
+	}
+
+	return self.Rule == RuleAll || self.Rule == event.Rule
+}
+
+func (self Subscription) target() string {
+	if len(self.Namespace) == 0 {
+		return "cluster " + self.Cluster
+	}
+
+	return fmt.Sprintf("namespace %s of cluster %s", self.Namespace, self.Cluster)
+}
+
+type alertImpl struct {
+	store state.Store
+
+	restartThreshold int
+	restartWindow    time.Duration
+	dedupeWindow     time.Duration
+	groupInterval    time.Duration
+	eventReasons     map[string]bool
+}
+
+// NewModule keeps the subscriptions in store. The rules are tuned by
+// $ALERT_RESTART_THRESHOLD restarts, default to 3, within
+// $ALERT_RESTART_WINDOW, default to 10m, and $ALERT_EVENT_REASONS, the
+// reasons of the warning events to report. An alert isn't repeated within
+// $ALERT_DEDUPE_WINDOW, default to 30m, and the alerts are grouped into a
+// message per chat every $ALERT_GROUP_INTERVAL, default to 30s.
+func NewModule(store state.Store) Alert {
+	return &alertImpl{
+		store: store,
+	}
+}
+
+func (self *alertImpl) Init() error {
+	var err error
+
+	self.restartThreshold, err = env.Int("ALERT_RESTART_THRESHOLD", 3)
+	if err != nil {
+		return err
+	}
+
+	self.restartWindow, err = env.Duration("ALERT_RESTART_WINDOW", 10*time.Minute)
+	if err != nil {
+		return err
+	}
+
+	self.dedupeWindow, err = env.Duration("ALERT_DEDUPE_WINDOW", 30*time.Minute)
+	if err != nil {
+		return err
+	}
+
+	self.groupInterval, err = env.Duration("ALERT_GROUP_INTERVAL", 30*time.Second)
+	if err != nil {
+		return err
+	}
+
+	reasons := os.Getenv("ALERT_EVENT_REASONS")
+	if len(reasons) == 0 {
+		reasons = "FailedScheduling,FailedMount,FailedAttachVolume,Evicted"
+	}
+
+	self.eventReasons = make(map[string]bool)
+	for _, reason := range strings.Split(reasons, ",") {
+		self.eventReasons[strings.TrimSpace(reason)] = true
+	}
+
+	return nil
+}
+
+func (self *alertImpl) Deinit() error {
+	return nil
+}
+
+func (self *alertImpl) Commands() []mux.Command {
+	rules := strings.Join(Rules, "|")
+
+	return []mux.Command{
+		{
+			Name:        "subscribe",
+			Description: "Push the alerts of a cluster or a namespace to this chat, rules: " + rules,
+			Role:        rbac.RoleOperator,
+			Handler:     self.subscribe,
+		},
+		{
+			Name:        "unsubscribe",
+			Description: "Stop pushing the alerts of a cluster or a namespace to this chat",
+			Role:        rbac.RoleOperator,
+			Handler:     self.unsubscribe,
+		},
+		{
+			Name:        "subscriptions",
+			Description: "List the alerts pushed to this chat",
+			Role:        rbac.RoleViewer,
+			Handler:     self.listSubscriptions,
+		},
+	}
+}
+
+func (self *alertImpl) subscribe(ctx *mux.Context) error {
+	if len(ctx.Args) != 2 || !validRule(ctx.Args[1]) {
+		return ctx.Reply(fmt.Sprintf("Usage: /subscribe <namespace|cluster> <%s>", strings.Join(Rules, "|")))
+	}
+
+	subscription, ok, err := self.parseSubscription(ctx)
+	if !ok || err != nil {
+		return err
+	}
+
+	subscription.Rule = ctx.Args[1]
+
+	added, err := self.add(subscription)
+	if err != nil {
+		return err
+	}
+
+	if !added {
+		return ctx.Reply("This chat already receives these alerts")
+	}
+
+	return ctx.Reply(fmt.Sprintf("This chat now receives the %s alerts of %s",
+		subscription.Rule, subscription.target()))
+}
+
+func (self *alertImpl) unsubscribe(ctx *mux.Context) error {
+	if len(ctx.Args) == 0 || len(ctx.Args) > 2 {
+		return ctx.Reply("Usage: /unsubscribe <namespace|cluster> [rule], every rule without it")
+	}
+
+	target, ok, err := self.parseSubscription(ctx)
+	if !ok || err != nil {
+		return err
+	}
+
+	subscriptions, err := self.subscriptions()
+	if err != nil {
+		return err
+	}
+
+	removed := false
+
+	for _, subscription := range subscriptions {
+		matched := subscription.ChatID == target.ChatID &&
+			subscription.Cluster == target.Cluster &&
+			subscription.Namespace == target.Namespace &&
+			(len(ctx.Args) == 1 || subscription.Rule == ctx.Args[1])
+
+		if !matched {
+			continue
+		}
+
+		// Another instance may have removed it meanwhile
+		done, err := self.remove(subscription)
+		if err != nil {
+			return err
+		}
+
+		removed = removed || done
+	}
+
+	if !removed {
+		return ctx.Reply("This chat doesn't receive these alerts")
+	}
+
+	return ctx.Reply(fmt.Sprintf("This chat doesn't receive the alerts of %s anymore", target.target()))
+}
+
+func (self *alertImpl) listSubscriptions(ctx *mux.Context) error {
+	subscriptions, err := self.subscriptions()
+	if err != nil {
+		return err
+	}
+
+	builder := render.NewHTML().Bold("Alerts pushed to this chat").Line("")
+	found := false
+
+	for _, subscription := range subscriptions {
+		if subscription.ChatID == ctx.Message.Chat.ID {
+			found = true
+			builder.Text("• ").Code(subscription.Rule).Line(" of " + subscription.target())
+		}
+	}
+
+	if !found {
+		return ctx.Reply("This chat receives no alert, /subscribe to some")
+	}
+
+	return ctx.Send(builder)
+}
+
+// parseSubscription reads the target of /subscribe and /unsubscribe: a
+// registered cluster, or else a namespace of the selected cluster. It
+// replies and returns false when the sender can't watch the cluster.
+func (self *alertImpl) parseSubscription(ctx *mux.Context) (Subscription, bool, error) {
+	subscription := Subscription{ChatID: ctx.Message.Chat.ID}
+
+	clusters, err := cluster.Default()
+	if err != nil {
+		return subscription, false, err
+	}
+
+	for _, name := range clusters.Clusters() {
+		if name == ctx.Args[0] {
+			subscription.Cluster = name
+		}
+	}
+
+	if len(subscription.Cluster) == 0 {
+		selection, err := clusters.Selection(ctx.Message.Chat.ID)
+		if err != nil {
+			return subscription, false, ctx.Reply(err.Error())
+		}
+
+		subscription.Cluster = selection.Cluster
+		subscription.Namespace = ctx.Args[0]
+	}
+
+	ctx.Audit.Target(subscription.Cluster, subscription.Namespace, "")
+
+	if ctx.Message.From == nil {
+		return subscription, false, ctx.Reply("Commands sent on behalf of a chat can't be authorized")
+	}
+
+	allowed, err := rbac.Allowed(ctx.Message.From.ID, subscription.Cluster, rbac.RoleViewer)
+	if err != nil {
+		return subscription, false, err
+	}
+
+	if !allowed {
+		ctx.Audit.Result = audit.ResultDenied
+		return subscription, false, ctx.Reply("You need the viewer role on cluster " + subscription.Cluster)
+	}
+
+	return subscription, true, nil
+}
+
+func (self *alertImpl) subscriptions() ([]Subscription, error) {
+	members, err := self.store.Members(subscriptionsKey)
+	if err != nil {
+		return nil, err
+	}
+
+	subscriptions := make([]Subscription, 0, len(members))
+
+	for _, member := range members {
+		subscription := Subscription{}
+		if err = json.Unmarshal([]byte(member), &subscription); err != nil {
+			return nil, err
+		}
+
+		subscriptions = append(subscriptions, subscription)
+	}
+
+	return subscriptions, nil
+}
+
+// add inserts subscription into the set, it returns false when the chat
+// already has it.
+func (self *alertImpl) add(subscription Subscription) (bool, error) {
+	member, err := json.Marshal(subscription)
+	if err != nil {
+		return false, err
+	}
+
+	return self.store.Add(subscriptionsKey, string(member))
+}
+
+func (self *alertImpl) remove(subscription Subscription) (bool, error) {
+	member, err := json.Marshal(subscription)
+	if err != nil {
+		return false, err
+	}
+
+	return self.store.Remove(subscriptionsKey, string(member))
+}
+
+// migrate moves the subscriptions of a group which became a supergroup.
+func (self *alertImpl) migrate(from, to int64) {
+	subscriptions, err := self.subscriptions()
+	if err != nil {
+		return
+	}
+
+	for _, subscription := range subscriptions {
+		if subscription.ChatID != from {
+			continue
+		}
+
+		if _, err = self.remove(subscription); err != nil {
+			return
+		}
+
+		subscription.ChatID = to
+		if _, err = self.add(subscription); err != nil {
+			return
+		}
+	}
+}
+
+func validRule(rule string) bool {
+	for _, known := range Rules {
+		if known == rule {
+			return true
+		}
+	}
+
+	return false
+}
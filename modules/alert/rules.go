@@ -0,0 +1,261 @@
+package alert
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/hung0913208/telegram-bot-for-kubernetes/modules/cluster"
+)
+
+// The rules a chat subscribes to.
+const (
+	// RuleOOMKilled reports the containers killed for using too much memory.
+	RuleOOMKilled = "oom"
+	// RuleRestarts reports the pods restarting too often.
+	RuleRestarts = "restarts"
+	// RuleNodeNotReady reports the nodes which aren't ready, and when they
+	// are ready again.
+	RuleNodeNotReady = "node-not-ready"
+	// RuleEvents reports the warning events of $ALERT_EVENT_REASONS.
+	RuleEvents = "events"
+	// RuleAll subscribes to every rule.
+	RuleAll = "all"
+)
+
+// Rules lists the rules a chat can subscribe to.
+var Rules = []string{RuleOOMKilled, RuleRestarts, RuleNodeNotReady, RuleEvents, RuleAll}
+
+// Event is something a rule found in a cluster.
+type Event struct {
+	Cluster   string
+	Namespace string
+	Rule      string
+	// Object is the pod, the node or the object of the warning event, e.g.
+	// pod/api-5d9c-x2b7q.
+	Object  string
+	Message string
+	// Resolved tells that the problem reported earlier is over.
+	Resolved bool
+	Time     time.Time
+}
+
+// key identifies the events which are the same alert for deduplication.
+// resolves tells if rule reports the end of its problems.
+func resolves(rule string) bool {
+	return rule == RuleNodeNotReady
+}
+
+func (self Event) key() string {
+	return fmt.Sprintf("%s/%s/%s/%s", self.Cluster, self.Rule, self.Namespace, self.Object)
+}
+
+// detector applies the rules to the changes of the objects of a cluster and
+// sends what they find to events.
+type detector struct {
+	mutex   sync.Mutex
+	cluster string
+	module  *alertImpl
+	events  chan<- Event
+	started time.Time
+
+	// restarts keeps the total restarts of every pod and when the recent
+	// ones happened.
+	restarts     map[types.UID]int32
+	restartTimes map[types.UID][]time.Time
+}
+
+func newDetector(cluster string, module *alertImpl, events chan<- Event) *detector {
+	return &detector{
+		cluster:      cluster,
+		module:       module,
+		events:       events,
+		started:      time.Now(),
+		restarts:     make(map[types.UID]int32),
+		restartTimes: make(map[types.UID][]time.Time),
+	}
+}
+
+func (self *detector) emit(event Event) {
+	event.Cluster = self.cluster
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	self.events <- event
+}
+
+// pod checks a pod after it's added or updated, old is nil when it's added.
+func (self *detector) pod(old, pod *corev1.Pod) {
+	object := "pod/" + pod.Name
+
+	for _, status := range pod.Status.ContainerStatuses {
+		terminated := status.State.Terminated
+		if terminated == nil {
+			terminated = status.LastTerminationState.Terminated
+		}
+
+		// The kills before the watcher started were reported by a previous
+		// run or are too old to matter
+		if terminated != nil && terminated.Reason == "OOMKilled" &&
+			terminated.FinishedAt.After(self.started) &&
+			!sameTermination(old, status.Name, terminated) {
+			self.emit(Event{
+				Namespace: pod.Namespace,
+				Rule:      RuleOOMKilled,
+				Object:    object,
+				Message: fmt.Sprintf("container %s is OOMKilled, its memory limit is %s",
+					status.Name, memoryLimit(pod, status.Name)),
+				Time: terminated.FinishedAt.Time,
+			})
+		}
+	}
+
+	total := int32(0)
+	for _, status := range pod.Status.ContainerStatuses {
+		total += status.RestartCount
+	}
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	previous, known := self.restarts[pod.UID]
+	self.restarts[pod.UID] = total
+
+	if !known || total <= previous {
+		return
+	}
+
+	now := time.Now()
+	times := self.restartTimes[pod.UID]
+
+	for i := previous; i < total; i++ {
+		times = append(times, now)
+	}
+
+	// Only the restarts within the window count
+	for len(times) > 0 && now.Sub(times[0]) > self.module.restartWindow {
+		times = times[1:]
+	}
+
+	self.restartTimes[pod.UID] = times
+
+	if len(times) >= self.module.restartThreshold {
+		self.emit(Event{
+			Namespace: pod.Namespace,
+			Rule:      RuleRestarts,
+			Object:    object,
+			Message: fmt.Sprintf("%d restarts in %s, %d in total",
+				len(times), self.module.restartWindow, total),
+		})
+	}
+}
+
+// forgetPod drops what is kept about a deleted pod.
+func (self *detector) forgetPod(pod *corev1.Pod) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	delete(self.restarts, pod.UID)
+	delete(self.restartTimes, pod.UID)
+}
+
+// node reports a node becoming not ready, or ready again, old is nil when
+// it's added.
+func (self *detector) node(old, node *corev1.Node) {
+	ready, message := nodeReady(node)
+	wasReady := true
+
+	if old != nil {
+		wasReady, _ = nodeReady(old)
+	}
+
+	if ready == wasReady {
+		return
+	}
+
+	event := Event{
+		Rule:     RuleNodeNotReady,
+		Object:   "node/" + node.Name,
+		Message:  message,
+		Resolved: ready,
+	}
+
+	if ready {
+		event.Message = "the node is ready again"
+	}
+
+	self.emit(event)
+}
+
+// event reports the recent warning events having one of the configured
+// reasons.
+func (self *detector) event(event *corev1.Event) {
+	if event.Type != corev1.EventTypeWarning || !self.module.eventReasons[event.Reason] {
+		return
+	}
+
+	seen := cluster.LastSeen(event)
+	if seen.Before(self.started) {
+		return
+	}
+
+	self.emit(Event{
+		Namespace: event.InvolvedObject.Namespace,
+		Rule:      RuleEvents,
+		Object:    fmt.Sprintf("%s/%s", event.InvolvedObject.Kind, event.InvolvedObject.Name),
+		Message:   fmt.Sprintf("%s: %s", event.Reason, event.Message),
+		Time:      seen,
+	})
+}
+
+// sameTermination tells if old already had the termination of a container.
+func sameTermination(old *corev1.Pod, container string, terminated *corev1.ContainerStateTerminated) bool {
+	if old == nil {
+		return false
+	}
+
+	for _, status := range old.Status.ContainerStatuses {
+		if status.Name != container {
+			continue
+		}
+
+		for _, previous := range []*corev1.ContainerStateTerminated{
+			status.State.Terminated,
+			status.LastTerminationState.Terminated,
+		} {
+			if previous != nil && previous.FinishedAt.Equal(&terminated.FinishedAt) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func memoryLimit(pod *corev1.Pod, container string) string {
+	for _, spec := range pod.Spec.Containers {
+		if spec.Name != container {
+			continue
+		}
+
+		if limit, ok := spec.Resources.Limits[corev1.ResourceMemory]; ok {
+			return limit.String()
+		}
+	}
+
+	return "unset"
+}
+
+func nodeReady(node *corev1.Node) (bool, string) {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == corev1.NodeReady {
+			return condition.Status == corev1.ConditionTrue, condition.Message
+		}
+	}
+
+	return false, "the node reports no Ready condition"
+}
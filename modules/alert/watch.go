@@ -0,0 +1,273 @@
+package alert
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/logs"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/render"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/telegram"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/modules/cluster"
+)
+
+// maxEventsPerMessage keeps a grouped message below the size limit of
+// Telegram, the remaining events are only counted.
+const maxEventsPerMessage = 30
+
+func (self *alertImpl) Watch(ctx context.Context, bot telegram.Telegram, logger logs.Logger) error {
+	clusters, err := cluster.Default()
+	if err != nil {
+		return err
+	}
+
+	events := make(chan Event, 256)
+
+	for _, name := range clusters.Clusters() {
+		client, err := clusters.Client(name)
+		if err != nil {
+			return err
+		}
+
+		if err = self.watchCluster(ctx, name, client, events); err != nil {
+			return fmt.Errorf("Can't watch cluster %s: %v", name, err)
+		}
+
+		logger.Infof("Watching cluster %s", name)
+	}
+
+	queue := telegram.NewQueue(telegram.QueueConfig{OnMigrate: self.migrate})
+	defer queue.Close()
+
+	return self.notify(ctx, events, bot, queue, logger)
+}
+
+// watchCluster feeds the detector of a cluster with the changes of its pods
+// and nodes and with its warning events, the informers list the objects
+// again whenever their watch breaks.
+func (self *alertImpl) watchCluster(
+	ctx context.Context,
+	name string,
+	client *cluster.Client,
+	events chan<- Event,
+) error {
+	detector := newDetector(name, self, events)
+	factory := informers.NewSharedInformerFactory(client.Clientset, 0)
+
+	_, err := factory.Core().V1().Pods().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(object interface{}) {
+			detector.pod(nil, object.(*corev1.Pod))
+		},
+		UpdateFunc: func(old, object interface{}) {
+			detector.pod(old.(*corev1.Pod), object.(*corev1.Pod))
+		},
+		DeleteFunc: func(object interface{}) {
+			if pod, ok := object.(*corev1.Pod); ok {
+				detector.forgetPod(pod)
+			}
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = factory.Core().V1().Nodes().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(object interface{}) {
+			detector.node(nil, object.(*corev1.Node))
+		},
+		UpdateFunc: func(old, object interface{}) {
+			detector.node(old.(*corev1.Node), object.(*corev1.Node))
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	// Only the warning events are listed, the normal ones are far more
+	eventFactory := informers.NewSharedInformerFactoryWithOptions(client.Clientset, 0,
+		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.FieldSelector = "type=" + corev1.EventTypeWarning
+		}))
+
+	_, err = eventFactory.Core().V1().Events().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(object interface{}) {
+			detector.event(object.(*corev1.Event))
+		},
+		UpdateFunc: func(_, object interface{}) {
+			detector.event(object.(*corev1.Event))
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	factory.Start(ctx.Done())
+	eventFactory.Start(ctx.Done())
+	return nil
+}
+
+// notify drops the events already sent within the dedupe window, then sends
+// the remaining ones every group interval, in one message per chat.
+func (self *alertImpl) notify(
+	ctx context.Context,
+	events <-chan Event,
+	bot telegram.Telegram,
+	queue telegram.Queue,
+	logger logs.Logger,
+) error {
+	ticker := time.NewTicker(self.groupInterval)
+	defer ticker.Stop()
+
+	// sent keeps when each problem was last reported, to drop its repeats
+	// within the dedupe window, while open keeps the problems waiting for
+	// their resolution however long they last
+	sent := make(map[string]time.Time)
+	open := make(map[string]bool)
+	pending := make([]Event, 0)
+
+	for {
+		select {
+		case <-ctx.Done():
+			self.flush(pending, bot, queue, logger)
+			return nil
+
+		case event := <-events:
+			key := event.key()
+
+			if event.Resolved {
+				// Only the problems which were reported are resolved
+				if !open[key] {
+					continue
+				}
+
+				delete(open, key)
+				delete(sent, key)
+			} else {
+				if last, ok := sent[key]; ok && time.Since(last) < self.dedupeWindow {
+					continue
+				}
+
+				sent[key] = time.Now()
+
+				if resolves(event.Rule) {
+					open[key] = true
+				}
+			}
+
+			pending = append(pending, event)
+
+		case <-ticker.C:
+			self.flush(pending, bot, queue, logger)
+			pending = pending[:0]
+
+			for key, last := range sent {
+				if time.Since(last) >= self.dedupeWindow {
+					delete(sent, key)
+				}
+			}
+		}
+	}
+}
+
+// flush sends the events to the chats subscribed to them.
+func (self *alertImpl) flush(events []Event, bot telegram.Telegram, queue telegram.Queue, logger logs.Logger) {
+	if len(events) == 0 {
+		return
+	}
+
+	subscriptions, err := self.subscriptions()
+	if err != nil {
+		logger.Errorf("Fail loading the subscriptions, %d alert(s) are lost: %v", len(events), err)
+		return
+	}
+
+	chats := make(map[int64][]Event)
+
+	for _, event := range events {
+		matched := make(map[int64]bool)
+
+		for _, subscription := range subscriptions {
+			if !matched[subscription.ChatID] && subscription.Match(event) {
+				matched[subscription.ChatID] = true
+				chats[subscription.ChatID] = append(chats[subscription.ChatID], event)
+			}
+		}
+	}
+
+	for chatId, events := range chats {
+		builder := formatEvents(events)
+		result := queue.Enqueue(chatId, func(chatId int64) error {
+			_, err := bot.SendMessage(builder.Config(chatId))
+			return err
+		})
+
+		go func(chatId int64) {
+			if err := <-result; err != nil {
+				logger.Errorf("Fail sending alerts to chat %d: %v", chatId, err)
+			}
+		}(chatId)
+	}
+}
+
+// formatEvents groups the events by cluster and rule.
+func formatEvents(events []Event) render.Builder {
+	sort.SliceStable(events, func(i, j int) bool {
+		if events[i].Cluster != events[j].Cluster {
+			return events[i].Cluster < events[j].Cluster
+		}
+
+		return events[i].Rule < events[j].Rule
+	})
+
+	firing := 0
+	for _, event := range events {
+		if !event.Resolved {
+			firing++
+		}
+	}
+
+	title := fmt.Sprintf("🚨 %d alert(s)", firing)
+	if firing == 0 {
+		title = "✅ Resolved"
+	} else if firing < len(events) {
+		title += fmt.Sprintf(", %d resolved", len(events)-firing)
+	}
+
+	builder := render.NewHTML().Bold(title).Line("")
+	group := ""
+
+	for i, event := range events {
+		if i == maxEventsPerMessage {
+			builder.Line(fmt.Sprintf("… and %d more", len(events)-i))
+			break
+		}
+
+		if current := event.Cluster + " " + event.Rule; current != group {
+			group = current
+			builder.Line("").Bold(fmt.Sprintf("%s on cluster %s", event.Rule, event.Cluster)).Line("")
+		}
+
+		icon := "•"
+		if event.Resolved {
+			icon = "✅"
+		}
+
+		builder.Text(icon + " ")
+
+		if len(event.Namespace) > 0 {
+			builder.Code(event.Namespace + "/" + event.Object)
+		} else {
+			builder.Code(event.Object)
+		}
+
+		builder.Line(fmt.Sprintf(" %s (%s)", event.Message, event.Time.UTC().Format("15:04:05")))
+	}
+
+	return builder
+}
@@ -0,0 +1,133 @@
+package alertmanager
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// requestTimeout bounds every call to Alertmanager.
+const requestTimeout = 30 * time.Second
+
+// Client calls the API v2 of Alertmanager.
+type Client interface {
+	// SilenceURL returns the link to a silence in the web UI.
+	SilenceURL(id string) string
+
+	// Silence mutes the alerts having every label of matchers for duration
+	// and returns the id of the silence.
+	Silence(matchers map[string]string, duration time.Duration, createdBy, comment string) (string, error)
+}
+
+type clientImpl struct {
+	baseURL string
+	token   string
+	client  *http.Client
+}
+
+// NewClient talks to the Alertmanager at baseURL, e.g.
+// http://alertmanager.monitoring:9093, with token as bearer token if it
+// isn't empty.
+func NewClient(baseURL, token string) Client {
+	return &clientImpl{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		token:   token,
+		client:  &http.Client{Timeout: requestTimeout},
+	}
+}
+
+func (self *clientImpl) SilenceURL(id string) string {
+	return fmt.Sprintf("%s/#/silences/%s", self.baseURL, id)
+}
+
+func (self *clientImpl) Silence(
+	matchers map[string]string,
+	duration time.Duration,
+	createdBy, comment string,
+) (string, error) {
+	type matcher struct {
+		Name    string `json:"name"`
+		Value   string `json:"value"`
+		IsRegex bool   `json:"isRegex"`
+		IsEqual bool   `json:"isEqual"`
+	}
+
+	names := make([]string, 0, len(matchers))
+	for name := range matchers {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	silence := struct {
+		Matchers  []matcher `json:"matchers"`
+		StartsAt  time.Time `json:"startsAt"`
+		EndsAt    time.Time `json:"endsAt"`
+		CreatedBy string    `json:"createdBy"`
+		Comment   string    `json:"comment"`
+	}{
+		StartsAt:  time.Now().UTC(),
+		EndsAt:    time.Now().UTC().Add(duration),
+		CreatedBy: createdBy,
+		Comment:   comment,
+	}
+
+	for _, name := range names {
+		silence.Matchers = append(silence.Matchers, matcher{
+			Name:    name,
+			Value:   matchers[name],
+			IsEqual: true,
+		})
+	}
+
+	result := struct {
+		SilenceID string `json:"silenceID"`
+	}{}
+
+	err := self.request(http.MethodPost, "/api/v2/silences", silence, &result)
+	return result.SilenceID, err
+}
+
+func (self *clientImpl) request(method, path string, params, result interface{}) error {
+	encoded, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequest(method, self.baseURL+path, bytes.NewReader(encoded))
+	if err != nil {
+		return err
+	}
+
+	request.Header.Set("Accept", "application/json")
+	request.Header.Set("Content-Type", "application/json")
+
+	if len(self.token) > 0 {
+		request.Header.Set("Authorization", "Bearer "+self.token)
+	}
+
+	resp, err := self.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		// The API answers its errors as a JSON string or as plain text
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		message := strings.Trim(strings.TrimSpace(string(body)), `"`)
+
+		if len(message) == 0 {
+			message = resp.Status
+		}
+
+		return fmt.Errorf("Alertmanager fails to %s %s: %s", method, path, message)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(result)
+}
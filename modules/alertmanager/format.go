@@ -0,0 +1,114 @@
+package alertmanager
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/render"
+)
+
+// maxAlertsPerMessage keeps a notification below the size limit of a
+// message, the remaining alerts are only counted.
+const maxAlertsPerMessage = 20
+
+// formatGroup renders the alerts of a notification routed to a chat: the
+// labels shared by the group once, then what differs for each alert.
+func formatGroup(webhook *Webhook, alerts []Alert, ack *acknowledgement) render.Builder {
+	firing := 0
+	for _, alert := range alerts {
+		if alert.Status == StatusFiring {
+			firing++
+		}
+	}
+
+	title := fmt.Sprintf("🔥 FIRING: %s", webhook.name())
+	if firing == 0 {
+		title = fmt.Sprintf("✅ RESOLVED: %s", webhook.name())
+	} else if firing < len(alerts) {
+		title += fmt.Sprintf(" (%d firing, %d resolved)", firing, len(alerts)-firing)
+	} else if firing > 1 {
+		title += fmt.Sprintf(" (%d)", firing)
+	}
+
+	builder := render.NewHTML().Bold(title).Line("")
+
+	if labels := formatLabels(webhook.CommonLabels, nil); len(labels) > 0 {
+		builder.Code(labels).Line("")
+	}
+
+	for _, name := range []string{"summary", "description"} {
+		if value, ok := webhook.CommonAnnotations[name]; ok {
+			builder.Line(value)
+		}
+	}
+
+	for i, alert := range alerts {
+		if i == maxAlertsPerMessage {
+			builder.Line(fmt.Sprintf("… and %d more", len(alerts)-i))
+			break
+		}
+
+		builder.Line("")
+
+		icon := "🔥"
+		if alert.Status != StatusFiring {
+			icon = "✅"
+		}
+
+		builder.Text(icon + " ")
+
+		if labels := formatLabels(alert.Labels, webhook.CommonLabels); len(labels) > 0 {
+			builder.Code(labels).Line("")
+		} else {
+			builder.Line(webhook.name())
+		}
+
+		for _, name := range []string{"summary", "description"} {
+			if _, common := webhook.CommonAnnotations[name]; !common && len(alert.Annotations[name]) > 0 {
+				builder.Line(alert.Annotations[name])
+			}
+		}
+
+		if alert.Status == StatusFiring {
+			builder.Text(fmt.Sprintf("Since %s", alert.StartsAt.UTC().Format(time.RFC1123)))
+		} else {
+			builder.Text(fmt.Sprintf("Resolved after %s", alert.EndsAt.Sub(alert.StartsAt).Round(time.Second)))
+		}
+
+		if len(alert.GeneratorURL) > 0 {
+			builder.Text(" · ").Link("source", alert.GeneratorURL)
+		}
+
+		builder.Line("")
+	}
+
+	if ack != nil {
+		builder.Line("").Line(fmt.Sprintf("🙋 Acknowledged by %s at %s",
+			ack.Name, ack.Time.UTC().Format(time.RFC1123)))
+	}
+
+	return builder
+}
+
+// formatLabels prints the labels which aren't in common, sorted and without
+// alertname, which is in the title.
+func formatLabels(labels, common map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+
+	for name, value := range labels {
+		if name == "alertname" {
+			continue
+		}
+
+		if commonValue, ok := common[name]; ok && commonValue == value {
+			continue
+		}
+
+		pairs = append(pairs, fmt.Sprintf("%s=%s", name, value))
+	}
+
+	sort.Strings(pairs)
+	return strings.Join(pairs, " ")
+}
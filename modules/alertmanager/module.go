@@ -0,0 +1,518 @@
+package alertmanager
+
+import (
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/audit"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/container"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/mux"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/rbac"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/render"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/state"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/telegram"
+)
+
+const ModuleName = "alertmanager"
+
+const (
+	StatusFiring   = "firing"
+	StatusResolved = "resolved"
+
+	// groupTTL keeps the groups long enough to silence or acknowledge them
+	// from an old notification.
+	groupTTL = 7 * 24 * time.Hour
+
+	// deliveredTTL remembers the chats which got a notification while
+	// Alertmanager retries it, it's shorter than the repeat_interval of
+	// Alertmanager, 4h by default, so that the repeated notifications are
+	// delivered again.
+	deliveredTTL = time.Hour
+)
+
+// silenceDurations are offered as buttons under a firing notification.
+var silenceDurations = []time.Duration{time.Hour, 4 * time.Hour, 24 * time.Hour}
+
+// Webhook is the payload Alertmanager posts to a webhook receiver, version 4.
+type Webhook struct {
+	Version           string            `json:"version"`
+	GroupKey          string            `json:"groupKey"`
+	Status            string            `json:"status"`
+	Receiver          string            `json:"receiver"`
+	GroupLabels       map[string]string `json:"groupLabels"`
+	CommonLabels      map[string]string `json:"commonLabels"`
+	CommonAnnotations map[string]string `json:"commonAnnotations"`
+	ExternalURL       string            `json:"externalURL"`
+	Alerts            []Alert           `json:"alerts"`
+}
+
+// name is what the notification is about, the alertname usually.
+func (self *Webhook) name() string {
+	for _, labels := range []map[string]string{self.GroupLabels, self.CommonLabels} {
+		if name, ok := labels["alertname"]; ok {
+			return name
+		}
+	}
+
+	return self.Receiver
+}
+
+// Alert is an alert of a Webhook.
+type Alert struct {
+	Status       string            `json:"status"`
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations"`
+	StartsAt     time.Time         `json:"startsAt"`
+	EndsAt       time.Time         `json:"endsAt"`
+	GeneratorURL string            `json:"generatorURL"`
+	Fingerprint  string            `json:"fingerprint"`
+}
+
+type Alertmanager interface {
+	container.Module
+
+	HandleCallback(ctx *mux.CallbackContext) error
+
+	// Authorize checks the bearer token of a request posting a webhook.
+	Authorize(authorization string) bool
+
+	// Receive sends the alerts of webhook to the chats of the matching
+	// routes.
+	Receive(bot telegram.Telegram, webhook *Webhook) error
+}
+
+// group is what the buttons of a notification act on, saved since a
+// callback can't carry the labels.
+type group struct {
+	Name     string            `json:"name"`
+	Matchers map[string]string `json:"matchers"`
+	Cluster  string            `json:"cluster"`
+}
+
+// acknowledgement tells who is handling a group of alerts.
+type acknowledgement struct {
+	Name   string    `json:"name"`
+	UserID int64     `json:"user_id"`
+	Time   time.Time `json:"time"`
+}
+
+type alertmanagerImpl struct {
+	store        state.Store
+	routes       []route
+	client       Client
+	token        string
+	clusterLabel string
+	queue        telegram.Queue
+}
+
+// NewModule routes the alerts posted by Alertmanager to the chats of
+// $ALERTMANAGER_ROUTES. The requests must carry $ALERTMANAGER_TOKEN as
+// bearer token. The silences are created in the Alertmanager
+// at $ALERTMANAGER_URL, with $ALERTMANAGER_API_TOKEN, and checked against
+// the role of the user on the cluster named by the label
+// $ALERTMANAGER_CLUSTER_LABEL, default to cluster.
+func NewModule(store state.Store) Alertmanager {
+	return &alertmanagerImpl{
+		store: store,
+	}
+}
+
+func (self *alertmanagerImpl) Init() error {
+	spec := os.Getenv("ALERTMANAGER_ROUTES")
+	if len(spec) == 0 {
+		return errors.New("ALERTMANAGER_ROUTES must be set")
+	}
+
+	routes, err := parseRoutes(spec)
+	if err != nil {
+		return err
+	}
+
+	self.routes = routes
+	self.queue = telegram.NewQueue(telegram.QueueConfig{})
+
+	// The receiver is public, anybody could post alerts with buttons
+	self.token = os.Getenv("ALERTMANAGER_TOKEN")
+	if len(self.token) == 0 {
+		return errors.New("ALERTMANAGER_TOKEN must be set")
+	}
+
+	self.clusterLabel = os.Getenv("ALERTMANAGER_CLUSTER_LABEL")
+	if len(self.clusterLabel) == 0 {
+		self.clusterLabel = "cluster"
+	}
+
+	if baseURL := os.Getenv("ALERTMANAGER_URL"); len(baseURL) > 0 {
+		self.client = NewClient(baseURL, os.Getenv("ALERTMANAGER_API_TOKEN"))
+	}
+
+	return nil
+}
+
+func (self *alertmanagerImpl) Deinit() error {
+	if self.queue != nil {
+		self.queue.Close()
+	}
+
+	return nil
+}
+
+func (self *alertmanagerImpl) Authorize(authorization string) bool {
+	expected := []byte("Bearer " + self.token)
+	return subtle.ConstantTimeCompare([]byte(authorization), expected) == 1
+}
+
+func (self *alertmanagerImpl) Receive(bot telegram.Telegram, webhook *Webhook) error {
+	id := groupID(webhook.GroupKey)
+
+	labels := webhook.GroupLabels
+	if len(labels) == 0 {
+		labels = webhook.CommonLabels
+	}
+
+	cluster := webhook.CommonLabels[self.clusterLabel]
+	matchers := make(map[string]string, len(labels)+1)
+
+	for name, value := range labels {
+		matchers[name] = value
+	}
+
+	// A silence mustn't reach the alerts of the other clusters
+	if len(cluster) > 0 {
+		matchers[self.clusterLabel] = cluster
+	}
+
+	err := self.store.Set(groupKey(id), group{
+		Name:     webhook.name(),
+		Matchers: matchers,
+		Cluster:  cluster,
+	}, groupTTL)
+	if err != nil {
+		return err
+	}
+
+	ack := &acknowledgement{}
+
+	found, err := self.store.Get(ackKey(id), ack)
+	if err != nil {
+		return err
+	}
+
+	if !found {
+		ack = nil
+	}
+
+	// A chat gets the alerts of every route it matches in one message
+	chats := make([]int64, 0)
+	alerts := make(map[int64][]Alert)
+
+	for _, alert := range webhook.Alerts {
+		routed := make(map[int64]bool)
+
+		for _, route := range self.routes {
+			if routed[route.chatId] || !route.match(alert.Labels) {
+				continue
+			}
+
+			if _, ok := alerts[route.chatId]; !ok {
+				chats = append(chats, route.chatId)
+			}
+
+			routed[route.chatId] = true
+			alerts[route.chatId] = append(alerts[route.chatId], alert)
+		}
+	}
+
+	notification := notificationID(webhook)
+	results := make(map[int64]<-chan error)
+
+	for _, chatId := range chats {
+		// Alertmanager retries the whole group when a chat fails, the
+		// chats which already got it don't get it twice
+		delivered, err := self.store.Get(deliveredKey(id, notification, chatId), new(bool))
+		if err != nil {
+			return err
+		}
+
+		if delivered {
+			continue
+		}
+
+		config := formatGroup(webhook, alerts[chatId], ack).Config(chatId)
+		config.DisableWebPagePreview = true
+
+		// Once acknowledged, only the silences are left to offer
+		if webhook.Status == StatusFiring && (self.client != nil || ack == nil) {
+			keyboard, err := self.keyboard(id, ack)
+			if err != nil {
+				return err
+			}
+
+			config.ReplyMarkup = keyboard
+		}
+
+		// The queue follows the flood limits and the migrated groups, the
+		// descriptions of the alerts may exceed the size of a message
+		results[chatId] = self.queue.Enqueue(chatId, func(chatId int64) error {
+			config.ChatID = chatId
+
+			_, err := bot.SendLongMessage(telegram.LongMessageConfig{
+				MessageConfig:     config,
+				DocumentThreshold: -1,
+			})
+			return err
+		})
+	}
+
+	failures := make([]string, 0)
+
+	for _, chatId := range chats {
+		result, ok := results[chatId]
+		if !ok {
+			continue
+		}
+
+		if err = <-result; err != nil {
+			failures = append(failures, fmt.Sprintf("chat %d: %v", chatId, err))
+			continue
+		}
+
+		if err = self.store.Set(deliveredKey(id, notification, chatId), true, deliveredTTL); err != nil {
+			return err
+		}
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf("Fail sending the alerts to %s", strings.Join(failures, "; "))
+	}
+
+	// The group firing again later is a new incident to acknowledge
+	if webhook.Status == StatusResolved {
+		if err = self.store.Delete(ackKey(id)); err != nil {
+			return err
+		}
+
+		return self.store.Delete(ackLockKey(id))
+	}
+
+	return nil
+}
+
+func (self *alertmanagerImpl) keyboard(id string, ack *acknowledgement) (*telegram.InlineKeyboardMarkup, error) {
+	codec, err := mux.DefaultCodec()
+	if err != nil {
+		return nil, err
+	}
+
+	keyboard := mux.NewKeyboard(codec, groupTTL)
+
+	if self.client != nil {
+		for _, duration := range silenceDurations {
+			keyboard.Button("🔕 "+formatDuration(duration), mux.Callback{
+				Module: ModuleName,
+				Action: "silence",
+				Args:   map[string]string{"id": id, "duration": duration.String()},
+			})
+		}
+
+		keyboard.Row()
+	}
+
+	if ack == nil {
+		keyboard.Button("🙋 Acknowledge", mux.Callback{
+			Module: ModuleName,
+			Action: "ack",
+			Args:   map[string]string{"id": id},
+		})
+	}
+
+	return keyboard.Markup()
+}
+
+// HandleCallback silences or acknowledges the group of a notification, the
+// operators of the cluster of the alerts only.
+func (self *alertmanagerImpl) HandleCallback(ctx *mux.CallbackContext) error {
+	id := ctx.Callback.Args["id"]
+	current := &group{}
+
+	found, err := self.store.Get(groupKey(id), current)
+	if err != nil {
+		return err
+	}
+
+	if !found {
+		return ctx.Alert("These alerts have expired")
+	}
+
+	ctx.Audit.Target(current.Cluster, "", "alert/"+current.Name)
+
+	// The alerts of several clusters are left to the operators of them all
+	cluster := current.Cluster
+	if len(cluster) == 0 {
+		cluster = rbac.AllClusters
+	}
+
+	allowed, err := rbac.Allowed(ctx.Query.From.ID, cluster, rbac.RoleOperator)
+	if err != nil {
+		return err
+	}
+
+	if !allowed {
+		ctx.Audit.Result = audit.ResultDenied
+
+		if len(current.Cluster) == 0 {
+			return ctx.Alert("These alerts have no " + self.clusterLabel +
+				" label, only the operators of every cluster can handle them")
+		}
+
+		return ctx.Alert("Only operators can handle these alerts")
+	}
+
+	switch ctx.Callback.Action {
+	case "silence":
+		return self.silence(ctx, current)
+
+	case "ack":
+		return self.acknowledge(ctx, id, current)
+
+	default:
+		return ctx.Alert("Unknown action " + ctx.Callback.Action)
+	}
+}
+
+func (self *alertmanagerImpl) silence(ctx *mux.CallbackContext, current *group) error {
+	if self.client == nil {
+		return ctx.Alert("ALERTMANAGER_URL isn't set, the alerts can't be silenced")
+	}
+
+	duration, err := time.ParseDuration(ctx.Callback.Args["duration"])
+	if err != nil {
+		return ctx.Alert("Invalid duration " + ctx.Callback.Args["duration"])
+	}
+
+	user := ctx.Query.From
+	silenceId, err := self.client.Silence(current.Matchers, duration,
+		fmt.Sprintf("%s (telegram %d)", user.FirstName, user.ID),
+		"Silenced from Telegram")
+	if err != nil {
+		ctx.Audit.Result = audit.ResultFailed
+		ctx.Audit.Error = err.Error()
+		return ctx.Alert(err.Error())
+	}
+
+	ctx.Audit.Target(current.Cluster, "", "silence/"+silenceId)
+
+	if err = self.reply(ctx, fmt.Sprintf("🔕 %s is silenced for %s by ",
+		current.Name, formatDuration(duration)), self.client.SilenceURL(silenceId)); err != nil {
+		return err
+	}
+
+	return ctx.Toast("Silenced")
+}
+
+func (self *alertmanagerImpl) acknowledge(ctx *mux.CallbackContext, id string, current *group) error {
+	// Two users pressing the button together mustn't both acknowledge
+	taken, err := self.store.Lock(ackLockKey(id), ctx.Query.ID, groupTTL)
+	if err != nil {
+		return err
+	}
+
+	if !taken {
+		ack := &acknowledgement{}
+
+		found, err := self.store.Get(ackKey(id), ack)
+		if err != nil {
+			return err
+		}
+
+		if !found {
+			return ctx.Alert("These alerts are being acknowledged")
+		}
+
+		return ctx.Alert(fmt.Sprintf("%s already acknowledged these alerts", ack.Name))
+	}
+
+	err = self.store.Set(ackKey(id), acknowledgement{
+		Name:   ctx.Query.From.FirstName,
+		UserID: ctx.Query.From.ID,
+		Time:   time.Now(),
+	}, groupTTL)
+	if err != nil {
+		return err
+	}
+
+	if err = self.reply(ctx, fmt.Sprintf("🙋 %s is acknowledged by ", current.Name), ""); err != nil {
+		return err
+	}
+
+	return ctx.Toast("Acknowledged")
+}
+
+// reply answers the notification with text followed by the mention of the
+// user who pressed the button, and a link when it isn't empty.
+func (self *alertmanagerImpl) reply(ctx *mux.CallbackContext, text, link string) error {
+	builder := render.NewHTML().Text(text).Mention(ctx.Query.From.FirstName, ctx.Query.From.ID)
+	if len(link) > 0 {
+		builder.Text(" · ").Link("silence", link)
+	}
+
+	config := builder.Config(ctx.ChatID())
+	if ctx.Query.Message != nil {
+		config.ReplyToMessageID = ctx.Query.Message.MessageID
+	}
+
+	_, err := ctx.Telegram.SendMessage(config)
+	return err
+}
+
+// groupID shortens the group key of Alertmanager, which is too long for a
+// store key, while keeping it stable across the notifications of a group.
+func groupID(key string) string {
+	sum := sha1.Sum([]byte(key))
+	return hex.EncodeToString(sum[:8])
+}
+
+func groupKey(id string) string {
+	return "alertmanager:group:" + id
+}
+
+func ackKey(id string) string {
+	return "alertmanager:ack:" + id
+}
+
+func ackLockKey(id string) string {
+	return "alertmanager:ack:lock:" + id
+}
+
+// notificationID tells the notifications of a group apart, a retry carries
+// the same alerts in the same states.
+func notificationID(webhook *Webhook) string {
+	states := make([]string, 0, len(webhook.Alerts))
+	for _, alert := range webhook.Alerts {
+		states = append(states, alert.Fingerprint+"="+alert.Status)
+	}
+
+	sort.Strings(states)
+
+	sum := sha1.Sum([]byte(webhook.Status + ";" + strings.Join(states, ",")))
+	return hex.EncodeToString(sum[:8])
+}
+
+func deliveredKey(id, notification string, chatId int64) string {
+	return fmt.Sprintf("alertmanager:delivered:%s:%s:%d", id, notification, chatId)
+}
+
+func formatDuration(duration time.Duration) string {
+	if duration%(24*time.Hour) == 0 {
+		return fmt.Sprintf("%dd", duration/(24*time.Hour))
+	}
+
+	return fmt.Sprintf("%dh", duration/time.Hour)
+}
@@ -0,0 +1,112 @@
+package alertmanager
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// matcher compares a label like the matchers of Alertmanager, e.g.
+// severity=critical, team!=db or service=~api|web.
+type matcher struct {
+	name     string
+	negative bool
+	value    string
+	pattern  *regexp.Regexp
+}
+
+func (self matcher) match(labels map[string]string) bool {
+	value := labels[self.name]
+
+	matched := value == self.value
+	if self.pattern != nil {
+		matched = self.pattern.MatchString(value)
+	}
+
+	return matched != self.negative
+}
+
+// route sends the alerts matching every matcher to a chat, a route without
+// matcher receives every alert.
+type route struct {
+	chatId   int64
+	matchers []matcher
+}
+
+func (self route) match(labels map[string]string) bool {
+	for _, matcher := range self.matchers {
+		if !matcher.match(labels) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// parseRoutes reads the `;` separated routes of $ALERTMANAGER_ROUTES, each
+// one looking like <chat id>[:<matcher>,<matcher>...].
+func parseRoutes(spec string) ([]route, error) {
+	routes := make([]route, 0)
+
+	for _, item := range strings.Split(spec, ";") {
+		item = strings.TrimSpace(item)
+		if len(item) == 0 {
+			continue
+		}
+
+		parts := strings.SplitN(item, ":", 2)
+
+		chatId, err := strconv.ParseInt(strings.TrimSpace(parts[0]), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Route %q must start with a chat id", item)
+		}
+
+		current := route{chatId: chatId}
+
+		if len(parts) == 2 {
+			for _, expression := range strings.Split(parts[1], ",") {
+				matcher, err := parseMatcher(strings.TrimSpace(expression))
+				if err != nil {
+					return nil, fmt.Errorf("Route %q: %v", item, err)
+				}
+
+				current.matchers = append(current.matchers, matcher)
+			}
+		}
+
+		routes = append(routes, current)
+	}
+
+	return routes, nil
+}
+
+func parseMatcher(expression string) (matcher, error) {
+	// The two-character operators go first since they contain =
+	for _, operator := range []string{"=~", "!~", "!=", "="} {
+		index := strings.Index(expression, operator)
+		if index <= 0 {
+			continue
+		}
+
+		result := matcher{
+			name:     strings.TrimSpace(expression[:index]),
+			negative: operator[0] == '!',
+			value:    strings.Trim(strings.TrimSpace(expression[index+len(operator):]), `"`),
+		}
+
+		if strings.HasSuffix(operator, "~") {
+			// Alertmanager anchors its regular expressions
+			pattern, err := regexp.Compile("^(?:" + result.value + ")$")
+			if err != nil {
+				return result, fmt.Errorf("Matcher %q has an invalid regexp: %v", expression, err)
+			}
+
+			result.pattern = pattern
+		}
+
+		return result, nil
+	}
+
+	return matcher{}, fmt.Errorf("Matcher %q must look like <label><=|!=|=~|!~><value>", expression)
+}
@@ -0,0 +1,615 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/dynamic"
+	sigsyaml "sigs.k8s.io/yaml"
+
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/audit"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/mux"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/rbac"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/render"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/telegram"
+)
+
+const (
+	// FieldManager owns the fields applied by the bot.
+	FieldManager = "telegram-bot"
+
+	maxManifestSize = 1 << 20
+	applyTTL        = 15 * time.Minute
+	requestTimeout  = 30 * time.Second
+)
+
+// pendingApply is a manifest waiting for the confirmation of its uploader.
+type pendingApply struct {
+	ChatID    int64     `json:"chat_id"`
+	UserID    int64     `json:"user_id"`
+	Selection Selection `json:"selection"`
+	FileName  string    `json:"file_name"`
+	Manifest  []byte    `json:"manifest"`
+}
+
+// applyResult is the outcome of applying one object of a manifest.
+type applyResult struct {
+	reference string
+	diff      string
+	action    string
+	err       error
+}
+
+// reviewManifest downloads a YAML or JSON document, validates it and replies
+// with its server-side dry-run diff against the selected cluster together
+// with the commands to confirm or discard it.
+func (self *clusterImpl) reviewManifest(ctx *mux.Context) (bool, error) {
+	document := ctx.Message.Document
+
+	switch strings.ToLower(filepath.Ext(document.FileName)) {
+	case ".yaml", ".yml", ".json":
+	default:
+		return false, nil
+	}
+
+	ctx.Audit.Describe("apply", document.FileName)
+
+	if ctx.Message.From == nil {
+		return true, self.reply(ctx, "Manifests sent on behalf of a chat can't be applied", nil)
+	}
+
+	if document.FileSize > maxManifestSize {
+		return true, self.reply(ctx, fmt.Sprintf("%s is larger than %d bytes",
+			document.FileName, maxManifestSize), nil)
+	}
+
+	selection, err := self.Selection(ctx.Message.Chat.ID)
+	if err != nil {
+		return true, self.reply(ctx, err.Error(), nil)
+	}
+
+	ctx.Audit.Target(selection.Cluster, selection.Namespace, document.FileName)
+
+	allowed, err := rbac.Allowed(ctx.Message.From.ID, selection.Cluster, rbac.RoleAdmin)
+	if err != nil {
+		return true, err
+	}
+
+	if !allowed {
+		ctx.Audit.Result = audit.ResultDenied
+		return true, self.reply(ctx, fmt.Sprintf("You aren't allowed to apply manifests to cluster %s",
+			selection.Cluster), nil)
+	}
+
+	file, err := ctx.Telegram.GetFile(document.FileID)
+	if err != nil {
+		return true, err
+	}
+
+	manifest, err := ctx.Telegram.DownloadFile(file, maxManifestSize)
+	if err != nil {
+		return true, err
+	}
+
+	results, err := self.applyManifest(selection, manifest, true)
+	if err != nil {
+		return true, self.reply(ctx, fmt.Sprintf("%s is invalid: %v",
+			document.FileName, err), nil)
+	}
+
+	report := formatResults(results, true).Config(ctx.Message.Chat.ID)
+	report.ReplyToMessageID = ctx.Message.MessageID
+
+	if _, err = ctx.Telegram.SendLongMessage(telegram.LongMessageConfig{
+		MessageConfig: report,
+		FileName:      strings.TrimSuffix(document.FileName, filepath.Ext(document.FileName)) + ".diff",
+		Document:      diffOf(results),
+		Caption:       "Dry-run diff of " + document.FileName,
+	}); err != nil {
+		return true, err
+	}
+
+	for _, result := range results {
+		if result.err != nil {
+			return true, self.reply(ctx, "Please fix the errors above and send the manifest again", nil)
+		}
+	}
+
+	id, err := newApplyID()
+	if err != nil {
+		return true, err
+	}
+
+	err = self.store.Set(applyKey(id), pendingApply{
+		ChatID:    ctx.Message.Chat.ID,
+		UserID:    ctx.Message.From.ID,
+		Selection: selection,
+		FileName:  document.FileName,
+		Manifest:  manifest,
+	}, applyTTL)
+	if err != nil {
+		return true, err
+	}
+
+	ctx.Audit.Confirm(audit.ConfirmationPending)
+
+	codec, err := mux.DefaultCodec()
+	if err != nil {
+		return true, err
+	}
+
+	keyboard, err := mux.NewKeyboard(codec, applyTTL).
+		Button("Apply", mux.Callback{
+			Module: ModuleName,
+			Action: "apply",
+			Args:   map[string]string{"id": id},
+			UserID: ctx.Message.From.ID,
+		}).
+		Button("Discard", mux.Callback{
+			Module: ModuleName,
+			Action: "discard",
+			Args:   map[string]string{"id": id},
+			UserID: ctx.Message.From.ID,
+		}).
+		Markup()
+	if err != nil {
+		return true, err
+	}
+
+	return true, self.reply(ctx,
+		fmt.Sprintf("Apply %s to cluster %s? This request expires in %s, "+
+			"you can also confirm it with /apply %s.",
+			document.FileName, selection.Cluster, applyTTL, id),
+		keyboard)
+}
+
+func (self *clusterImpl) confirmApply(ctx *mux.Context) error {
+	pending, id, err := self.pendingApply(ctx)
+	if pending == nil || err != nil {
+		return err
+	}
+
+	if err = self.store.Delete(applyKey(id)); err != nil {
+		return err
+	}
+
+	ctx.Audit.Target(pending.Selection.Cluster, pending.Selection.Namespace, pending.FileName)
+	ctx.Audit.Confirm(audit.ConfirmationConfirmed)
+
+	results, err := self.applyManifest(pending.Selection, pending.Manifest, false)
+	if err != nil {
+		return self.reply(ctx, err.Error(), nil)
+	}
+
+	auditResults(ctx.Audit, results)
+
+	report := formatResults(results, false).Config(ctx.Message.Chat.ID)
+	report.ReplyToMessageID = ctx.Message.MessageID
+
+	_, err = ctx.Telegram.SendLongMessage(telegram.LongMessageConfig{
+		MessageConfig: report,
+	})
+	return err
+}
+
+func (self *clusterImpl) discardApply(ctx *mux.Context) error {
+	pending, id, err := self.pendingApply(ctx)
+	if pending == nil || err != nil {
+		return err
+	}
+
+	if err = self.store.Delete(applyKey(id)); err != nil {
+		return err
+	}
+
+	ctx.Audit.Target(pending.Selection.Cluster, pending.Selection.Namespace, pending.FileName)
+	ctx.Audit.Confirm(audit.ConfirmationDiscarded)
+
+	return self.reply(ctx, pending.FileName+" is discarded", nil)
+}
+
+// answerApply applies or discards a manifest when its uploader presses one
+// of the buttons of the review, the review is edited to show the outcome.
+func (self *clusterImpl) answerApply(ctx *mux.CallbackContext) error {
+	id := ctx.Callback.Args["id"]
+	pending := &pendingApply{}
+
+	found, err := self.store.Get(applyKey(id), pending)
+	if err != nil {
+		return err
+	}
+
+	if !found || pending.ChatID != ctx.ChatID() {
+		return ctx.Alert("This manifest doesn't exist or has expired")
+	}
+
+	// Two presses served together mustn't both apply the manifest
+	taken, err := self.claimApply(id, ctx.Query.ID)
+	if err != nil {
+		return err
+	}
+
+	if !taken {
+		return ctx.Alert("This manifest is already being applied or discarded")
+	}
+
+	if err = self.store.Delete(applyKey(id)); err != nil {
+		return err
+	}
+
+	ctx.Audit.Target(pending.Selection.Cluster, pending.Selection.Namespace, pending.FileName)
+
+	if ctx.Callback.Action == "discard" {
+		ctx.Audit.Confirm(audit.ConfirmationDiscarded)
+
+		if err = ctx.Edit(render.NewHTML().Text(pending.FileName+" is discarded"), nil); err != nil {
+			return err
+		}
+
+		return ctx.Toast("Discarded")
+	}
+
+	ctx.Audit.Confirm(audit.ConfirmationConfirmed)
+
+	results, err := self.applyManifest(pending.Selection, pending.Manifest, false)
+	if err != nil {
+		return err
+	}
+
+	auditResults(ctx.Audit, results)
+
+	status := render.NewHTML().
+		Text(fmt.Sprintf("%s is applied to cluster %s by ",
+			pending.FileName, pending.Selection.Cluster)).
+		Mention(ctx.Query.From.FirstName, ctx.Query.From.ID)
+
+	if err = ctx.Edit(status, nil); err != nil {
+		return err
+	}
+
+	report := formatResults(results, false).Config(ctx.ChatID())
+	report.ReplyToMessageID = ctx.Query.Message.MessageID
+
+	if _, err = ctx.Telegram.SendLongMessage(telegram.LongMessageConfig{
+		MessageConfig: report,
+	}); err != nil {
+		return err
+	}
+
+	return ctx.Toast("Applied")
+}
+
+// auditResults marks entry as failed when an object couldn't be applied.
+func auditResults(entry *audit.Entry, results []applyResult) {
+	for _, result := range results {
+		if result.err != nil {
+			entry.Result = audit.ResultFailed
+			entry.Error = fmt.Sprintf("%s: %v", result.reference, result.err)
+			return
+		}
+	}
+}
+
+// pendingApply loads the manifest named by the argument of the command, it
+// replies and returns nil when the manifest can't be used by the sender.
+func (self *clusterImpl) pendingApply(ctx *mux.Context) (*pendingApply, string, error) {
+	if len(ctx.Args) != 1 {
+		return nil, "", ctx.Reply(fmt.Sprintf("Usage: /%s <id>, send a manifest first to get its id",
+			ctx.Command))
+	}
+
+	id := ctx.Args[0]
+	pending := &pendingApply{}
+
+	found, err := self.store.Get(applyKey(id), pending)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if !found || pending.ChatID != ctx.Message.Chat.ID {
+		return nil, "", self.reply(ctx, "This manifest doesn't exist or has expired", nil)
+	}
+
+	if ctx.Message.From == nil || ctx.Message.From.ID != pending.UserID {
+		return nil, "", self.reply(ctx, "Only the user who sent the manifest can confirm it", nil)
+	}
+
+	taken, err := self.claimApply(id, fmt.Sprint(ctx.Message.MessageID))
+	if err != nil {
+		return nil, "", err
+	}
+
+	if !taken {
+		return nil, "", self.reply(ctx, "This manifest is already being applied or discarded", nil)
+	}
+
+	return pending, id, nil
+}
+
+// claimApply takes the decision on a pending manifest, only the first
+// request applying or discarding it gets it.
+func (self *clusterImpl) claimApply(id, owner string) (bool, error) {
+	return self.store.Lock(applyKey(id)+":decision", owner, applyTTL)
+}
+
+// applyManifest applies every object of manifest with server-side apply, or
+// only simulates it when dryRun is set. An error is returned when the
+// manifest itself is invalid, while the failures of each object are
+// reported in the results.
+func (self *clusterImpl) applyManifest(
+	selection Selection,
+	manifest []byte,
+	dryRun bool,
+) ([]applyResult, error) {
+	objects, err := parseManifest(manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := self.Client(selection.Cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]applyResult, 0, len(objects))
+
+	for _, object := range objects {
+		results = append(results, applyObject(client, selection, object, dryRun))
+	}
+
+	return results, nil
+}
+
+func applyObject(
+	client *Client,
+	selection Selection,
+	object *unstructured.Unstructured,
+	dryRun bool,
+) applyResult {
+	gvk := object.GroupVersionKind()
+	result := applyResult{
+		reference: fmt.Sprintf("%s/%s", strings.ToLower(gvk.Kind), object.GetName()),
+	}
+
+	mapping, err := client.Mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		result.err = err
+		return result
+	}
+
+	var resource dynamic.ResourceInterface
+
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		if len(object.GetNamespace()) == 0 {
+			object.SetNamespace(selection.Namespace)
+		}
+
+		resource = client.Dynamic.Resource(mapping.Resource).Namespace(object.GetNamespace())
+		result.reference = fmt.Sprintf("%s/%s/%s",
+			object.GetNamespace(), mapping.Resource.Resource, object.GetName())
+	} else {
+		resource = client.Dynamic.Resource(mapping.Resource)
+		result.reference = fmt.Sprintf("%s/%s", mapping.Resource.Resource, object.GetName())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	live, err := resource.Get(ctx, object.GetName(), metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		live = nil
+	} else if err != nil {
+		result.err = err
+		return result
+	}
+
+	data, err := json.Marshal(object.Object)
+	if err != nil {
+		result.err = err
+		return result
+	}
+
+	// Without force the fields owned by other managers, e.g. the replicas
+	// of an HPA, are reported as conflicts instead of being taken over
+	options := metav1.PatchOptions{
+		FieldManager: FieldManager,
+	}
+
+	if dryRun {
+		options.DryRun = []string{metav1.DryRunAll}
+	}
+
+	applied, err := resource.Patch(ctx, object.GetName(), types.ApplyPatchType, data, options)
+	if err != nil {
+		result.err = err
+		return result
+	}
+
+	if dryRun {
+		result.diff, result.err = diffObjects(result.reference, live, applied)
+	}
+
+	// A dry run always answers the live resourceVersion, only its diff
+	// tells if the object changes
+	switch {
+	case live == nil:
+		result.action = "created"
+	case dryRun && len(result.diff) == 0:
+		result.action = "unchanged"
+	case !dryRun && live.GetResourceVersion() == applied.GetResourceVersion():
+		result.action = "unchanged"
+	default:
+		result.action = "configured"
+	}
+
+	return result
+}
+
+// parseManifest decodes every YAML or JSON document of manifest, expanding
+// the lists, and checks the fields identifying each object.
+func parseManifest(manifest []byte) ([]*unstructured.Unstructured, error) {
+	decoder := yaml.NewYAMLOrJSONDecoder(bytes.NewReader(manifest), 4096)
+	objects := make([]*unstructured.Unstructured, 0)
+
+	for {
+		document := make(map[string]interface{})
+
+		err := decoder.Decode(&document)
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		if len(document) == 0 {
+			continue
+		}
+
+		object := &unstructured.Unstructured{Object: document}
+
+		if object.IsList() {
+			err = object.EachListItem(func(item runtime.Object) error {
+				objects = append(objects, item.(*unstructured.Unstructured))
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		objects = append(objects, object)
+	}
+
+	if len(objects) == 0 {
+		return nil, errors.New("no object is found")
+	}
+
+	for i, object := range objects {
+		if len(object.GetAPIVersion()) == 0 || len(object.GetKind()) == 0 {
+			return nil, fmt.Errorf("object #%d has no apiVersion or kind", i+1)
+		}
+
+		if len(object.GetName()) == 0 {
+			return nil, fmt.Errorf("object #%d (%s) has no metadata.name", i+1, object.GetKind())
+		}
+	}
+
+	return objects, nil
+}
+
+// diffObjects compares the live object with the dry-run result, ignoring the
+// fields maintained by the API server.
+func diffObjects(
+	reference string,
+	live, applied *unstructured.Unstructured,
+) (string, error) {
+	before := ""
+
+	if live != nil {
+		encoded, err := sigsyaml.Marshal(cleanObject(live).Object)
+		if err != nil {
+			return "", err
+		}
+
+		before = string(encoded)
+	}
+
+	after, err := sigsyaml.Marshal(cleanObject(applied).Object)
+	if err != nil {
+		return "", err
+	}
+
+	return unifiedDiff("live/"+reference, "dry-run/"+reference, before, string(after)), nil
+}
+
+func cleanObject(object *unstructured.Unstructured) *unstructured.Unstructured {
+	object = object.DeepCopy()
+
+	object.SetManagedFields(nil)
+	object.SetResourceVersion("")
+	object.SetGeneration(0)
+	object.SetUID("")
+	object.SetCreationTimestamp(metav1.Time{})
+	unstructured.RemoveNestedField(object.Object, "metadata", "creationTimestamp")
+	unstructured.RemoveNestedField(object.Object, "status")
+
+	annotations := object.GetAnnotations()
+	if _, ok := annotations["kubectl.kubernetes.io/last-applied-configuration"]; ok {
+		delete(annotations, "kubectl.kubernetes.io/last-applied-configuration")
+		object.SetAnnotations(annotations)
+	}
+
+	return object
+}
+
+func formatResults(results []applyResult, dryRun bool) render.Builder {
+	builder := render.NewHTML()
+
+	for _, result := range results {
+		builder.Bold(result.reference)
+
+		switch {
+		case apierrors.IsConflict(result.err):
+			builder.Line(" conflicts with the fields of other managers, drop these fields " +
+				"from the manifest or change them with their manager:")
+			builder.Pre(result.err.Error(), "")
+
+		case result.err != nil:
+			builder.Line(": " + result.err.Error())
+
+		case dryRun && len(result.diff) > 0:
+			builder.Line(" " + result.action + " (dry run)")
+			builder.Pre(result.diff, "diff")
+
+		case dryRun:
+			builder.Line(" " + result.action + " (dry run)")
+
+		default:
+			builder.Line(" " + result.action)
+		}
+	}
+
+	return builder
+}
+
+// diffOf concatenates the diffs of results as the content of a .diff file.
+func diffOf(results []applyResult) string {
+	builder := strings.Builder{}
+
+	for _, result := range results {
+		builder.WriteString(result.diff)
+	}
+
+	return builder.String()
+}
+
+func newApplyID() (string, error) {
+	buffer := make([]byte, 4)
+
+	if _, err := rand.Read(buffer); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(buffer), nil
+}
+
+func applyKey(id string) string {
+	return "cluster:apply:" + id
+}
@@ -0,0 +1,163 @@
+package cluster
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	diffContext = 3
+
+	// maxDiffCells bounds the memory used to compare two texts, larger
+	// texts are shown as fully replaced.
+	maxDiffCells = 4000000
+)
+
+type diffLine struct {
+	kind byte
+	text string
+}
+
+// unifiedDiff returns the unified diff between before and after, or an empty
+// string if they are the same.
+func unifiedDiff(fromName, toName, before, after string) string {
+	if before == after {
+		return ""
+	}
+
+	ops := diffLines(splitLines(before), splitLines(after))
+	builder := strings.Builder{}
+
+	builder.WriteString(fmt.Sprintf("--- %s\n+++ %s\n", fromName, toName))
+
+	// beforePos and afterPos are the numbers of lines preceding each op
+	beforePos := make([]int, len(ops)+1)
+	afterPos := make([]int, len(ops)+1)
+
+	for i, op := range ops {
+		beforePos[i+1] = beforePos[i]
+		afterPos[i+1] = afterPos[i]
+
+		if op.kind != '+' {
+			beforePos[i+1]++
+		}
+
+		if op.kind != '-' {
+			afterPos[i+1]++
+		}
+	}
+
+	for k := 0; k < len(ops); {
+		if ops[k].kind == ' ' {
+			k++
+			continue
+		}
+
+		start := k - diffContext
+		if start < 0 {
+			start = 0
+		}
+
+		end := k
+		for end < len(ops) {
+			if ops[end].kind != ' ' {
+				end++
+				continue
+			}
+
+			run := end
+			for run < len(ops) && ops[run].kind == ' ' {
+				run++
+			}
+
+			if run == len(ops) || run-end > 2*diffContext {
+				end += diffContext
+				if end > len(ops) {
+					end = len(ops)
+				}
+				break
+			}
+
+			end = run
+		}
+
+		builder.WriteString(fmt.Sprintf("@@ -%d,%d +%d,%d @@\n",
+			beforePos[start]+1, beforePos[end]-beforePos[start],
+			afterPos[start]+1, afterPos[end]-afterPos[start]))
+
+		for _, op := range ops[start:end] {
+			builder.WriteByte(op.kind)
+			builder.WriteString(op.text)
+			builder.WriteByte('\n')
+		}
+
+		k = end
+	}
+
+	return builder.String()
+}
+
+// diffLines compares the lines using their longest common subsequence.
+func diffLines(before, after []string) []diffLine {
+	ops := make([]diffLine, 0, len(before)+len(after))
+
+	if len(before)*len(after) > maxDiffCells {
+		for _, line := range before {
+			ops = append(ops, diffLine{'-', line})
+		}
+
+		for _, line := range after {
+			ops = append(ops, diffLine{'+', line})
+		}
+
+		return ops
+	}
+
+	// lcs[i][j] is the length of the common subsequence of before[i:] and
+	// after[j:]
+	lcs := make([][]int32, len(before)+1)
+	for i := range lcs {
+		lcs[i] = make([]int32, len(after)+1)
+	}
+
+	for i := len(before) - 1; i >= 0; i-- {
+		for j := len(after) - 1; j >= 0; j-- {
+			if before[i] == after[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	i, j := 0, 0
+
+	for i < len(before) || j < len(after) {
+		switch {
+		case i < len(before) && j < len(after) && before[i] == after[j]:
+			ops = append(ops, diffLine{' ', before[i]})
+			i++
+			j++
+
+		case j < len(after) && (i == len(before) || lcs[i][j+1] >= lcs[i+1][j]):
+			ops = append(ops, diffLine{'+', after[j]})
+			j++
+
+		default:
+			ops = append(ops, diffLine{'-', before[i]})
+			i++
+		}
+	}
+
+	return ops
+}
+
+func splitLines(text string) []string {
+	if len(text) == 0 {
+		return []string{}
+	}
+
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
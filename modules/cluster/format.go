@@ -0,0 +1,167 @@
+package cluster
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/render"
+)
+
+// formatAge prints the time elapsed since timestamp the way kubectl does,
+// e.g. 45s, 12m, 5h3m, 8d.
+func formatAge(timestamp metav1.Time) string {
+	if timestamp.IsZero() {
+		return "<unknown>"
+	}
+
+	age := time.Since(timestamp.Time)
+	switch {
+	case age < time.Minute:
+		return fmt.Sprintf("%ds", int(age.Seconds()))
+
+	case age < time.Hour:
+		return fmt.Sprintf("%dm", int(age.Minutes()))
+
+	case age < 24*time.Hour:
+		hours := int(age.Hours())
+		minutes := int(age.Minutes()) - 60*hours
+
+		if minutes == 0 {
+			return fmt.Sprintf("%dh", hours)
+		}
+		return fmt.Sprintf("%dh%dm", hours, minutes)
+
+	default:
+		return fmt.Sprintf("%dd", int(age.Hours()/24))
+	}
+}
+
+// podStatus summarizes a pod like the STATUS column of kubectl get pods,
+// the waiting or terminated reason of a container wins over the phase.
+func podStatus(pod *corev1.Pod) string {
+	if pod.DeletionTimestamp != nil {
+		return "Terminating"
+	}
+
+	for _, status := range pod.Status.InitContainerStatuses {
+		if status.State.Waiting != nil && len(status.State.Waiting.Reason) > 0 {
+			return "Init:" + status.State.Waiting.Reason
+		}
+	}
+
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.State.Waiting != nil && len(status.State.Waiting.Reason) > 0 {
+			return status.State.Waiting.Reason
+		}
+
+		if status.State.Terminated != nil && len(status.State.Terminated.Reason) > 0 {
+			return status.State.Terminated.Reason
+		}
+	}
+
+	if len(pod.Status.Reason) > 0 {
+		return pod.Status.Reason
+	}
+
+	return string(pod.Status.Phase)
+}
+
+// podReadiness returns the count of ready containers and the total restarts.
+func podReadiness(pod *corev1.Pod) (int, int) {
+	ready := 0
+	restarts := 0
+
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Ready {
+			ready++
+		}
+		restarts += int(status.RestartCount)
+	}
+
+	return ready, restarts
+}
+
+func podSummary(pod *corev1.Pod) string {
+	ready, restarts := podReadiness(pod)
+
+	return fmt.Sprintf("%s, %d/%d ready, %d restarts, %s old",
+		podStatus(pod), ready, len(pod.Spec.Containers), restarts,
+		formatAge(pod.CreationTimestamp))
+}
+
+func deploymentSummary(deployment *appsv1.Deployment) string {
+	desired := int32(1)
+	if deployment.Spec.Replicas != nil {
+		desired = *deployment.Spec.Replicas
+	}
+
+	return fmt.Sprintf("%d/%d ready, %d up-to-date, %d available, %s old",
+		deployment.Status.ReadyReplicas, desired,
+		deployment.Status.UpdatedReplicas,
+		deployment.Status.AvailableReplicas,
+		formatAge(deployment.CreationTimestamp))
+}
+
+// podCard renders the status of a pod and its containers.
+func podCard(builder render.Builder, cluster string, pod *corev1.Pod) render.Builder {
+	ready, restarts := podReadiness(pod)
+
+	builder.Bold("pod/" + pod.Name).
+		Text(" in ").
+		Code(fmt.Sprintf("%s/%s", cluster, pod.Namespace)).
+		Line("")
+	builder.Text("Status: ").Bold(podStatus(pod)).Line("")
+	builder.Line(fmt.Sprintf("Ready: %d/%d, restarts: %d", ready, len(pod.Spec.Containers), restarts))
+	if len(pod.Spec.NodeName) > 0 {
+		builder.Text("Node: ").Code(pod.Spec.NodeName).Line("")
+	}
+	builder.Line("Age: " + formatAge(pod.CreationTimestamp))
+
+	for _, status := range pod.Status.ContainerStatuses {
+		state := "running"
+
+		switch {
+		case status.State.Waiting != nil:
+			state = "waiting: " + status.State.Waiting.Reason
+
+		case status.State.Terminated != nil:
+			state = "terminated: " + status.State.Terminated.Reason
+		}
+
+		builder.Text("• ").Code(status.Name).Line(fmt.Sprintf(" %s (%s)", status.Image, state))
+	}
+
+	return builder
+}
+
+// deploymentCard renders the status of a deployment and its images.
+func deploymentCard(
+	builder render.Builder,
+	cluster string,
+	deployment *appsv1.Deployment,
+) render.Builder {
+	images := make([]string, 0, len(deployment.Spec.Template.Spec.Containers))
+	for _, container := range deployment.Spec.Template.Spec.Containers {
+		images = append(images, container.Image)
+	}
+
+	builder.Bold("deployment/" + deployment.Name).
+		Text(" in ").
+		Code(fmt.Sprintf("%s/%s", cluster, deployment.Namespace)).
+		Line("")
+	builder.Line(deploymentSummary(deployment))
+	builder.Text("Images: ").Code(strings.Join(images, ", ")).Line("")
+
+	for _, condition := range deployment.Status.Conditions {
+		builder.Text("• ").
+			Code(string(condition.Type)).
+			Line(fmt.Sprintf(" %s %s", condition.Status, condition.Message))
+	}
+
+	return builder
+}
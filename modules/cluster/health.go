@@ -0,0 +1,479 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/mux"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/rbac"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/render"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/telegram"
+)
+
+const (
+	// pendingGracePeriod is how long a pod may stay pending before it's
+	// reported, the scheduler and the image pulls need some time.
+	pendingGracePeriod = 5 * time.Minute
+	// recentEventsWindow is how far back the warning events are reported.
+	recentEventsWindow = 15 * time.Minute
+	// maxHealthProblems keeps the drill-down of a check below the size limit
+	// of a message.
+	maxHealthProblems = 40
+)
+
+// healthLevel is the color of a check in the traffic-light summary.
+type healthLevel int
+
+const (
+	healthOK healthLevel = iota
+	healthWarning
+	healthCritical
+)
+
+func (self healthLevel) String() string {
+	switch self {
+	case healthOK:
+		return "🟢"
+
+	case healthWarning:
+		return "🟡"
+
+	default:
+		return "🔴"
+	}
+}
+
+// healthCheck checks one category of the state of a cluster.
+type healthCheck struct {
+	name  string
+	title string
+	run   func(client *Client) (healthLevel, []string, error)
+}
+
+// healthResult is the outcome of a healthCheck, the problems explain its
+// level.
+type healthResult struct {
+	check    healthCheck
+	level    healthLevel
+	problems []string
+}
+
+var healthChecks = []healthCheck{
+	{name: "nodes", title: "Nodes", run: checkNodes},
+	{name: "control-plane", title: "Control plane", run: checkControlPlane},
+	{name: "pods", title: "Pods", run: checkPods},
+	{name: "volumes", title: "Volumes", run: checkVolumes},
+	{name: "events", title: "Warning events", run: checkEvents},
+}
+
+// showHealth sends the traffic-light summary of a cluster, default to the
+// selected one, with a button per failing check listing its problems.
+func (self *clusterImpl) showHealth(ctx *mux.Context) error {
+	if len(ctx.Args) > 1 {
+		return ctx.Reply("Usage: /health [cluster]")
+	}
+
+	var (
+		cluster string
+		allowed bool
+		err     error
+	)
+
+	if len(ctx.Args) == 1 {
+		cluster = ctx.Args[0]
+		ctx.Audit.Target(cluster, "", "")
+
+		allowed, err = self.authorizeCluster(ctx, cluster, rbac.RoleViewer)
+	} else {
+		var selection Selection
+
+		selection, allowed, err = self.authorize(ctx, rbac.RoleViewer)
+		cluster = selection.Cluster
+	}
+
+	if !allowed || err != nil {
+		return err
+	}
+
+	client, err := self.Client(cluster)
+	if err != nil {
+		return ctx.Reply(err.Error())
+	}
+
+	results := runHealthChecks(client)
+
+	overall := healthOK
+	for _, result := range results {
+		if result.level > overall {
+			overall = result.level
+		}
+	}
+
+	builder := render.NewHTML().
+		Bold(fmt.Sprintf("%s Health of cluster %s", overall, cluster)).
+		Line("")
+
+	if maintenance, err := self.Maintenance(cluster); err == nil && maintenance {
+		builder.Line("The cluster is in maintenance, /maintenance status tells more")
+	}
+
+	codec, err := mux.DefaultCodec()
+	if err != nil {
+		return err
+	}
+
+	keyboard := mux.NewKeyboard(codec, 0)
+	failing := false
+
+	for _, result := range results {
+		summary := "OK"
+		if len(result.problems) > 0 {
+			summary = fmt.Sprintf("%d problem(s)", len(result.problems))
+		}
+
+		builder.Line(fmt.Sprintf("%s %s: %s", result.level, result.check.title, summary))
+
+		if result.level != healthOK {
+			failing = true
+			keyboard.Button(fmt.Sprintf("%s %s", result.level, result.check.title), mux.Callback{
+				Module: ModuleName,
+				Action: "health",
+				Args:   map[string]string{"cluster": cluster, "check": result.check.name},
+			}).Row()
+		}
+	}
+
+	config := builder.Config(ctx.Message.Chat.ID)
+	config.ReplyToMessageID = ctx.Message.MessageID
+
+	if failing {
+		markup, err := keyboard.Markup()
+		if err != nil {
+			return err
+		}
+
+		config.ReplyMarkup = markup
+	}
+
+	_, err = ctx.Telegram.SendMessage(config)
+	return err
+}
+
+// drillHealth runs a check again and replies with its problems when its
+// button is pressed.
+func (self *clusterImpl) drillHealth(ctx *mux.CallbackContext) error {
+	cluster := ctx.Callback.Args["cluster"]
+
+	allowed, err := rbac.Allowed(ctx.Query.From.ID, cluster, rbac.RoleViewer)
+	if err != nil {
+		return err
+	}
+
+	if !allowed {
+		return ctx.Alert("You need the viewer role on cluster " + cluster)
+	}
+
+	ctx.Audit.Target(cluster, "", "")
+
+	client, err := self.Client(cluster)
+	if err != nil {
+		return ctx.Alert(err.Error())
+	}
+
+	for _, check := range healthChecks {
+		if check.name != ctx.Callback.Args["check"] {
+			continue
+		}
+
+		result := runHealthCheck(client, check)
+		if len(result.problems) == 0 {
+			return ctx.Toast(check.title + " are fine now")
+		}
+
+		builder := render.NewHTML().
+			Bold(fmt.Sprintf("%s %s of cluster %s", result.level, check.title, cluster)).
+			Line("")
+
+		for i, problem := range result.problems {
+			if i == maxHealthProblems {
+				builder.Line(fmt.Sprintf("… and %d more", len(result.problems)-i))
+				break
+			}
+
+			builder.Text("• ").Line(problem)
+		}
+
+		config := builder.Config(ctx.ChatID())
+		if ctx.Query.Message != nil {
+			config.ReplyToMessageID = ctx.Query.Message.MessageID
+		}
+
+		if _, err = ctx.Telegram.SendLongMessage(telegram.LongMessageConfig{
+			MessageConfig: config,
+		}); err != nil {
+			return err
+		}
+
+		return ctx.Toast("")
+	}
+
+	return ctx.Alert("Unknown check " + ctx.Callback.Args["check"])
+}
+
+func runHealthChecks(client *Client) []healthResult {
+	results := make([]healthResult, len(healthChecks))
+	done := make(chan struct{}, len(healthChecks))
+
+	// The checks are independent, running them together keeps /health fast
+	// on large clusters
+	for i := range healthChecks {
+		go func(i int) {
+			results[i] = runHealthCheck(client, healthChecks[i])
+			done <- struct{}{}
+		}(i)
+	}
+
+	for range healthChecks {
+		<-done
+	}
+
+	return results
+}
+
+func runHealthCheck(client *Client, check healthCheck) healthResult {
+	level, problems, err := check.run(client)
+	if err != nil {
+		return healthResult{
+			check:    check,
+			level:    healthCritical,
+			problems: []string{"The check fails: " + err.Error()},
+		}
+	}
+
+	return healthResult{check: check, level: level, problems: problems}
+}
+
+// checkNodes reports the nodes which aren't ready as critical and the nodes
+// under pressure or cordoned as warnings.
+func checkNodes(client *Client) (healthLevel, []string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	nodes, err := client.Clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return healthCritical, nil, err
+	}
+
+	level := healthOK
+	problems := make([]string, 0)
+
+	for i := range nodes.Items {
+		node := &nodes.Items[i]
+
+		if !nodeReady(node) {
+			level = healthCritical
+			problems = append(problems, fmt.Sprintf("node %s isn't ready", node.Name))
+		}
+
+		for _, condition := range node.Status.Conditions {
+			if condition.Type == corev1.NodeReady || condition.Status != corev1.ConditionTrue {
+				continue
+			}
+
+			if level == healthOK {
+				level = healthWarning
+			}
+
+			problems = append(problems, fmt.Sprintf("node %s has %s: %s",
+				node.Name, condition.Type, condition.Message))
+		}
+
+		// A cordoned node takes no new pod, the capacity of the cluster
+		// shrinks until it's uncordoned
+		if node.Spec.Unschedulable {
+			if level == healthOK {
+				level = healthWarning
+			}
+
+			problems = append(problems, fmt.Sprintf("node %s is cordoned", node.Name))
+		}
+	}
+
+	return level, problems, nil
+}
+
+// checkControlPlane reads the verbose readiness of the API server, which
+// covers etcd and the post-start hooks.
+func checkControlPlane(client *Client) (healthLevel, []string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	output, err := client.Clientset.Discovery().RESTClient().Get().
+		AbsPath("/readyz").
+		Param("verbose", "true").
+		Do(ctx).
+		Raw()
+
+	problems := make([]string, 0)
+
+	for _, line := range strings.Split(string(output), "\n") {
+		if strings.HasPrefix(line, "[-]") {
+			problems = append(problems, strings.TrimPrefix(line, "[-]"))
+		}
+	}
+
+	if len(problems) > 0 {
+		return healthCritical, problems, nil
+	}
+
+	if err != nil {
+		return healthCritical, nil, err
+	}
+
+	return healthOK, problems, nil
+}
+
+// checkPods reports the pods crashing or failing to pull their images as
+// critical and the pods pending for too long as warnings.
+func checkPods(client *Client) (healthLevel, []string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	pods, err := client.Clientset.CoreV1().Pods(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return healthCritical, nil, err
+	}
+
+	level := healthOK
+	problems := make([]string, 0)
+
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		name := pod.Namespace + "/" + pod.Name
+
+		switch status := podStatus(pod); status {
+		case "CrashLoopBackOff", "ImagePullBackOff", "ErrImagePull", "CreateContainerConfigError":
+			level = healthCritical
+			problems = append(problems, fmt.Sprintf("%s is in %s", name, status))
+
+		case string(corev1.PodPending):
+			if time.Since(pod.CreationTimestamp.Time) < pendingGracePeriod {
+				continue
+			}
+
+			if level == healthOK {
+				level = healthWarning
+			}
+
+			problems = append(problems, fmt.Sprintf("%s is pending for %s: %s",
+				name, formatAge(pod.CreationTimestamp), podFailure(pod)))
+		}
+	}
+
+	sort.Strings(problems)
+	return level, problems, nil
+}
+
+// checkVolumes reports the lost claims as critical and the pending ones as
+// warnings.
+func checkVolumes(client *Client) (healthLevel, []string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	claims, err := client.Clientset.CoreV1().PersistentVolumeClaims(metav1.NamespaceAll).
+		List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return healthCritical, nil, err
+	}
+
+	level := healthOK
+	problems := make([]string, 0)
+
+	for _, claim := range claims.Items {
+		name := claim.Namespace + "/" + claim.Name
+
+		switch claim.Status.Phase {
+		case corev1.ClaimLost:
+			level = healthCritical
+			problems = append(problems, fmt.Sprintf("claim %s lost its volume", name))
+
+		case corev1.ClaimPending:
+			if level == healthOK {
+				level = healthWarning
+			}
+
+			problems = append(problems, fmt.Sprintf("claim %s is pending for %s",
+				name, formatAge(claim.CreationTimestamp)))
+		}
+	}
+
+	return level, problems, nil
+}
+
+// checkEvents groups the recent warning events by object and reason, they
+// are only warnings since most of them heal by themselves.
+func checkEvents(client *Client) (healthLevel, []string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	events, err := client.Clientset.CoreV1().Events(metav1.NamespaceAll).List(ctx, metav1.ListOptions{
+		FieldSelector: "type=" + corev1.EventTypeWarning,
+	})
+	if err != nil {
+		return healthCritical, nil, err
+	}
+
+	counts := make(map[string]int32)
+	messages := make(map[string]string)
+
+	for _, event := range events.Items {
+		if time.Since(LastSeen(&event)) > recentEventsWindow {
+			continue
+		}
+
+		key := fmt.Sprintf("%s %s/%s/%s", event.Reason, event.InvolvedObject.Kind,
+			event.InvolvedObject.Namespace, event.InvolvedObject.Name)
+
+		count := event.Count
+		if count == 0 {
+			count = 1
+		}
+
+		counts[key] += count
+		messages[key] = event.Message
+	}
+
+	problems := make([]string, 0, len(counts))
+	for _, key := range sortedKeys(counts) {
+		problems = append(problems, fmt.Sprintf("%s ×%d: %s", key, counts[key], messages[key]))
+	}
+
+	if len(problems) == 0 {
+		return healthOK, problems, nil
+	}
+
+	return healthWarning, problems, nil
+}
+
+// LastSeen returns when an event happened for the last time, the fields
+// depend on the API which created it.
+func LastSeen(event *corev1.Event) time.Time {
+	switch {
+	case event.Series != nil:
+		return event.Series.LastObservedTime.Time
+
+	case !event.LastTimestamp.IsZero():
+		return event.LastTimestamp.Time
+
+	case !event.EventTime.IsZero():
+		return event.EventTime.Time
+	}
+
+	return event.CreationTimestamp.Time
+}
@@ -0,0 +1,402 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/audit"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/mux"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/rbac"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/render"
+)
+
+const (
+	// revisionAnnotation numbers the replica sets of a deployment.
+	revisionAnnotation = "deployment.kubernetes.io/revision"
+	// changeCauseAnnotation explains a revision, like kubectl rollout history.
+	changeCauseAnnotation = "kubernetes.io/change-cause"
+)
+
+// revision is a replica set of a deployment.
+type revision struct {
+	number      int64
+	images      []string
+	changeCause string
+	created     metav1.Time
+	replicaSet  *appsv1.ReplicaSet
+}
+
+// pendingRollback is a rollback waiting for the confirmation of its author.
+type pendingRollback struct {
+	ChatID     int64     `json:"chat_id"`
+	UserID     int64     `json:"user_id"`
+	Selection  Selection `json:"selection"`
+	Deployment string    `json:"deployment"`
+	Revision   int64     `json:"revision"`
+}
+
+func (self *clusterImpl) showHistory(ctx *mux.Context) error {
+	if len(ctx.Args) != 1 {
+		return ctx.Reply("Usage: /history <deployment>")
+	}
+
+	selection, allowed, err := self.authorize(ctx, rbac.RoleViewer)
+	if !allowed || err != nil {
+		return err
+	}
+
+	ctx.Audit.Target("", "", "deployment/"+ctx.Args[0])
+
+	client, err := self.Client(selection.Cluster)
+	if err != nil {
+		return err
+	}
+
+	deployment, revisions, err := deploymentRevisions(client, selection.Namespace, ctx.Args[0])
+	if apierrors.IsNotFound(err) {
+		return ctx.Reply(fmt.Sprintf("Deployment %s doesn't exist in namespace %s",
+			ctx.Args[0], selection.Namespace))
+	} else if err != nil {
+		return err
+	}
+
+	table := render.Table{
+		Columns: []render.Column{
+			{Title: "REV", AlignRight: true},
+			{Title: "IMAGE"},
+			{Title: "AGE", AlignRight: true},
+			{Title: "CHANGE-CAUSE", Wide: true},
+		},
+		Wide: true,
+	}
+
+	current := deployment.Annotations[revisionAnnotation]
+
+	for _, revision := range revisions {
+		number := strconv.FormatInt(revision.number, 10)
+		if number == current {
+			number = "*" + number
+		}
+
+		table.Rows = append(table.Rows, []string{
+			number,
+			strings.Join(revision.images, ","),
+			formatAge(revision.created),
+			orMissing(revision.changeCause),
+		})
+	}
+
+	builder := render.NewHTML().
+		Bold(fmt.Sprintf("Revisions of deployment %s/%s", selection.Namespace, ctx.Args[0])).
+		Line("")
+
+	return ctx.SendTable(builder, table)
+}
+
+// rollbackDeployment asks its author to confirm the rollback of a deployment
+// to a revision, default to the previous one.
+func (self *clusterImpl) rollbackDeployment(ctx *mux.Context) error {
+	if len(ctx.Args) == 0 || len(ctx.Args) > 2 {
+		return ctx.Reply("Usage: /rollback <deployment> [revision]")
+	}
+
+	selection, allowed, err := self.authorize(ctx, rbac.RoleOperator)
+	if !allowed || err != nil {
+		return err
+	}
+
+	name := ctx.Args[0]
+	ctx.Audit.Target("", "", "deployment/"+name)
+
+	client, err := self.Client(selection.Cluster)
+	if err != nil {
+		return err
+	}
+
+	deployment, revisions, err := deploymentRevisions(client, selection.Namespace, name)
+	if apierrors.IsNotFound(err) {
+		return ctx.Reply(fmt.Sprintf("Deployment %s doesn't exist in namespace %s",
+			name, selection.Namespace))
+	} else if err != nil {
+		return err
+	}
+
+	current, _ := strconv.ParseInt(deployment.Annotations[revisionAnnotation], 10, 64)
+
+	target, err := rollbackTarget(revisions, current, ctx.Args[1:])
+	if err != nil {
+		return ctx.Reply(err.Error())
+	}
+
+	id, err := newApplyID()
+	if err != nil {
+		return err
+	}
+
+	err = self.store.Set(rollbackKey(id), pendingRollback{
+		ChatID:     ctx.Message.Chat.ID,
+		UserID:     ctx.Message.From.ID,
+		Selection:  selection,
+		Deployment: name,
+		Revision:   target.number,
+	}, applyTTL)
+	if err != nil {
+		return err
+	}
+
+	ctx.Audit.Confirm(audit.ConfirmationPending)
+
+	codec, err := mux.DefaultCodec()
+	if err != nil {
+		return err
+	}
+
+	keyboard, err := mux.NewKeyboard(codec, applyTTL).
+		Button("Roll back", mux.Callback{
+			Module: ModuleName,
+			Action: "rollback",
+			Args:   map[string]string{"id": id},
+			UserID: ctx.Message.From.ID,
+		}).
+		Button("Cancel", mux.Callback{
+			Module: ModuleName,
+			Action: "cancel-rollback",
+			Args:   map[string]string{"id": id},
+			UserID: ctx.Message.From.ID,
+		}).
+		Markup()
+	if err != nil {
+		return err
+	}
+
+	builder := render.NewHTML().
+		Text(fmt.Sprintf("Roll deployment %s of cluster %s back from revision %d to revision %d, ",
+			name, selection.Cluster, current, target.number)).
+		Code(strings.Join(target.images, ", ")).
+		Text(fmt.Sprintf("? This request expires in %s.", applyTTL))
+
+	config := builder.Config(ctx.Message.Chat.ID)
+	config.ReplyToMessageID = ctx.Message.MessageID
+	config.ReplyMarkup = keyboard
+
+	_, err = ctx.Telegram.SendMessage(config)
+	return err
+}
+
+// answerRollback performs or cancels a rollback when its author presses one
+// of the buttons, then the worker follows the rollout in the same message.
+func (self *clusterImpl) answerRollback(ctx *mux.CallbackContext) error {
+	id := ctx.Callback.Args["id"]
+	pending := &pendingRollback{}
+
+	found, err := self.store.Get(rollbackKey(id), pending)
+	if err != nil {
+		return err
+	}
+
+	if !found || pending.ChatID != ctx.ChatID() {
+		return ctx.Alert("This rollback doesn't exist or has expired")
+	}
+
+	// Two presses served together mustn't both roll the deployment back
+	taken, err := self.store.Lock(rollbackKey(id)+":decision", ctx.Query.ID, applyTTL)
+	if err != nil {
+		return err
+	}
+
+	if !taken {
+		return ctx.Alert("This rollback is already being performed or cancelled")
+	}
+
+	if err = self.store.Delete(rollbackKey(id)); err != nil {
+		return err
+	}
+
+	ctx.Audit.Target(pending.Selection.Cluster, pending.Selection.Namespace,
+		"deployment/"+pending.Deployment)
+
+	if ctx.Callback.Action == "cancel-rollback" {
+		ctx.Audit.Confirm(audit.ConfirmationDiscarded)
+
+		err = ctx.Edit(render.NewHTML().Text("The rollback of "+pending.Deployment+" is cancelled"), nil)
+		if err != nil {
+			return err
+		}
+
+		return ctx.Toast("Cancelled")
+	}
+
+	ctx.Audit.Confirm(audit.ConfirmationConfirmed)
+
+	if err = ctx.Toast("Rolling back"); err != nil {
+		return err
+	}
+
+	title := fmt.Sprintf("Rolling deployment %s of cluster %s back to revision %d",
+		pending.Deployment, pending.Selection.Cluster, pending.Revision)
+	status := mux.NewStatus(ctx.Telegram, ctx.ChatID(), ctx.Query.Message.MessageID)
+
+	client, err := self.Client(pending.Selection.Cluster)
+	if err == nil {
+		err = rollback(client, pending.Selection.Namespace, pending.Deployment, pending.Revision)
+	}
+
+	if err != nil {
+		ctx.Audit.Result = audit.ResultFailed
+		ctx.Audit.Error = err.Error()
+
+		return status.Finish(render.NewHTML().Bold(title).Line("").Line("Failed: "+err.Error()), nil)
+	}
+
+	if err = status.Finish(render.NewHTML().Bold(title), nil); err != nil {
+		return err
+	}
+
+	return self.enqueueRollout(status, pending.Selection.Cluster, title, workload{
+		kind:      "Deployment",
+		namespace: pending.Selection.Namespace,
+		name:      pending.Deployment,
+	})
+}
+
+// deploymentRevisions returns a deployment with its replica sets, newest
+// revision first.
+func deploymentRevisions(
+	client *Client,
+	namespace, name string,
+) (*appsv1.Deployment, []revision, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	deployment, err := client.Clientset.AppsV1().Deployments(namespace).
+		Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(deployment.Spec.Selector)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	replicaSets, err := client.Clientset.AppsV1().ReplicaSets(namespace).
+		List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	revisions := make([]revision, 0, len(replicaSets.Items))
+
+	for i := range replicaSets.Items {
+		replicaSet := &replicaSets.Items[i]
+		if !metav1.IsControlledBy(replicaSet, deployment) {
+			continue
+		}
+
+		number, err := strconv.ParseInt(replicaSet.Annotations[revisionAnnotation], 10, 64)
+		if err != nil {
+			continue
+		}
+
+		images := make([]string, 0, len(replicaSet.Spec.Template.Spec.Containers))
+		for _, container := range replicaSet.Spec.Template.Spec.Containers {
+			images = append(images, container.Image)
+		}
+
+		revisions = append(revisions, revision{
+			number:      number,
+			images:      images,
+			changeCause: replicaSet.Annotations[changeCauseAnnotation],
+			created:     replicaSet.CreationTimestamp,
+			replicaSet:  replicaSet,
+		})
+	}
+
+	sort.Slice(revisions, func(i, j int) bool {
+		return revisions[i].number > revisions[j].number
+	})
+
+	return deployment, revisions, nil
+}
+
+// rollbackTarget picks the revision named by args, or the newest revision
+// before current.
+func rollbackTarget(revisions []revision, current int64, args []string) (revision, error) {
+	if len(args) == 0 {
+		for _, revision := range revisions {
+			if revision.number < current {
+				return revision, nil
+			}
+		}
+
+		return revision{}, fmt.Errorf("The deployment has no revision before %d", current)
+	}
+
+	number, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		return revision{}, fmt.Errorf("Revision %s isn't a number", args[0])
+	}
+
+	if number == current {
+		return revision{}, fmt.Errorf("The deployment already runs revision %d", number)
+	}
+
+	for _, revision := range revisions {
+		if revision.number == number {
+			return revision, nil
+		}
+	}
+
+	return revision{}, fmt.Errorf("Revision %d doesn't exist, see /history", number)
+}
+
+// rollback replaces the pod template of a deployment by the one of a
+// revision, like kubectl rollout undo.
+func rollback(client *Client, namespace, name string, number int64) error {
+	deployment, revisions, err := deploymentRevisions(client, namespace, name)
+	if err != nil {
+		return err
+	}
+
+	if deployment.Spec.Paused {
+		return fmt.Errorf("Deployment %s is paused, resume it first", name)
+	}
+
+	for _, revision := range revisions {
+		if revision.number != number {
+			continue
+		}
+
+		template := revision.replicaSet.Spec.Template.DeepCopy()
+		delete(template.Labels, appsv1.DefaultDeploymentUniqueLabelKey)
+
+		patch, err := json.Marshal([]map[string]interface{}{
+			{"op": "replace", "path": "/spec/template", "value": template},
+		})
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+		defer cancel()
+
+		_, err = client.Clientset.AppsV1().Deployments(namespace).Patch(ctx, name,
+			types.JSONPatchType, patch, metav1.PatchOptions{FieldManager: FieldManager})
+		return err
+	}
+
+	return fmt.Errorf("Revision %d of deployment %s doesn't exist anymore", number, name)
+}
+
+func rollbackKey(id string) string {
+	return "cluster:rollback:" + id
+}
@@ -0,0 +1,194 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/mux"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/rbac"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/render"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/telegram"
+)
+
+const (
+	// inlinePageSize is how many results an inline query returns per page.
+	inlinePageSize = 20
+	// inlineCacheTime keeps the results fresh enough for status cards.
+	inlineCacheTime = 10
+)
+
+// inlineQuery is the parsed text of an inline query, e.g. `pod web-` or
+// `deploy api`. A query without kind searches both pods and deployments.
+type inlineQuery struct {
+	pods        bool
+	deployments bool
+	prefix      string
+}
+
+func parseInlineQuery(text string) inlineQuery {
+	fields := strings.Fields(text)
+	query := inlineQuery{pods: true, deployments: true}
+
+	if len(fields) == 0 {
+		return query
+	}
+
+	switch strings.ToLower(fields[0]) {
+	case "po", "pod", "pods":
+		query.deployments = false
+		fields = fields[1:]
+
+	case "deploy", "deployment", "deployments":
+		query.pods = false
+		fields = fields[1:]
+	}
+
+	if len(fields) > 0 {
+		query.prefix = fields[0]
+	}
+	return query
+}
+
+// answerInlineQuery searches the pods and deployments of every namespace of
+// the cluster selected in the private chat of the user, each result sends a
+// status card of the resource to the chat the query was typed in.
+func (self *clusterImpl) answerInlineQuery(ctx *mux.UpdateContext) error {
+	query := ctx.Update.InlineQuery
+	config := telegram.InlineConfig{
+		InlineQueryID: query.ID,
+		CacheTime:     inlineCacheTime,
+		IsPersonal:    true,
+	}
+
+	// The private chat with a user shares the identifier of the user.
+	selection, err := self.Selection(query.From.ID)
+	if err != nil {
+		config.SwitchPMText = "Select a cluster first"
+		config.SwitchPMParameter = "use"
+		return ctx.Telegram.AnswerInlineQuery(config)
+	}
+
+	allowed, err := rbac.Allowed(query.From.ID, selection.Cluster, rbac.RoleViewer)
+	if err != nil {
+		return err
+	}
+
+	if !allowed {
+		config.SwitchPMText = fmt.Sprintf("You can't view cluster %s", selection.Cluster)
+		config.SwitchPMParameter = "denied"
+		return ctx.Telegram.AnswerInlineQuery(config)
+	}
+
+	results, err := self.searchResources(selection, parseInlineQuery(query.Query))
+	if err != nil {
+		return err
+	}
+
+	offset, _ := strconv.Atoi(query.Offset)
+	if offset < 0 || offset > len(results) {
+		offset = len(results)
+	}
+
+	end := offset + inlinePageSize
+	if end < len(results) {
+		config.NextOffset = strconv.Itoa(end)
+	} else {
+		end = len(results)
+	}
+
+	config.Results = results[offset:end]
+	return ctx.Telegram.AnswerInlineQuery(config)
+}
+
+// searchResources lists the resources of every namespace, the ones of the
+// selected namespace first.
+func (self *clusterImpl) searchResources(
+	selection Selection,
+	query inlineQuery,
+) ([]interface{}, error) {
+	client, err := self.Client(selection.Cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	selected := make([]interface{}, 0)
+	others := make([]interface{}, 0)
+
+	add := func(namespace string, result interface{}) {
+		if namespace == selection.Namespace {
+			selected = append(selected, result)
+		} else {
+			others = append(others, result)
+		}
+	}
+
+	if query.deployments {
+		deployments, err := client.Clientset.AppsV1().
+			Deployments(metav1.NamespaceAll).
+			List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+
+		for i := range deployments.Items {
+			deployment := &deployments.Items[i]
+			if !strings.HasPrefix(deployment.Name, query.prefix) {
+				continue
+			}
+
+			card := deploymentCard(render.NewHTML(), selection.Cluster, deployment)
+			add(deployment.Namespace, inlineArticle(
+				"deploy:"+string(deployment.UID),
+				fmt.Sprintf("deployment/%s in %s", deployment.Name, deployment.Namespace),
+				deploymentSummary(deployment),
+				card,
+			))
+		}
+	}
+
+	if query.pods {
+		pods, err := client.Clientset.CoreV1().
+			Pods(metav1.NamespaceAll).
+			List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+
+		for i := range pods.Items {
+			pod := &pods.Items[i]
+			if !strings.HasPrefix(pod.Name, query.prefix) {
+				continue
+			}
+
+			card := podCard(render.NewHTML(), selection.Cluster, pod)
+			add(pod.Namespace, inlineArticle(
+				"pod:"+string(pod.UID),
+				fmt.Sprintf("pod/%s in %s", pod.Name, pod.Namespace),
+				podSummary(pod),
+				card,
+			))
+		}
+	}
+
+	return append(selected, others...), nil
+}
+
+func inlineArticle(id, title, description string, card render.Builder) telegram.InlineQueryResultArticle {
+	return telegram.InlineQueryResultArticle{
+		Type:        "article",
+		ID:          id,
+		Title:       title,
+		Description: description,
+		InputMessageContent: telegram.InputTextMessageContent{
+			Text:      card.String(),
+			ParseMode: telegram.ModeHTML,
+		},
+	}
+}
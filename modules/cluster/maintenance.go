@@ -0,0 +1,948 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/audit"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/jobs"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/mux"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/rbac"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/render"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/telegram"
+)
+
+// Phases of a maintenance, a maintenance is saved after every step so that
+// /maintenance resume continues it from its phase after a restart.
+const (
+	phaseScale    = "scale down"
+	phaseDrain    = "drain"
+	phaseCheck    = "health check"
+	phaseRelease  = "release"
+	phaseRestore  = "restore"
+	phaseRollback = "rollback"
+	phaseDone     = "done"
+)
+
+const (
+	// healthPollInterval spaces the health checks between two batches.
+	healthPollInterval = 10 * time.Second
+	// defaultHealthTimeout is how long a cluster may stay unhealthy after a
+	// batch before the maintenance is rolled back.
+	defaultHealthTimeout = 5 * time.Minute
+	// maintenanceLease is how long a maintenance may go without heartbeat
+	// before another instance is allowed to resume it.
+	maintenanceLease = 2 * time.Minute
+	// maintenanceJobKind is the kind of the jobs running a maintenance, a
+	// window takes hours so it can't run in a request of the webhook.
+	maintenanceJobKind = "cluster:maintenance"
+)
+
+// errMaintenanceTakenOver stops a runner whose lease was taken by another
+// one, which continues the maintenance from its saved state.
+var errMaintenanceTakenOver = errors.New("the maintenance is run by another worker")
+
+// scaledWorkload remembers the replicas of a workload scaled down.
+type scaledWorkload struct {
+	Namespace string `json:"namespace"`
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+	Replicas  int32  `json:"replicas"`
+}
+
+// maintenance is a maintenance window of a cluster: the non-critical
+// workloads are scaled down, then the nodes are drained in batches with a
+// health check after each batch, finally everything is restored. A failure
+// rolls back the cordoned nodes and the scaled workloads.
+type maintenance struct {
+	ID        string           `json:"id"`
+	Cluster   string           `json:"cluster"`
+	ChatID    int64            `json:"chat_id"`
+	MessageID int              `json:"message_id"`
+	StartedBy string           `json:"started_by"`
+	StartedAt time.Time        `json:"started_at"`
+	Heartbeat time.Time        `json:"heartbeat"`
+	Nodes     []string         `json:"nodes"`
+	BatchSize int              `json:"batch_size"`
+	Selector  string           `json:"selector"`
+	Pause     time.Duration    `json:"pause"`
+	Phase     string           `json:"phase"`
+	Batch     int              `json:"batch"`
+	Scaled    []scaledWorkload `json:"scaled"`
+	// Cordoned lists the nodes cordoned by the maintenance, the nodes which
+	// were already cordoned are left as they are.
+	Cordoned []string `json:"cordoned"`
+	// Baseline lists the problems the cluster had before the maintenance,
+	// only the new ones fail a health check.
+	Baseline []string `json:"baseline"`
+	// BatchDrainedAt is when the last batch was drained, its pause starts
+	// there.
+	BatchDrainedAt time.Time `json:"batch_drained_at"`
+	// Runner is the job running the maintenance, it holds its lease.
+	Runner string `json:"runner,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// maintenanceJob runs the maintenance of a cluster, editing the status
+// message of the request which started or resumed it.
+type maintenanceJob struct {
+	Cluster   string `json:"cluster"`
+	ChatID    int64  `json:"chat_id"`
+	MessageID int    `json:"message_id"`
+}
+
+func (self *maintenance) batches() int {
+	return (len(self.Nodes) + self.BatchSize - 1) / self.BatchSize
+}
+
+func (self *maintenance) batchNodes() []string {
+	start := self.Batch * self.BatchSize
+	end := start + self.BatchSize
+
+	if end > len(self.Nodes) {
+		end = len(self.Nodes)
+	}
+
+	return self.Nodes[start:end]
+}
+
+func maintenanceKey(cluster string) string {
+	return "cluster:maintenance:" + cluster
+}
+
+func maintenanceAbortKey(id string) string {
+	return "cluster:maintenance:abort:" + id
+}
+
+func maintenanceLeaseKey(cluster string) string {
+	return "cluster:maintenance:lease:" + cluster
+}
+
+// Maintenance tells if cluster is in a maintenance window.
+func (self *clusterImpl) Maintenance(cluster string) (bool, error) {
+	current := &maintenance{}
+	return self.store.Get(maintenanceKey(cluster), current)
+}
+
+func (self *clusterImpl) handleMaintenance(ctx *mux.Context) error {
+	usage := "Usage: /maintenance start [nodes=a,b|selector] [batch=1] " +
+		"[scale=<label selector>] [pause=0s] | status | abort | resume"
+
+	if len(ctx.Args) == 0 {
+		return ctx.Reply(usage)
+	}
+
+	role := rbac.RoleAdmin
+	if ctx.Args[0] == "status" {
+		role = rbac.RoleViewer
+	}
+
+	selection, allowed, err := self.authorize(ctx, role)
+	if !allowed || err != nil {
+		return err
+	}
+
+	current := &maintenance{}
+
+	found, err := self.store.Get(maintenanceKey(selection.Cluster), current)
+	if err != nil {
+		return err
+	}
+
+	if !found {
+		current = nil
+	} else {
+		ctx.Audit.Target("", "", "maintenance/"+current.ID)
+	}
+
+	// The window runs in the worker, which reads it from the store
+	if (ctx.Args[0] == "start" || ctx.Args[0] == "resume") && !self.store.Shared() {
+		return ctx.Reply("Maintenances run in the background, " + jobs.ErrNotShared.Error())
+	}
+
+	switch ctx.Args[0] {
+	case "start":
+		if current != nil {
+			return ctx.Reply(fmt.Sprintf("Cluster %s is already in maintenance since %s",
+				selection.Cluster, current.StartedAt.UTC().Format(time.RFC1123)))
+		}
+
+		return self.startMaintenance(ctx, selection, ctx.Args[1:])
+
+	case "status", "abort", "resume":
+		if current == nil {
+			return ctx.Reply(fmt.Sprintf("Cluster %s isn't in maintenance", selection.Cluster))
+		}
+
+	default:
+		return ctx.Reply(usage)
+	}
+
+	switch ctx.Args[0] {
+	case "status":
+		return ctx.Send(maintenanceProgress(current, ""))
+
+	case "abort":
+		ctx.Audit.Confirm(audit.ConfirmationDiscarded)
+
+		err = self.store.Set(maintenanceAbortKey(current.ID), true, 0)
+		if err != nil {
+			return err
+		}
+
+		return ctx.Reply("The maintenance is aborted, it's rolled back at its next step")
+	}
+
+	if time.Since(current.Heartbeat) < maintenanceLease {
+		return ctx.Reply("The maintenance is still running, it can only be resumed " +
+			"once it stops for " + maintenanceLease.String())
+	}
+
+	status, err := mux.SendStatus(ctx.Telegram, ctx.Message.Chat.ID, ctx.Message.MessageID,
+		maintenanceProgress(current, "Resuming"))
+	if err != nil {
+		return err
+	}
+
+	return self.enqueueMaintenance(current.Cluster, status)
+}
+
+// enqueueMaintenance hands the saved maintenance of cluster over to the
+// worker, which edits status with its progress.
+func (self *clusterImpl) enqueueMaintenance(cluster string, status mux.Status) error {
+	_, err := jobs.Enqueue(self.store, maintenanceJobKind, maintenanceJob{
+		Cluster:   cluster,
+		ChatID:    status.ChatID(),
+		MessageID: status.MessageID(),
+	})
+	return err
+}
+
+func (self *clusterImpl) startMaintenance(ctx *mux.Context, selection Selection, args []string) error {
+	client, err := self.Client(selection.Cluster)
+	if err != nil {
+		return err
+	}
+
+	id, err := newApplyID()
+	if err != nil {
+		return err
+	}
+
+	current := &maintenance{
+		ID:        id,
+		Cluster:   selection.Cluster,
+		StartedBy: ctx.Message.From.FirstName,
+		StartedAt: time.Now(),
+		BatchSize: 1,
+		Selector:  os.Getenv("MAINTENANCE_SCALE_SELECTOR"),
+		Phase:     phaseScale,
+	}
+
+	nodeSelector := ""
+
+	for _, arg := range args {
+		parts := strings.SplitN(arg, "=", 2)
+		if len(parts) != 2 {
+			return ctx.Reply(fmt.Sprintf("Argument %s must look like <name>=<value>", arg))
+		}
+
+		switch parts[0] {
+		case "nodes":
+			if strings.ContainsAny(parts[1], "=!") {
+				nodeSelector = parts[1]
+			} else {
+				current.Nodes = strings.Split(parts[1], ",")
+			}
+
+		case "batch":
+			current.BatchSize, err = strconv.Atoi(parts[1])
+			if err != nil || current.BatchSize < 1 {
+				return ctx.Reply("The batch must be a positive number")
+			}
+
+		case "scale":
+			current.Selector = parts[1]
+
+		case "pause":
+			current.Pause, err = time.ParseDuration(parts[1])
+			if err != nil || current.Pause < 0 {
+				return ctx.Reply("The pause must be a duration like 5m")
+			}
+
+		default:
+			return ctx.Reply("Unknown argument " + parts[0])
+		}
+	}
+
+	if len(current.Nodes) == 0 {
+		current.Nodes, err = nodeNames(client, nodeSelector)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(current.Nodes) == 0 {
+		return ctx.Reply("No node matches")
+	}
+
+	ctx.Audit.Target("", "", "maintenance/"+id)
+
+	// Only the problems appearing during the window fail its health checks
+	baseline, err := healthProblems(client, nil)
+	if err != nil {
+		return err
+	}
+
+	for key := range baseline {
+		current.Baseline = append(current.Baseline, key)
+	}
+
+	status, err := mux.SendStatus(ctx.Telegram, ctx.Message.Chat.ID, ctx.Message.MessageID,
+		maintenanceProgress(current, "Starting"))
+	if err != nil {
+		return err
+	}
+
+	current.ChatID = status.ChatID()
+	current.MessageID = status.MessageID()
+	current.Heartbeat = time.Now()
+
+	if err = self.store.Set(maintenanceKey(current.Cluster), current, 0); err != nil {
+		return err
+	}
+
+	if err = self.enqueueMaintenance(current.Cluster, status); err != nil {
+		self.store.Delete(maintenanceKey(current.Cluster))
+		return err
+	}
+
+	return nil
+}
+
+// runMaintenanceJob takes the lease of the maintenance of a cluster, then
+// runs it from its saved phase.
+func (self *clusterImpl) runMaintenanceJob(ctx context.Context, bot telegram.Telegram, job jobs.Job) error {
+	request := maintenanceJob{}
+	if err := job.Decode(&request); err != nil {
+		return err
+	}
+
+	taken, err := self.store.Lock(maintenanceLeaseKey(request.Cluster), job.ID, maintenanceLease)
+	if err != nil {
+		return err
+	} else if !taken {
+		return fmt.Errorf("The maintenance of cluster %s is already running", request.Cluster)
+	}
+
+	defer self.store.Unlock(maintenanceLeaseKey(request.Cluster), job.ID)
+
+	current := &maintenance{}
+
+	found, err := self.store.Get(maintenanceKey(request.Cluster), current)
+	if err != nil || !found {
+		return err
+	}
+
+	current.Runner = job.ID
+	current.ChatID = request.ChatID
+	current.MessageID = request.MessageID
+
+	return self.runMaintenance(ctx, current, mux.NewStatus(bot, current.ChatID, current.MessageID))
+}
+
+// runMaintenance performs the steps of a maintenance from its phase until
+// it's done or rolled back, saving it after every step. It stops without
+// touching the maintenance when ctx is done or its lease is lost, the next
+// runner resumes it.
+func (self *clusterImpl) runMaintenance(ctx context.Context, current *maintenance, status mux.Status) error {
+	client, err := self.Client(current.Cluster)
+	if err != nil {
+		return err
+	}
+
+	keyboard, err := self.maintenanceKeyboard(current)
+	if err != nil {
+		return err
+	}
+
+	for current.Phase != phaseDone {
+		if err = self.saveMaintenance(current); err != nil {
+			return err
+		}
+
+		status.Update(maintenanceProgress(current, ""), keyboard)
+
+		if current.Phase != phaseRollback && self.aborted(current) {
+			current.Error = "aborted"
+			current.Phase = phaseRollback
+			continue
+		}
+
+		phase := current.Phase
+
+		switch phase {
+		case phaseScale:
+			err = self.scaleDown(client, current)
+			current.Phase = phaseDrain
+
+		case phaseDrain:
+			err = self.drainBatch(ctx, client, current, status, keyboard)
+			current.BatchDrainedAt = time.Now()
+			current.Phase = phaseCheck
+
+		case phaseCheck:
+			err = self.waitHealthy(ctx, client, current)
+			current.Phase = phaseRelease
+
+		case phaseRelease:
+			err = self.releaseBatch(ctx, client, current)
+			if current.Batch < current.batches() {
+				current.Phase = phaseDrain
+			} else {
+				current.Phase = phaseRestore
+			}
+
+		case phaseRestore:
+			err = self.scaleUp(client, current)
+			current.Phase = phaseDone
+
+		case phaseRollback:
+			err = self.rollback(client, current)
+			if err != nil && ctx.Err() == nil && !errors.Is(err, errMaintenanceTakenOver) {
+				current.Error = fmt.Sprintf("%s, then the rollback fails: %v", current.Error, err)
+				self.saveMaintenance(current)
+
+				return status.Finish(maintenanceProgress(current,
+					"Rollback failed, fix the cause and /maintenance resume"), nil)
+			}
+
+			current.Phase = phaseDone
+		}
+
+		// The phase is left as saved, the next runner starts it again
+		if ctx.Err() != nil {
+			return ctx.Err()
+		} else if errors.Is(err, errMaintenanceTakenOver) {
+			return err
+		}
+
+		if err != nil {
+			current.Error = err.Error()
+			current.Phase = phaseRollback
+		}
+	}
+
+	if err = self.store.Delete(maintenanceKey(current.Cluster)); err != nil {
+		return err
+	}
+
+	self.store.Delete(maintenanceAbortKey(current.ID))
+
+	title := "Maintenance done"
+	if len(current.Error) > 0 {
+		title = "Maintenance rolled back: " + current.Error
+	}
+
+	return status.Finish(maintenanceProgress(current, title), nil)
+}
+
+// saveMaintenance saves the heartbeat of a maintenance with its state and
+// extends the lease of its runner, it fails with errMaintenanceTakenOver
+// once another runner holds the lease.
+func (self *clusterImpl) saveMaintenance(current *maintenance) error {
+	taken, err := self.store.Lock(maintenanceLeaseKey(current.Cluster), current.Runner, maintenanceLease)
+	if err != nil {
+		return err
+	} else if !taken {
+		return errMaintenanceTakenOver
+	}
+
+	current.Heartbeat = time.Now()
+	return self.store.Set(maintenanceKey(current.Cluster), current, 0)
+}
+
+// pauseMaintenance waits for the next poll of a wait loop, refreshing the
+// heartbeat meanwhile so that nobody resumes the maintenance.
+func (self *clusterImpl) pauseMaintenance(ctx context.Context, current *maintenance) error {
+	if err := self.saveMaintenance(current); err != nil {
+		return err
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+
+	case <-time.After(healthPollInterval):
+		return nil
+	}
+}
+
+func (self *clusterImpl) aborted(current *maintenance) bool {
+	aborted := false
+	self.store.Get(maintenanceAbortKey(current.ID), &aborted)
+	return aborted
+}
+
+// scaleDown scales the deployments and the stateful sets matching the
+// selector to zero, remembering their replicas before each change.
+func (self *clusterImpl) scaleDown(client *Client, current *maintenance) error {
+	if len(current.Selector) == 0 {
+		return nil
+	}
+
+	workloads, err := listScalable(client, current.Selector)
+	if err != nil {
+		return err
+	}
+
+	for _, workload := range workloads {
+		if workload.Replicas == 0 {
+			continue
+		}
+
+		current.Scaled = append(current.Scaled, workload)
+		if err = self.saveMaintenance(current); err != nil {
+			return err
+		}
+
+		if err = scale(client, workload, 0); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (self *clusterImpl) scaleUp(client *Client, current *maintenance) error {
+	for len(current.Scaled) > 0 {
+		workload := current.Scaled[len(current.Scaled)-1]
+
+		if err := scale(client, workload, workload.Replicas); err != nil {
+			return err
+		}
+
+		current.Scaled = current.Scaled[:len(current.Scaled)-1]
+		if err := self.saveMaintenance(current); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// drainBatch cordons and drains the nodes of the current batch, only the
+// nodes it cordons itself are recorded to be uncordoned afterwards.
+func (self *clusterImpl) drainBatch(
+	ctx context.Context,
+	client *Client,
+	current *maintenance,
+	status mux.Status,
+	keyboard *telegram.InlineKeyboardMarkup,
+) error {
+	for _, node := range current.batchNodes() {
+		if !contains(current.Cordoned, node) {
+			unschedulable, err := nodeUnschedulable(client, node)
+			if err != nil {
+				return err
+			}
+
+			if !unschedulable {
+				current.Cordoned = append(current.Cordoned, node)
+				if err = self.saveMaintenance(current); err != nil {
+					return err
+				}
+
+				if err = cordon(client, node, true); err != nil {
+					return err
+				}
+			}
+		} else if err := cordon(client, node, true); err != nil {
+			return err
+		}
+
+		// The heartbeat is saved at each poll, a lost lease aborts the drain
+		evictCtx, cancel := context.WithCancel(ctx)
+		lost := error(nil)
+
+		result, remaining, err := self.evictPods(evictCtx, client, drainOptions{node: node},
+			maintenanceAbortKey(current.ID), time.Now().Add(drainTimeout()),
+			func(remaining []drainPod) {
+				if err := self.saveMaintenance(current); errors.Is(err, errMaintenanceTakenOver) {
+					lost = err
+					cancel()
+				}
+
+				status.Update(maintenanceProgress(current, "Draining "+node).
+					Line(fmt.Sprintf("%d pod(s) remaining", len(remaining))), keyboard)
+			})
+		cancel()
+
+		if lost != nil {
+			return lost
+		} else if err != nil {
+			return err
+		}
+
+		if len(remaining) > 0 {
+			return fmt.Errorf("drain of node %s %s", node, result)
+		}
+	}
+
+	return nil
+}
+
+// releaseBatch waits for the pause, counted from the drain of the batch,
+// then uncordons the nodes of the batch cordoned by the maintenance. The
+// pause leaves time to maintain the drained nodes.
+func (self *clusterImpl) releaseBatch(ctx context.Context, client *Client, current *maintenance) error {
+	deadline := current.BatchDrainedAt.Add(current.Pause)
+
+	for time.Now().Before(deadline) {
+		if self.aborted(current) {
+			return errors.New("aborted")
+		}
+
+		if err := self.pauseMaintenance(ctx, current); err != nil {
+			return err
+		}
+	}
+
+	for _, node := range current.batchNodes() {
+		if !contains(current.Cordoned, node) {
+			continue
+		}
+
+		if err := cordon(client, node, false); err != nil {
+			return err
+		}
+
+		current.Cordoned = remove(current.Cordoned, node)
+	}
+
+	current.Batch++
+	return nil
+}
+
+func (self *clusterImpl) rollback(client *Client, current *maintenance) error {
+	for len(current.Cordoned) > 0 {
+		if err := cordon(client, current.Cordoned[0], false); err != nil {
+			return err
+		}
+
+		current.Cordoned = current.Cordoned[1:]
+		if err := self.saveMaintenance(current); err != nil {
+			return err
+		}
+	}
+
+	return self.scaleUp(client, current)
+}
+
+// waitHealthy waits until the problems appearing after a batch are gone,
+// the problems of the baseline don't count.
+func (self *clusterImpl) waitHealthy(ctx context.Context, client *Client, current *maintenance) error {
+	timeout := defaultHealthTimeout
+	if value, err := time.ParseDuration(os.Getenv("MAINTENANCE_HEALTH_TIMEOUT")); err == nil {
+		timeout = value
+	}
+
+	deadline := time.Now().Add(timeout)
+
+	for {
+		found, err := healthProblems(client, current.Scaled)
+		if err != nil {
+			return err
+		}
+
+		problems := make([]string, 0)
+		for key, problem := range found {
+			if !contains(current.Baseline, key) {
+				problems = append(problems, problem)
+			}
+		}
+
+		if len(problems) == 0 {
+			return nil
+		}
+
+		if time.Now().After(deadline) || self.aborted(current) {
+			sort.Strings(problems)
+			return fmt.Errorf("cluster is unhealthy: %s", strings.Join(problems, "; "))
+		}
+
+		if err = self.pauseMaintenance(ctx, current); err != nil {
+			return err
+		}
+	}
+}
+
+// healthProblems describes the nodes which aren't ready and the deployments
+// missing ready replicas by the kind and name of the object, the workloads
+// scaled down on purpose are ignored.
+func healthProblems(client *Client, ignored []scaledWorkload) (map[string]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	problems := make(map[string]string)
+
+	nodes, err := client.Clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range nodes.Items {
+		if !nodeReady(&nodes.Items[i]) {
+			problems["node/"+nodes.Items[i].Name] = "node " + nodes.Items[i].Name + " isn't ready"
+		}
+	}
+
+	deployments, err := client.Clientset.AppsV1().Deployments(metav1.NamespaceAll).
+		List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, deployment := range deployments.Items {
+		desired := int32(1)
+		if deployment.Spec.Replicas != nil {
+			desired = *deployment.Spec.Replicas
+		}
+
+		skipped := false
+		for _, workload := range ignored {
+			if workload.Kind == "Deployment" && workload.Namespace == deployment.Namespace &&
+				workload.Name == deployment.Name {
+				skipped = true
+			}
+		}
+
+		if !skipped && deployment.Status.ReadyReplicas < desired {
+			problems["deployment/"+deployment.Namespace+"/"+deployment.Name] = fmt.Sprintf(
+				"deployment %s/%s has %d/%d ready", deployment.Namespace, deployment.Name,
+				deployment.Status.ReadyReplicas, desired)
+		}
+	}
+
+	return problems, nil
+}
+
+func nodeReady(node *corev1.Node) bool {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == corev1.NodeReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+
+	return false
+}
+
+func nodeUnschedulable(client *Client, name string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	node, err := client.Clientset.CoreV1().Nodes().Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return false, err
+	}
+
+	return node.Spec.Unschedulable, nil
+}
+
+func nodeNames(client *Client, selector string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	nodes, err := client.Clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{
+		LabelSelector: selector,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(nodes.Items))
+	for _, node := range nodes.Items {
+		names = append(names, node.Name)
+	}
+
+	sort.Strings(names)
+	return names, nil
+}
+
+func listScalable(client *Client, selector string) ([]scaledWorkload, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	options := metav1.ListOptions{LabelSelector: selector}
+	workloads := make([]scaledWorkload, 0)
+
+	deployments, err := client.Clientset.AppsV1().Deployments(metav1.NamespaceAll).List(ctx, options)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, deployment := range deployments.Items {
+		workloads = append(workloads, scaledWorkload{
+			Namespace: deployment.Namespace,
+			Kind:      "Deployment",
+			Name:      deployment.Name,
+			Replicas:  replicasOf(deployment.Spec.Replicas),
+		})
+	}
+
+	statefulSets, err := client.Clientset.AppsV1().StatefulSets(metav1.NamespaceAll).List(ctx, options)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, statefulSet := range statefulSets.Items {
+		workloads = append(workloads, scaledWorkload{
+			Namespace: statefulSet.Namespace,
+			Kind:      "StatefulSet",
+			Name:      statefulSet.Name,
+			Replicas:  replicasOf(statefulSet.Spec.Replicas),
+		})
+	}
+
+	return workloads, nil
+}
+
+func scale(client *Client, workload scaledWorkload, replicas int32) error {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	update := &autoscalingv1.Scale{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      workload.Name,
+			Namespace: workload.Namespace,
+		},
+		Spec: autoscalingv1.ScaleSpec{Replicas: replicas},
+	}
+
+	var err error
+
+	switch workload.Kind {
+	case "Deployment":
+		_, err = client.Clientset.AppsV1().Deployments(workload.Namespace).
+			UpdateScale(ctx, workload.Name, update, metav1.UpdateOptions{FieldManager: FieldManager})
+
+	case "StatefulSet":
+		_, err = client.Clientset.AppsV1().StatefulSets(workload.Namespace).
+			UpdateScale(ctx, workload.Name, update, metav1.UpdateOptions{FieldManager: FieldManager})
+
+	default:
+		err = fmt.Errorf("%s can't be scaled", workload.Kind)
+	}
+
+	return err
+}
+
+func replicasOf(replicas *int32) int32 {
+	if replicas == nil {
+		return 1
+	}
+
+	return *replicas
+}
+
+func (self *clusterImpl) abortMaintenance(ctx *mux.CallbackContext) error {
+	cluster := ctx.Callback.Args["cluster"]
+
+	allowed, err := rbac.Allowed(ctx.Query.From.ID, cluster, rbac.RoleAdmin)
+	if err != nil {
+		return err
+	}
+
+	if !allowed {
+		ctx.Audit.Result = audit.ResultDenied
+		return ctx.Alert("Only admins can abort a maintenance")
+	}
+
+	ctx.Audit.Target(cluster, "", "maintenance/"+ctx.Callback.Args["id"])
+	ctx.Audit.Confirm(audit.ConfirmationDiscarded)
+
+	if err = self.store.Set(maintenanceAbortKey(ctx.Callback.Args["id"]), true, 0); err != nil {
+		return err
+	}
+
+	return ctx.Toast("Aborting, the maintenance is rolled back at its next step")
+}
+
+func (self *clusterImpl) maintenanceKeyboard(current *maintenance) (*telegram.InlineKeyboardMarkup, error) {
+	codec, err := mux.DefaultCodec()
+	if err != nil {
+		return nil, err
+	}
+
+	return mux.NewKeyboard(codec, 0).
+		Button("Abort", mux.Callback{
+			Module: ModuleName,
+			Action: "abort-maintenance",
+			Args:   map[string]string{"id": current.ID, "cluster": current.Cluster},
+		}).
+		Markup()
+}
+
+func maintenanceProgress(current *maintenance, title string) render.Builder {
+	if len(title) == 0 {
+		title = "Maintenance in progress"
+	}
+
+	builder := render.NewHTML().
+		Bold(fmt.Sprintf("%s on cluster %s", title, current.Cluster)).
+		Line("").
+		Line(fmt.Sprintf("Started by %s %s ago", current.StartedBy,
+			time.Since(current.StartedAt).Round(time.Second))).
+		Line(fmt.Sprintf("Phase: %s, batch %d/%d of %d node(s)",
+			current.Phase, current.Batch+1, current.batches(), current.BatchSize))
+
+	if current.Phase != phaseDone && current.Batch < current.batches() {
+		builder.Text("Nodes: ").Code(strings.Join(current.batchNodes(), ", ")).Line("")
+	}
+
+	if len(current.Scaled) > 0 {
+		builder.Line(fmt.Sprintf("%d workload(s) scaled down", len(current.Scaled)))
+	}
+
+	if len(current.Cordoned) > 0 {
+		builder.Text("Cordoned: ").Code(strings.Join(current.Cordoned, ", ")).Line("")
+	}
+
+	if len(current.Error) > 0 {
+		builder.Line("Error: " + current.Error)
+	}
+
+	return builder
+}
+
+func contains(items []string, item string) bool {
+	for _, value := range items {
+		if value == item {
+			return true
+		}
+	}
+
+	return false
+}
+
+func remove(items []string, item string) []string {
+	result := make([]string, 0, len(items))
+
+	for _, value := range items {
+		if value != item {
+			result = append(result, value)
+		}
+	}
+
+	return result
+}
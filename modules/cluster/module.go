@@ -1,26 +1,343 @@
 package cluster
 
 import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/audit"
 	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/container"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/jobs"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/mux"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/rbac"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/render"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/state"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/telegram"
 )
 
+// ModuleName is the name the module is registered with, it routes the
+// callbacks of its buttons.
+const ModuleName = "cluster"
+
 type Cluster interface {
 	container.Module
+
+	Commands() []mux.Command
+	HandleMessage(ctx *mux.Context) (bool, error)
+	HandleCallback(ctx *mux.CallbackContext) error
+	UpdateKinds() []string
+	HandleUpdate(ctx *mux.UpdateContext) (bool, error)
+
+	Clusters() []string
+	Client(cluster string) (*Client, error)
+	Selection(chatId int64) (Selection, error)
+	Maintenance(cluster string) (bool, error)
 }
 
 type clusterImpl struct {
+	mutex          sync.Mutex
+	store          state.Store
+	registry       map[string]*registryEntry
+	defaultCluster string
 }
 
-func NewModule() Cluster {
-	return &clusterImpl{}
+func NewModule(store state.Store) Cluster {
+	return &clusterImpl{
+		store: store,
+	}
+}
+
+// Default returns the module registered as `cluster`, for the modules
+// reading the clusters and the selection of the chats.
+func Default() (Cluster, error) {
+	module, err := container.Lookup(ModuleName)
+	if err != nil {
+		return nil, err
+	}
+
+	clusters, ok := module.(Cluster)
+	if !ok {
+		return nil, errors.New("Module `cluster` isn't a cluster.Cluster")
+	}
+
+	return clusters, nil
 }
 
 func (self *clusterImpl) Init() error {
-	// @TODO: please fill this one
-	return nil
+	jobs.Handle(rolloutJobKind, self.runRolloutJob)
+	jobs.Handle(drainJobKind, self.runDrainJob)
+	jobs.Handle(maintenanceJobKind, self.runMaintenanceJob)
+
+	if err := self.loadRegistry(); err != nil {
+		return err
+	}
+
+	return self.publishRegistry()
 }
 
 func (self *clusterImpl) Deinit() error {
-	// @TODO: please fill this one
 	return nil
 }
+
+func (self *clusterImpl) Commands() []mux.Command {
+	return []mux.Command{
+		{
+			Name:        "clusters",
+			Description: "List the registered clusters, add wide for their servers",
+			Role:        rbac.RoleViewer,
+			Handler:     self.listClusters,
+		},
+		{
+			Name:        "use",
+			Description: "Select the cluster and the namespace of this chat",
+			Role:        rbac.RoleViewer,
+			Handler:     self.useCluster,
+		},
+		{
+			Name:        "apply",
+			Description: "Apply a manifest after reviewing its diff",
+			Role:        rbac.RoleAdmin,
+			Handler:     self.confirmApply,
+		},
+		{
+			Name:        "discard",
+			Description: "Discard a manifest waiting to be applied",
+			Role:        rbac.RoleAdmin,
+			Handler:     self.discardApply,
+		},
+		{
+			Name:        "cordon",
+			Description: "Mark a node as unschedulable",
+			Role:        rbac.RoleOperator,
+			Handler:     self.cordonNode,
+		},
+		{
+			Name:        "uncordon",
+			Description: "Mark a node as schedulable",
+			Role:        rbac.RoleOperator,
+			Handler:     self.uncordonNode,
+		},
+		{
+			Name:        "drain",
+			Description: "Cordon a node and evict its pods, respecting their disruption budgets",
+			Role:        rbac.RoleOperator,
+			Handler:     self.drainNode,
+		},
+		{
+			Name:        "health",
+			Description: "Summarize the health of the selected cluster or of the given one",
+			Role:        rbac.RoleViewer,
+			Handler:     self.showHealth,
+		},
+		{
+			Name:        "versions",
+			Description: "Show the versions of the selected cluster and the images of its deployments",
+			Role:        rbac.RoleViewer,
+			Handler:     self.showVersions,
+		},
+		{
+			Name:        "diff_versions",
+			Description: "Compare the versions and images of two clusters",
+			Role:        rbac.RoleViewer,
+			Handler:     self.diffVersions,
+		},
+		{
+			Name:        "restart",
+			Description: "Restart a deployment, a statefulset or a daemonset and follow its rollout",
+			Role:        rbac.RoleOperator,
+			Handler:     self.restartWorkload,
+		},
+		{
+			Name:        "scale",
+			Description: "Scale a deployment or a statefulset and follow its rollout",
+			Role:        rbac.RoleOperator,
+			Handler:     self.scaleWorkload,
+		},
+		{
+			Name:        "history",
+			Description: "List the revisions of a deployment",
+			Role:        rbac.RoleViewer,
+			Handler:     self.showHistory,
+		},
+		{
+			Name:        "rollback",
+			Description: "Roll a deployment back to a revision, default to the previous one",
+			Role:        rbac.RoleOperator,
+			Handler:     self.rollbackDeployment,
+		},
+		{
+			Name:        "maintenance",
+			Description: "Start, follow, abort or resume a maintenance window draining the nodes in batches",
+			Role:        rbac.RoleViewer,
+			Handler:     self.handleMaintenance,
+		},
+	}
+}
+
+func (self *clusterImpl) HandleMessage(ctx *mux.Context) (bool, error) {
+	if ctx.Message.Document == nil {
+		return false, nil
+	}
+
+	return self.reviewManifest(ctx)
+}
+
+func (self *clusterImpl) UpdateKinds() []string {
+	return []string{mux.UpdateInlineQuery}
+}
+
+func (self *clusterImpl) HandleUpdate(ctx *mux.UpdateContext) (bool, error) {
+	switch ctx.Kind {
+	case mux.UpdateInlineQuery:
+		return true, self.answerInlineQuery(ctx)
+	}
+
+	return false, nil
+}
+
+func (self *clusterImpl) HandleCallback(ctx *mux.CallbackContext) error {
+	switch ctx.Callback.Action {
+	case "apply", "discard":
+		return self.answerApply(ctx)
+
+	case "rollback", "cancel-rollback":
+		return self.answerRollback(ctx)
+
+	case "health":
+		return self.drillHealth(ctx)
+
+	case "abort-drain":
+		return self.abortDrain(ctx)
+
+	case "abort-maintenance":
+		return self.abortMaintenance(ctx)
+
+	default:
+		return ctx.Alert("Unknown action " + ctx.Callback.Action)
+	}
+}
+
+func (self *clusterImpl) listClusters(ctx *mux.Context) error {
+	clusters := self.Clusters()
+	if len(clusters) == 0 {
+		return ctx.Reply("No cluster is configured")
+	}
+
+	selection, err := self.Selection(ctx.Message.Chat.ID)
+	if err != nil {
+		return err
+	}
+
+	table := render.Table{
+		Columns: []render.Column{
+			{Title: ""},
+			{Title: "CLUSTER"},
+			{Title: "NAMESPACE"},
+			{Title: "SERVER", Wide: true},
+		},
+		Wide: len(ctx.Args) > 0 && ctx.Args[0] == "wide",
+	}
+
+	for _, name := range clusters {
+		current := ""
+		label := name
+		namespace := self.registry[name].namespace
+
+		maintenance, err := self.Maintenance(name)
+		if err != nil {
+			return err
+		}
+
+		if maintenance {
+			label += " (maintenance)"
+		}
+
+		if name == selection.Cluster {
+			current = "*"
+			namespace = selection.Namespace
+		}
+
+		table.Rows = append(table.Rows, []string{
+			current,
+			label,
+			namespace,
+			self.registry[name].config.Host,
+		})
+	}
+
+	return ctx.SendTable(render.NewHTML(), table)
+}
+
+func (self *clusterImpl) useCluster(ctx *mux.Context) error {
+	if len(ctx.Args) == 0 || len(ctx.Args) > 2 {
+		return ctx.Reply("Usage: /use <cluster> [namespace]")
+	}
+
+	namespace := ""
+	if len(ctx.Args) == 2 {
+		namespace = ctx.Args[1]
+	}
+
+	if err := self.selectCluster(ctx.Message.Chat.ID, ctx.Args[0], namespace); err != nil {
+		if _, ok := self.registry[ctx.Args[0]]; !ok {
+			return ctx.Reply(err.Error())
+		}
+
+		return err
+	}
+
+	selection, err := self.Selection(ctx.Message.Chat.ID)
+	if err != nil {
+		return err
+	}
+
+	ctx.Audit.Target(selection.Cluster, selection.Namespace, "")
+
+	return ctx.Reply(fmt.Sprintf("This chat now works on cluster %s, namespace %s",
+		selection.Cluster, selection.Namespace))
+}
+
+// authorize checks that the sender has role on the cluster selected by the
+// chat, replying when they don't. The selection is the target of the audit.
+func (self *clusterImpl) authorize(ctx *mux.Context, role rbac.Role) (Selection, bool, error) {
+	selection, err := self.Selection(ctx.Message.Chat.ID)
+	if err != nil {
+		return selection, false, ctx.Reply(err.Error())
+	}
+
+	ctx.Audit.Target(selection.Cluster, selection.Namespace, "")
+
+	allowed, err := self.authorizeCluster(ctx, selection.Cluster, role)
+	return selection, allowed, err
+}
+
+// authorizeCluster checks that the sender has role on cluster, replying
+// when they don't.
+func (self *clusterImpl) authorizeCluster(ctx *mux.Context, cluster string, role rbac.Role) (bool, error) {
+	if ctx.Message.From == nil {
+		return false, ctx.Reply("Commands sent on behalf of a chat can't be authorized")
+	}
+
+	allowed, err := rbac.Allowed(ctx.Message.From.ID, cluster, role)
+	if err != nil {
+		return false, err
+	}
+
+	if !allowed {
+		ctx.Audit.Result = audit.ResultDenied
+		return false, ctx.Reply(fmt.Sprintf("You need the %s role on cluster %s to run /%s",
+			role, cluster, ctx.Command))
+	}
+
+	return true, nil
+}
+
+func (self *clusterImpl) reply(ctx *mux.Context, text string, markup interface{}) error {
+	_, err := ctx.Telegram.SendMessage(telegram.MessageConfig{
+		ChatID:           ctx.Message.Chat.ID,
+		Text:             text,
+		ReplyToMessageID: ctx.Message.MessageID,
+		ReplyMarkup:      markup,
+	})
+	return err
+}
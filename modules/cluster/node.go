@@ -0,0 +1,484 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/audit"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/jobs"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/mux"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/rbac"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/render"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/telegram"
+)
+
+const (
+	// drainPollInterval spaces the evictions retried while a disruption
+	// budget blocks them.
+	drainPollInterval = 5 * time.Second
+	// defaultDrainTimeout bounds a drain, $DRAIN_TIMEOUT overrides it.
+	defaultDrainTimeout = 10 * time.Minute
+	// mirrorPodAnnotation marks the static pods, which can't be evicted.
+	mirrorPodAnnotation = "kubernetes.io/config.mirror"
+)
+
+// drainOptions are the arguments of /drain.
+type drainOptions struct {
+	node        string
+	gracePeriod *int64
+	force       bool
+}
+
+func (self *clusterImpl) cordonNode(ctx *mux.Context) error {
+	return self.setSchedulable(ctx, false)
+}
+
+func (self *clusterImpl) uncordonNode(ctx *mux.Context) error {
+	return self.setSchedulable(ctx, true)
+}
+
+func (self *clusterImpl) setSchedulable(ctx *mux.Context, schedulable bool) error {
+	if len(ctx.Args) != 1 {
+		return ctx.Reply(fmt.Sprintf("Usage: /%s <node>", ctx.Command))
+	}
+
+	node := ctx.Args[0]
+
+	selection, allowed, err := self.authorize(ctx, rbac.RoleOperator)
+	if !allowed || err != nil {
+		return err
+	}
+
+	ctx.Audit.Target("", "", "node/"+node)
+
+	client, err := self.Client(selection.Cluster)
+	if err != nil {
+		return err
+	}
+
+	if err = cordon(client, node, !schedulable); err != nil {
+		if apierrors.IsNotFound(err) {
+			return ctx.Reply(fmt.Sprintf("Node %s doesn't exist in cluster %s", node, selection.Cluster))
+		}
+
+		return err
+	}
+
+	state := "cordoned"
+	if schedulable {
+		state = "uncordoned"
+	}
+
+	return ctx.Reply(fmt.Sprintf("Node %s of cluster %s is %s", node, selection.Cluster, state))
+}
+
+// drainJobKind is the kind of the jobs evicting the pods of a node.
+const drainJobKind = "cluster:drain"
+
+// drainJob is a drain left to the worker once the node is cordoned.
+type drainJob struct {
+	ID          string    `json:"id"`
+	Cluster     string    `json:"cluster"`
+	ChatID      int64     `json:"chat_id"`
+	MessageID   int       `json:"message_id"`
+	Node        string    `json:"node"`
+	GracePeriod *int64    `json:"grace_period,omitempty"`
+	Deadline    time.Time `json:"deadline"`
+}
+
+// drainNode cordons a node then leaves the eviction of its pods to the
+// worker, which goes through the eviction API so that the disruption
+// budgets are respected. A status message lists the remaining pods until
+// the node is empty, the drain times out or somebody presses its Abort
+// button.
+func (self *clusterImpl) drainNode(ctx *mux.Context) error {
+	options, err := parseDrainOptions(ctx.Args)
+	if err != nil {
+		return ctx.Reply(err.Error())
+	}
+
+	selection, allowed, err := self.authorize(ctx, rbac.RoleOperator)
+	if !allowed || err != nil {
+		return err
+	}
+
+	ctx.Audit.Target("", "", "node/"+options.node)
+
+	// The worker reads the drain and its Abort button from the store
+	if !self.store.Shared() {
+		return ctx.Reply("Drains run in the background, " + jobs.ErrNotShared.Error())
+	}
+
+	client, err := self.Client(selection.Cluster)
+	if err != nil {
+		return err
+	}
+
+	pods, err := podsOfNode(client, options.node)
+	if err != nil {
+		return err
+	}
+
+	if unmanaged := unmanagedPods(pods); len(unmanaged) > 0 && !options.force {
+		return ctx.Reply(fmt.Sprintf("These pods aren't managed by a controller and "+
+			"will be lost: %s. Add force to drain node %s anyway.",
+			strings.Join(unmanaged, ", "), options.node))
+	}
+
+	if err = cordon(client, options.node, true); err != nil {
+		if apierrors.IsNotFound(err) {
+			return ctx.Reply(fmt.Sprintf("Node %s doesn't exist in cluster %s",
+				options.node, selection.Cluster))
+		}
+
+		return err
+	}
+
+	id, err := newApplyID()
+	if err != nil {
+		return err
+	}
+
+	current := drainJob{
+		ID:          id,
+		Cluster:     selection.Cluster,
+		Node:        options.node,
+		GracePeriod: options.gracePeriod,
+		Deadline:    time.Now().Add(drainTimeout()),
+	}
+
+	status, err := mux.SendStatus(ctx.Telegram, ctx.Message.Chat.ID, ctx.Message.MessageID,
+		render.NewHTML().Bold(current.title()))
+	if err != nil {
+		return err
+	}
+
+	current.ChatID = status.ChatID()
+	current.MessageID = status.MessageID()
+
+	if _, err = jobs.Enqueue(self.store, drainJobKind, current); err != nil {
+		ctx.Audit.Result = audit.ResultFailed
+		ctx.Audit.Error = err.Error()
+
+		return status.Finish(drainProgress(current.title()+": failed: "+err.Error(), nil).
+			Line("The node stays cordoned, /uncordon it to schedule pods again."), nil)
+	}
+
+	return nil
+}
+
+func (self drainJob) title() string {
+	return fmt.Sprintf("Draining node %s of cluster %s", self.Node, self.Cluster)
+}
+
+// runDrainJob evicts the pods of a node cordoned by drainNode.
+func (self *clusterImpl) runDrainJob(ctx context.Context, bot telegram.Telegram, job jobs.Job) error {
+	current := drainJob{}
+	if err := job.Decode(&current); err != nil {
+		return err
+	}
+
+	client, err := self.Client(current.Cluster)
+	if err != nil {
+		return err
+	}
+
+	codec, err := mux.DefaultCodec()
+	if err != nil {
+		return err
+	}
+
+	// A drain resumed past its deadline still needs a valid button
+	ttl := time.Until(current.Deadline)
+	if ttl < time.Minute {
+		ttl = time.Minute
+	}
+
+	keyboard, err := mux.NewKeyboard(codec, ttl).
+		Button("Abort", mux.Callback{
+			Module: ModuleName,
+			Action: "abort-drain",
+			Args:   map[string]string{"id": current.ID, "cluster": current.Cluster},
+		}).
+		Markup()
+	if err != nil {
+		return err
+	}
+
+	title := current.title()
+	status := mux.NewStatus(bot, current.ChatID, current.MessageID)
+	options := drainOptions{node: current.Node, gracePeriod: current.GracePeriod}
+
+	result, remaining, err := self.evictPods(ctx, client, options, drainAbortKey(current.ID),
+		current.Deadline, func(remaining []drainPod) {
+			status.Update(drainProgress(title, remaining), keyboard)
+		})
+	if ctx.Err() != nil {
+		return ctx.Err()
+	} else if err != nil {
+		result = "failed: " + err.Error()
+	}
+
+	builder := drainProgress(fmt.Sprintf("%s: %s", title, result), remaining)
+	if len(remaining) > 0 {
+		builder.Line("The node stays cordoned, /uncordon it to schedule pods again.")
+	}
+
+	self.store.Delete(drainAbortKey(current.ID))
+	return status.Finish(builder, nil)
+}
+
+// drainPod is a pod being evicted and what prevents it from leaving.
+type drainPod struct {
+	name    string
+	blocked string
+}
+
+// evictPods evicts the pods of the node until none is left, abortKey is set
+// in the store, the deadline passes or ctx is done. It returns how the
+// drain ended and the pods which are still on the node.
+func (self *clusterImpl) evictPods(
+	ctx context.Context,
+	client *Client,
+	options drainOptions,
+	abortKey string,
+	deadline time.Time,
+	progress func(remaining []drainPod),
+) (string, []drainPod, error) {
+	for {
+		pods, err := podsOfNode(client, options.node)
+		if err != nil {
+			return "", nil, err
+		}
+
+		remaining := make([]drainPod, 0, len(pods))
+
+		for i := range pods {
+			pod := &pods[i]
+			if !evictable(pod) {
+				continue
+			}
+
+			name := pod.Namespace + "/" + pod.Name
+
+			if pod.DeletionTimestamp != nil {
+				remaining = append(remaining, drainPod{name: name, blocked: "terminating"})
+				continue
+			}
+
+			err = evict(client, pod, options.gracePeriod)
+			switch {
+			case err == nil, apierrors.IsNotFound(err):
+				remaining = append(remaining, drainPod{name: name, blocked: "evicted"})
+
+			case apierrors.IsTooManyRequests(err):
+				remaining = append(remaining, drainPod{name: name, blocked: "disruption budget"})
+
+			default:
+				remaining = append(remaining, drainPod{name: name, blocked: err.Error()})
+			}
+		}
+
+		if len(remaining) == 0 {
+			return "done", remaining, nil
+		}
+
+		sort.Slice(remaining, func(i, j int) bool {
+			return remaining[i].name < remaining[j].name
+		})
+
+		progress(remaining)
+
+		aborted := false
+		if _, err = self.store.Get(abortKey, &aborted); err != nil {
+			return "", remaining, err
+		}
+
+		if aborted {
+			return "aborted", remaining, nil
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Sprintf("timed out after %s", drainTimeout()), remaining, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return "", remaining, ctx.Err()
+
+		case <-time.After(drainPollInterval):
+		}
+	}
+}
+
+// abortDrain stops a drain at its next iteration, the drain runs in the
+// worker so the request goes through the store.
+func (self *clusterImpl) abortDrain(ctx *mux.CallbackContext) error {
+	cluster := ctx.Callback.Args["cluster"]
+
+	allowed, err := rbac.Allowed(ctx.Query.From.ID, cluster, rbac.RoleOperator)
+	if err != nil {
+		return err
+	}
+
+	if !allowed {
+		ctx.Audit.Result = audit.ResultDenied
+		return ctx.Alert("Only operators can abort a drain")
+	}
+
+	ctx.Audit.Target(cluster, "", "")
+
+	err = self.store.Set(drainAbortKey(ctx.Callback.Args["id"]), true, drainTimeout())
+	if err != nil {
+		return err
+	}
+
+	return ctx.Toast("Aborting the drain")
+}
+
+func drainProgress(title string, remaining []drainPod) render.Builder {
+	builder := render.NewHTML().Bold(title).Line("")
+
+	if len(remaining) == 0 {
+		return builder
+	}
+
+	builder.Line(fmt.Sprintf("%d pod(s) remaining:", len(remaining)))
+
+	// Keep the message below the limit of Telegram
+	for i, pod := range remaining {
+		if i == 30 {
+			builder.Line(fmt.Sprintf("… and %d more", len(remaining)-i))
+			break
+		}
+
+		builder.Text("• ").Code(pod.name).Line(" " + pod.blocked)
+	}
+
+	return builder
+}
+
+func parseDrainOptions(args []string) (drainOptions, error) {
+	usage := fmt.Errorf("Usage: /drain <node> [grace period in seconds] [force]")
+	options := drainOptions{}
+
+	if len(args) == 0 || len(args) > 3 {
+		return options, usage
+	}
+
+	options.node = args[0]
+
+	for _, arg := range args[1:] {
+		if arg == "force" {
+			options.force = true
+			continue
+		}
+
+		seconds, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil || seconds < 0 {
+			return options, usage
+		}
+
+		options.gracePeriod = &seconds
+	}
+
+	return options, nil
+}
+
+func drainTimeout() time.Duration {
+	if timeout, err := time.ParseDuration(os.Getenv("DRAIN_TIMEOUT")); err == nil && timeout > 0 {
+		return timeout
+	}
+
+	return defaultDrainTimeout
+}
+
+func drainAbortKey(id string) string {
+	return "cluster:drain:abort:" + id
+}
+
+func cordon(client *Client, node string, unschedulable bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	patch := fmt.Sprintf(`{"spec":{"unschedulable":%t}}`, unschedulable)
+
+	_, err := client.Clientset.CoreV1().Nodes().Patch(ctx, node,
+		types.StrategicMergePatchType, []byte(patch),
+		metav1.PatchOptions{FieldManager: FieldManager})
+	return err
+}
+
+func podsOfNode(client *Client, node string) ([]corev1.Pod, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	pods, err := client.Clientset.CoreV1().Pods(metav1.NamespaceAll).List(ctx, metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("spec.nodeName", node).String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return pods.Items, nil
+}
+
+// evictable skips the pods a drain leaves on the node: the static pods, the
+// pods of the daemon sets, which would be recreated there, and the finished
+// pods.
+func evictable(pod *corev1.Pod) bool {
+	if _, ok := pod.Annotations[mirrorPodAnnotation]; ok {
+		return false
+	}
+
+	if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+		return false
+	}
+
+	for _, owner := range pod.OwnerReferences {
+		if owner.Controller != nil && *owner.Controller && owner.Kind == "DaemonSet" {
+			return false
+		}
+	}
+
+	return true
+}
+
+func unmanagedPods(pods []corev1.Pod) []string {
+	names := make([]string, 0)
+
+	for i := range pods {
+		if evictable(&pods[i]) && metav1.GetControllerOf(&pods[i]) == nil {
+			names = append(names, pods[i].Namespace+"/"+pods[i].Name)
+		}
+	}
+
+	return names
+}
+
+func evict(client *Client, pod *corev1.Pod, gracePeriod *int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	return client.Clientset.PolicyV1().Evictions(pod.Namespace).Evict(ctx, &policyv1.Eviction{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      pod.Name,
+			Namespace: pod.Namespace,
+		},
+		DeleteOptions: &metav1.DeleteOptions{
+			GracePeriodSeconds: gracePeriod,
+		},
+	})
+}
@@ -0,0 +1,225 @@
+package cluster
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/container"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/modules/storage"
+)
+
+// Selection is the cluster and the namespace a chat works on.
+type Selection struct {
+	Cluster   string `json:"cluster"`
+	Namespace string `json:"namespace"`
+}
+
+// Client gives access to the APIs of a registered cluster.
+type Client struct {
+	Name      string
+	Config    *rest.Config
+	Clientset kubernetes.Interface
+	Dynamic   dynamic.Interface
+	Mapper    meta.RESTMapper
+}
+
+type registryEntry struct {
+	config    *rest.Config
+	namespace string
+	client    *Client
+}
+
+// loadKubeconfig reads the kubeconfig from $KUBECONFIG_CONTENT, which may be
+// encoded in base64 for platforms not supporting multi-line variables, or
+// from the files of $KUBECONFIG and ~/.kube/config. Every context of the
+// kubeconfig is a cluster of the registry.
+func loadKubeconfig() (*clientcmdapi.Config, error) {
+	content := os.Getenv("KUBECONFIG_CONTENT")
+
+	if len(content) > 0 {
+		if decoded, err := base64.StdEncoding.DecodeString(content); err == nil {
+			content = string(decoded)
+		}
+
+		return clientcmd.Load([]byte(content))
+	}
+
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	return rules.Load()
+}
+
+func (self *clusterImpl) loadRegistry() error {
+	kubeconfig, err := loadKubeconfig()
+	if err != nil {
+		return fmt.Errorf("Can't load kubeconfig: %v", err)
+	}
+
+	self.registry = make(map[string]*registryEntry)
+	self.defaultCluster = kubeconfig.CurrentContext
+
+	for name, context := range kubeconfig.Contexts {
+		config, err := clientcmd.NewNonInteractiveClientConfig(
+			*kubeconfig,
+			name,
+			&clientcmd.ConfigOverrides{},
+			nil,
+		).ClientConfig()
+		if err != nil {
+			return fmt.Errorf("Can't load context %s: %v", name, err)
+		}
+
+		namespace := context.Namespace
+		if len(namespace) == 0 {
+			namespace = "default"
+		}
+
+		self.registry[name] = &registryEntry{
+			config:    config,
+			namespace: namespace,
+		}
+	}
+
+	if _, ok := self.registry[self.defaultCluster]; !ok {
+		self.defaultCluster = ""
+
+		for _, name := range self.Clusters() {
+			self.defaultCluster = name
+			break
+		}
+	}
+
+	return nil
+}
+
+// publishRegistry saves the registered clusters in the table clusters when
+// the database is configured, so that it knows every cluster the bot
+// operates.
+func (self *clusterImpl) publishRegistry() error {
+	database, err := storage.Default()
+	if errors.Is(err, container.ErrNotRegistered) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	for _, name := range self.Clusters() {
+		err = database.SaveCluster(storage.Cluster{
+			Name:      name,
+			Server:    self.registry[name].config.Host,
+			Namespace: self.registry[name].namespace,
+		})
+		if err != nil {
+			return fmt.Errorf("Can't save cluster %s: %v", name, err)
+		}
+	}
+
+	return nil
+}
+
+// Clusters returns the names of the registered clusters.
+func (self *clusterImpl) Clusters() []string {
+	names := make([]string, 0, len(self.registry))
+
+	for name := range self.registry {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// Client returns the clients of cluster, they are created on first use.
+func (self *clusterImpl) Client(cluster string) (*Client, error) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	entry, ok := self.registry[cluster]
+	if !ok {
+		return nil, fmt.Errorf("Cluster %s isn't registered", cluster)
+	}
+
+	if entry.client != nil {
+		return entry.client, nil
+	}
+
+	clientset, err := kubernetes.NewForConfig(entry.config)
+	if err != nil {
+		return nil, err
+	}
+
+	dynamicClient, err := dynamic.NewForConfig(entry.config)
+	if err != nil {
+		return nil, err
+	}
+
+	entry.client = &Client{
+		Name:      cluster,
+		Config:    entry.config,
+		Clientset: clientset,
+		Dynamic:   dynamicClient,
+		Mapper: restmapper.NewDeferredDiscoveryRESTMapper(
+			memory.NewMemCacheClient(clientset.Discovery()),
+		),
+	}
+	return entry.client, nil
+}
+
+// Selection returns the cluster and the namespace chosen by the chat with
+// /use, default to the current context of the kubeconfig.
+func (self *clusterImpl) Selection(chatId int64) (Selection, error) {
+	selection := Selection{}
+
+	found, err := self.store.Get(selectionKey(chatId), &selection)
+	if err != nil {
+		return selection, err
+	}
+
+	if found {
+		if _, ok := self.registry[selection.Cluster]; ok {
+			return selection, nil
+		}
+	}
+
+	if len(self.defaultCluster) == 0 {
+		return selection, fmt.Errorf("No cluster is configured")
+	}
+
+	return Selection{
+		Cluster:   self.defaultCluster,
+		Namespace: self.registry[self.defaultCluster].namespace,
+	}, nil
+}
+
+func (self *clusterImpl) selectCluster(chatId int64, cluster, namespace string) error {
+	entry, ok := self.registry[cluster]
+	if !ok {
+		return fmt.Errorf("Cluster %s isn't registered, please choose one of %s",
+			cluster, strings.Join(self.Clusters(), ", "))
+	}
+
+	if len(namespace) == 0 {
+		namespace = entry.namespace
+	}
+
+	return self.store.Set(selectionKey(chatId), Selection{
+		Cluster:   cluster,
+		Namespace: namespace,
+	}, 0)
+}
+
+func selectionKey(chatId int64) string {
+	return fmt.Sprintf("cluster:selection:%d", chatId)
+}
@@ -0,0 +1,271 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/mux"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/rbac"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/render"
+)
+
+// versionsPageSize keeps the tables of images below the size limit of a
+// message.
+const versionsPageSize = 40
+
+// versions are what runs in a cluster: the version of the API server, the
+// nodes per kubelet version and the image of every container of the
+// deployments, keyed by <namespace>/<deployment>/<container>.
+type versions struct {
+	server   string
+	kubelets map[string][]string
+	images   map[string]string
+}
+
+func (self *clusterImpl) showVersions(ctx *mux.Context) error {
+	if len(ctx.Args) > 0 {
+		return ctx.Reply("Usage: /versions, the selected namespace is reported")
+	}
+
+	selection, allowed, err := self.authorize(ctx, rbac.RoleViewer)
+	if !allowed || err != nil {
+		return err
+	}
+
+	client, err := self.Client(selection.Cluster)
+	if err != nil {
+		return err
+	}
+
+	current, err := collectVersions(client, selection.Namespace)
+	if err != nil {
+		return err
+	}
+
+	builder := render.NewHTML().
+		Bold(fmt.Sprintf("Versions of cluster %s", selection.Cluster)).
+		Line("").
+		Text("Kubernetes ").Code(current.server).Line("")
+
+	for _, version := range sortedKeys(current.kubelets) {
+		builder.Text("Kubelet ").Code(version).
+			Line(fmt.Sprintf(" on %d node(s)", len(current.kubelets[version])))
+	}
+
+	if len(current.images) == 0 {
+		return ctx.Send(builder.Line(fmt.Sprintf("No deployment in namespace %s", selection.Namespace)))
+	}
+
+	table := render.Table{
+		Columns: []render.Column{
+			{Title: "DEPLOYMENT"},
+			{Title: "IMAGE"},
+		},
+		PageSize: versionsPageSize,
+	}
+
+	for _, key := range sortedKeys(current.images) {
+		// Drop the namespace, the table only shows the selected one
+		table.Rows = append(table.Rows, []string{
+			key[strings.Index(key, "/")+1:],
+			imageTag(current.images[key]),
+		})
+	}
+
+	return ctx.SendTable(builder, table)
+}
+
+// diffVersions compares the versions of two clusters, e.g. staging and
+// production, listing only what differs between them.
+func (self *clusterImpl) diffVersions(ctx *mux.Context) error {
+	if len(ctx.Args) < 2 || len(ctx.Args) > 3 {
+		return ctx.Reply("Usage: /diff_versions <cluster> <cluster> [namespace]")
+	}
+
+	namespace := metav1.NamespaceAll
+	if len(ctx.Args) == 3 {
+		namespace = ctx.Args[2]
+	}
+
+	ctx.Audit.Target(ctx.Args[0]+","+ctx.Args[1], namespace, "")
+
+	reports := make([]versions, 2)
+
+	for i, cluster := range ctx.Args[:2] {
+		allowed, err := self.authorizeCluster(ctx, cluster, rbac.RoleViewer)
+		if !allowed || err != nil {
+			return err
+		}
+
+		client, err := self.Client(cluster)
+		if err != nil {
+			return ctx.Reply(err.Error())
+		}
+
+		reports[i], err = collectVersions(client, namespace)
+		if err != nil {
+			return err
+		}
+	}
+
+	left, right := reports[0], reports[1]
+	builder := render.NewHTML().
+		Bold(fmt.Sprintf("Versions of %s against %s", ctx.Args[0], ctx.Args[1])).
+		Line("")
+
+	if left.server != right.server {
+		builder.Text("Kubernetes ").Code(left.server).Text(" against ").Code(right.server).Line("")
+	} else {
+		builder.Text("Same Kubernetes ").Code(left.server).Line("")
+	}
+
+	leftKubelets := strings.Join(sortedKeys(left.kubelets), ", ")
+	rightKubelets := strings.Join(sortedKeys(right.kubelets), ", ")
+
+	if leftKubelets != rightKubelets {
+		builder.Text("Kubelets ").Code(leftKubelets).Text(" against ").Code(rightKubelets).Line("")
+	} else {
+		builder.Text("Same kubelets ").Code(leftKubelets).Line("")
+	}
+
+	table := render.Table{
+		Columns: []render.Column{
+			{Title: "CONTAINER"},
+			{Title: strings.ToUpper(ctx.Args[0])},
+			{Title: strings.ToUpper(ctx.Args[1])},
+		},
+		PageSize: versionsPageSize,
+	}
+
+	keys := make(map[string]bool)
+	for key := range left.images {
+		keys[key] = true
+	}
+
+	for key := range right.images {
+		keys[key] = true
+	}
+
+	for _, key := range sortedKeys(keys) {
+		leftImage, rightImage := left.images[key], right.images[key]
+		if leftImage == rightImage {
+			continue
+		}
+
+		// The tags are enough unless the images come from other registries
+		leftShown, rightShown := imageTag(leftImage), imageTag(rightImage)
+		if imageRepository(leftImage) != imageRepository(rightImage) &&
+			len(leftImage) > 0 && len(rightImage) > 0 {
+			leftShown, rightShown = leftImage, rightImage
+		}
+
+		table.Rows = append(table.Rows, []string{key, orMissing(leftShown), orMissing(rightShown)})
+	}
+
+	if len(table.Rows) == 0 {
+		return ctx.Send(builder.Line("The deployments run the same images"))
+	}
+
+	builder.Line(fmt.Sprintf("%d container(s) drift:", len(table.Rows)))
+	return ctx.SendTable(builder, table)
+}
+
+func collectVersions(client *Client, namespace string) (versions, error) {
+	current := versions{
+		kubelets: make(map[string][]string),
+		images:   make(map[string]string),
+	}
+
+	server, err := client.Clientset.Discovery().ServerVersion()
+	if err != nil {
+		return current, err
+	}
+
+	current.server = server.GitVersion
+
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	nodes, err := client.Clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return current, err
+	}
+
+	for _, node := range nodes.Items {
+		version := node.Status.NodeInfo.KubeletVersion
+		current.kubelets[version] = append(current.kubelets[version], node.Name)
+	}
+
+	deployments, err := client.Clientset.AppsV1().Deployments(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return current, err
+	}
+
+	for _, deployment := range deployments.Items {
+		for _, container := range deployment.Spec.Template.Spec.Containers {
+			key := fmt.Sprintf("%s/%s/%s", deployment.Namespace, deployment.Name, container.Name)
+			current.images[key] = container.Image
+		}
+	}
+
+	return current, nil
+}
+
+// imageTag returns the tag of an image, or the beginning of its digest, the
+// way it's usually talked about, e.g. 1.25.3 for nginx:1.25.3.
+func imageTag(image string) string {
+	if index := strings.Index(image, "@"); index >= 0 {
+		digest := image[index+1:]
+		if len(digest) > 19 {
+			digest = digest[:19]
+		}
+
+		return digest
+	}
+
+	index := strings.LastIndex(image, ":")
+	if index < 0 || index < strings.LastIndex(image, "/") {
+		if len(image) == 0 {
+			return ""
+		}
+
+		return "latest"
+	}
+
+	return image[index+1:]
+}
+
+func imageRepository(image string) string {
+	if index := strings.Index(image, "@"); index >= 0 {
+		return image[:index]
+	}
+
+	index := strings.LastIndex(image, ":")
+	if index < 0 || index < strings.LastIndex(image, "/") {
+		return image
+	}
+
+	return image[:index]
+}
+
+func orMissing(value string) string {
+	if len(value) == 0 {
+		return "-"
+	}
+
+	return value
+}
+
+func sortedKeys[V any](values map[string]V) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,444 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/jobs"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/mux"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/render"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/telegram"
+)
+
+const (
+	// rolloutPollInterval spaces the checks of a rollout.
+	rolloutPollInterval = 5 * time.Second
+	// defaultRolloutTimeout bounds the watch of a rollout, $ROLLOUT_TIMEOUT
+	// overrides it.
+	defaultRolloutTimeout = 10 * time.Minute
+	// maxFailingPods keeps the report of a failed rollout short.
+	maxFailingPods = 10
+)
+
+// workload is a Deployment, a StatefulSet or a DaemonSet.
+type workload struct {
+	kind      string
+	namespace string
+	name      string
+}
+
+func (self workload) String() string {
+	return strings.ToLower(self.kind) + "/" + self.name
+}
+
+// parseWorkload reads <kind>/<name> with the kinds and short names of
+// kubectl, a bare name is a deployment.
+func parseWorkload(arg, namespace string) (workload, error) {
+	kind, name := "deployment", arg
+
+	if parts := strings.SplitN(arg, "/", 2); len(parts) == 2 {
+		kind, name = strings.ToLower(parts[0]), parts[1]
+	}
+
+	result := workload{namespace: namespace, name: name}
+
+	switch kind {
+	case "deployment", "deployments", "deploy":
+		result.kind = "Deployment"
+
+	case "statefulset", "statefulsets", "sts":
+		result.kind = "StatefulSet"
+
+	case "daemonset", "daemonsets", "ds":
+		result.kind = "DaemonSet"
+
+	default:
+		return result, fmt.Errorf("Kind %s isn't a deployment, a statefulset or a daemonset", kind)
+	}
+
+	if len(name) == 0 {
+		return result, fmt.Errorf("The %s has no name", strings.ToLower(result.kind))
+	}
+
+	return result, nil
+}
+
+// rollout is the progress of a workload towards its desired state.
+type rollout struct {
+	desired   int32
+	updated   int32
+	ready     int32
+	available int32
+	// selector matches the pods of the workload.
+	selector string
+	// done is set once every replica runs the latest template.
+	done bool
+	// failure tells why the rollout can't progress anymore.
+	failure string
+}
+
+func (self rollout) String() string {
+	return fmt.Sprintf("%d desired, %d updated, %d ready, %d available",
+		self.desired, self.updated, self.ready, self.available)
+}
+
+// rolloutJobKind is the kind of the jobs following a rollout, the webhook
+// answers right after the change while the worker follows it.
+const rolloutJobKind = "cluster:rollout"
+
+// rolloutJob is the rollout of a workload followed in a status message.
+type rolloutJob struct {
+	Cluster   string    `json:"cluster"`
+	ChatID    int64     `json:"chat_id"`
+	MessageID int       `json:"message_id"`
+	Title     string    `json:"title"`
+	Kind      string    `json:"kind"`
+	Namespace string    `json:"namespace"`
+	Name      string    `json:"name"`
+	Deadline  time.Time `json:"deadline"`
+}
+
+func (self rolloutJob) workload() workload {
+	return workload{kind: self.Kind, namespace: self.Namespace, name: self.Name}
+}
+
+// enqueueRollout hands the rollout of target over to the worker, which
+// edits status with its progress. Without a worker, status only tells that
+// the change is applied.
+func (self *clusterImpl) enqueueRollout(status mux.Status, cluster, title string, target workload) error {
+	_, err := jobs.Enqueue(self.store, rolloutJobKind, rolloutJob{
+		Cluster:   cluster,
+		ChatID:    status.ChatID(),
+		MessageID: status.MessageID(),
+		Title:     title,
+		Kind:      target.kind,
+		Namespace: target.namespace,
+		Name:      target.name,
+		Deadline:  time.Now().Add(rolloutTimeout()),
+	})
+	if errors.Is(err, jobs.ErrNotShared) {
+		return status.Finish(render.NewHTML().
+			Bold(title+": applied").
+			Line("").
+			Line("The rollout isn't followed, "+err.Error()), nil)
+	}
+
+	return err
+}
+
+// runRolloutJob follows a rollout enqueued by enqueueRollout.
+func (self *clusterImpl) runRolloutJob(ctx context.Context, bot telegram.Telegram, job jobs.Job) error {
+	current := rolloutJob{}
+	if err := job.Decode(&current); err != nil {
+		return err
+	}
+
+	client, err := self.Client(current.Cluster)
+	if err != nil {
+		return err
+	}
+
+	status := mux.NewStatus(bot, current.ChatID, current.MessageID)
+
+	_, err = followRollout(ctx, client, status, current.Title, current.workload(), current.Deadline)
+	return err
+}
+
+// followRollout watches the rollout of target in status until it's done,
+// it fails or the deadline passes. The final text lists the reasons of the
+// failing pods unless the rollout is done, which is returned as "done".
+func followRollout(
+	ctx context.Context,
+	client *Client,
+	status mux.Status,
+	title string,
+	target workload,
+	deadline time.Time,
+) (string, error) {
+	progress, result, err := watchRollout(ctx, client, status, title, target, deadline)
+	if ctx.Err() != nil {
+		return "", ctx.Err()
+	}
+
+	if err != nil {
+		result = "failed: " + err.Error()
+	}
+
+	builder := render.NewHTML().
+		Bold(fmt.Sprintf("%s: %s", title, result)).
+		Line("").
+		Line(progress.String())
+
+	if result != "done" && len(progress.selector) > 0 {
+		failing, err := failingPods(client, target.namespace, progress.selector)
+		if err != nil {
+			return result, err
+		}
+
+		for i, pod := range failing {
+			if i == maxFailingPods {
+				builder.Line(fmt.Sprintf("… and %d more", len(failing)-i))
+				break
+			}
+
+			builder.Text("• ").Code(pod[0]).Line(" " + pod[1])
+		}
+	}
+
+	return result, status.Finish(builder, nil)
+}
+
+// watchRollout polls a rollout until it's done, it fails, the deadline
+// passes or ctx is done, editing status with its progress. It returns the
+// last progress and how the rollout ended.
+func watchRollout(
+	ctx context.Context,
+	client *Client,
+	status mux.Status,
+	title string,
+	target workload,
+	deadline time.Time,
+) (rollout, string, error) {
+	for {
+		progress, err := workloadRollout(client, target)
+		if err != nil {
+			return progress, "", err
+		}
+
+		switch {
+		case progress.done:
+			return progress, "done", nil
+
+		case len(progress.failure) > 0:
+			return progress, "failed: " + progress.failure, nil
+
+		case time.Now().After(deadline):
+			return progress, fmt.Sprintf("timed out after %s", rolloutTimeout()), nil
+		}
+
+		status.Update(render.NewHTML().Bold(title).Line("").Line(progress.String()), nil)
+
+		select {
+		case <-ctx.Done():
+			return progress, "", ctx.Err()
+
+		case <-time.After(rolloutPollInterval):
+		}
+	}
+}
+
+// workloadRollout reads the progress of a workload the way kubectl rollout
+// status does.
+func workloadRollout(client *Client, target workload) (rollout, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	apps := client.Clientset.AppsV1()
+
+	switch target.kind {
+	case "Deployment":
+		deployment, err := apps.Deployments(target.namespace).Get(ctx, target.name, metav1.GetOptions{})
+		if err != nil {
+			return rollout{}, err
+		}
+
+		return deploymentRollout(deployment), nil
+
+	case "StatefulSet":
+		statefulSet, err := apps.StatefulSets(target.namespace).Get(ctx, target.name, metav1.GetOptions{})
+		if err != nil {
+			return rollout{}, err
+		}
+
+		return statefulSetRollout(statefulSet), nil
+
+	case "DaemonSet":
+		daemonSet, err := apps.DaemonSets(target.namespace).Get(ctx, target.name, metav1.GetOptions{})
+		if err != nil {
+			return rollout{}, err
+		}
+
+		return daemonSetRollout(daemonSet), nil
+	}
+
+	return rollout{}, fmt.Errorf("%s has no rollout", target.kind)
+}
+
+func deploymentRollout(deployment *appsv1.Deployment) rollout {
+	progress := rollout{
+		desired:   replicasOf(deployment.Spec.Replicas),
+		updated:   deployment.Status.UpdatedReplicas,
+		ready:     deployment.Status.ReadyReplicas,
+		available: deployment.Status.AvailableReplicas,
+		selector:  selectorOf(deployment.Spec.Selector),
+	}
+
+	if deployment.Status.ObservedGeneration < deployment.Generation {
+		return progress
+	}
+
+	for _, condition := range deployment.Status.Conditions {
+		if condition.Type == appsv1.DeploymentProgressing &&
+			condition.Reason == "ProgressDeadlineExceeded" {
+			progress.failure = condition.Message
+		}
+	}
+
+	progress.done = progress.updated == progress.desired &&
+		deployment.Status.Replicas == progress.updated &&
+		progress.available == progress.updated
+
+	return progress
+}
+
+func statefulSetRollout(statefulSet *appsv1.StatefulSet) rollout {
+	progress := rollout{
+		desired:   replicasOf(statefulSet.Spec.Replicas),
+		updated:   statefulSet.Status.UpdatedReplicas,
+		ready:     statefulSet.Status.ReadyReplicas,
+		available: statefulSet.Status.AvailableReplicas,
+		selector:  selectorOf(statefulSet.Spec.Selector),
+	}
+
+	if statefulSet.Status.ObservedGeneration < statefulSet.Generation {
+		return progress
+	}
+
+	// The OnDelete strategy leaves the pods to the user, like kubectl only
+	// the ready replicas are awaited
+	if statefulSet.Spec.UpdateStrategy.Type == appsv1.OnDeleteStatefulSetStrategyType {
+		progress.done = progress.ready == progress.desired
+		return progress
+	}
+
+	partition := int32(0)
+	if update := statefulSet.Spec.UpdateStrategy.RollingUpdate; update != nil && update.Partition != nil {
+		partition = *update.Partition
+	}
+
+	progress.done = progress.ready == progress.desired &&
+		progress.updated >= progress.desired-partition &&
+		(partition > 0 || statefulSet.Status.UpdateRevision == statefulSet.Status.CurrentRevision)
+
+	return progress
+}
+
+func daemonSetRollout(daemonSet *appsv1.DaemonSet) rollout {
+	progress := rollout{
+		desired:   daemonSet.Status.DesiredNumberScheduled,
+		updated:   daemonSet.Status.UpdatedNumberScheduled,
+		ready:     daemonSet.Status.NumberReady,
+		available: daemonSet.Status.NumberAvailable,
+		selector:  selectorOf(daemonSet.Spec.Selector),
+	}
+
+	if daemonSet.Status.ObservedGeneration < daemonSet.Generation {
+		return progress
+	}
+
+	progress.done = progress.updated == progress.desired &&
+		progress.available == progress.desired
+
+	return progress
+}
+
+// failingPods returns the name and the reason of the pods matching selector
+// which aren't ready.
+func failingPods(client *Client, namespace, selector string) ([][2]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	pods, err := client.Clientset.CoreV1().Pods(namespace).
+		List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, err
+	}
+
+	failing := make([][2]string, 0)
+
+	for i := range pods.Items {
+		if reason := podFailure(&pods.Items[i]); len(reason) > 0 {
+			failing = append(failing, [2]string{pods.Items[i].Name, reason})
+		}
+	}
+
+	sort.Slice(failing, func(i, j int) bool {
+		return failing[i][0] < failing[j][0]
+	})
+
+	return failing, nil
+}
+
+// podFailure explains why a pod isn't ready, or returns nothing when it is.
+func podFailure(pod *corev1.Pod) string {
+	if pod.DeletionTimestamp != nil {
+		return ""
+	}
+
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodScheduled && condition.Status == corev1.ConditionFalse {
+			return strings.TrimSpace(condition.Reason + ": " + condition.Message)
+		}
+	}
+
+	statuses := append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...),
+		pod.Status.ContainerStatuses...)
+
+	for _, status := range statuses {
+		if status.Ready {
+			continue
+		}
+
+		if waiting := status.State.Waiting; waiting != nil && len(waiting.Reason) > 0 {
+			reason := waiting.Reason
+			if len(waiting.Message) > 0 {
+				reason += ": " + waiting.Message
+			}
+
+			// The reason of the last crash tells more than CrashLoopBackOff
+			if terminated := status.LastTerminationState.Terminated; terminated != nil {
+				reason += fmt.Sprintf(" (last exit %d %s)", terminated.ExitCode, terminated.Reason)
+			}
+
+			return reason
+		}
+
+		if terminated := status.State.Terminated; terminated != nil && terminated.ExitCode != 0 {
+			return fmt.Sprintf("%s, exit code %d", terminated.Reason, terminated.ExitCode)
+		}
+	}
+
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodReady && condition.Status != corev1.ConditionTrue {
+			return "not ready " + strings.TrimSpace(condition.Message)
+		}
+	}
+
+	return ""
+}
+
+func selectorOf(selector *metav1.LabelSelector) string {
+	converted, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return ""
+	}
+
+	return converted.String()
+}
+
+func rolloutTimeout() time.Duration {
+	if timeout, err := time.ParseDuration(os.Getenv("ROLLOUT_TIMEOUT")); err == nil && timeout > 0 {
+		return timeout
+	}
+
+	return defaultRolloutTimeout
+}
@@ -0,0 +1,127 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/audit"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/mux"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/rbac"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/render"
+)
+
+// restartedAtAnnotation is set on the pod template to restart a workload,
+// like kubectl rollout restart.
+const restartedAtAnnotation = "kubectl.kubernetes.io/restartedAt"
+
+func (self *clusterImpl) restartWorkload(ctx *mux.Context) error {
+	if len(ctx.Args) != 1 {
+		return ctx.Reply("Usage: /restart [deployment|statefulset|daemonset/]<name>")
+	}
+
+	return self.changeWorkload(ctx, "Restarting", func(client *Client, target workload) error {
+		return restart(client, target)
+	})
+}
+
+func (self *clusterImpl) scaleWorkload(ctx *mux.Context) error {
+	usage := "Usage: /scale [deployment|statefulset/]<name> <replicas>"
+
+	if len(ctx.Args) != 2 {
+		return ctx.Reply(usage)
+	}
+
+	replicas, err := strconv.ParseInt(ctx.Args[1], 10, 32)
+	if err != nil || replicas < 0 {
+		return ctx.Reply(usage)
+	}
+
+	return self.changeWorkload(ctx, fmt.Sprintf("Scaling to %d", replicas),
+		func(client *Client, target workload) error {
+			return scale(client, scaledWorkload{
+				Namespace: target.namespace,
+				Kind:      target.kind,
+				Name:      target.name,
+			}, int32(replicas))
+		})
+}
+
+// changeWorkload applies change to the workload named by the first argument
+// in the selected namespace, then leaves its rollout to the worker, which
+// follows it in one message.
+func (self *clusterImpl) changeWorkload(
+	ctx *mux.Context,
+	action string,
+	change func(client *Client, target workload) error,
+) error {
+	selection, allowed, err := self.authorize(ctx, rbac.RoleOperator)
+	if !allowed || err != nil {
+		return err
+	}
+
+	target, err := parseWorkload(ctx.Args[0], selection.Namespace)
+	if err != nil {
+		return ctx.Reply(err.Error())
+	}
+
+	ctx.Audit.Target("", "", target.String())
+
+	client, err := self.Client(selection.Cluster)
+	if err != nil {
+		return err
+	}
+
+	if err = change(client, target); err != nil {
+		if apierrors.IsNotFound(err) {
+			return ctx.Reply(fmt.Sprintf("%s doesn't exist in namespace %s", target, target.namespace))
+		}
+
+		ctx.Audit.Result = audit.ResultFailed
+		ctx.Audit.Error = err.Error()
+		return ctx.Reply(err.Error())
+	}
+
+	title := fmt.Sprintf("%s %s of cluster %s", action, target, selection.Cluster)
+
+	status, err := mux.SendStatus(ctx.Telegram, ctx.Message.Chat.ID, ctx.Message.MessageID,
+		render.NewHTML().Bold(title))
+	if err != nil {
+		return err
+	}
+
+	return self.enqueueRollout(status, selection.Cluster, title, target)
+}
+
+func restart(client *Client, target workload) error {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	patch := []byte(fmt.Sprintf(`{"spec":{"template":{"metadata":{"annotations":{%q:%q}}}}}`,
+		restartedAtAnnotation, time.Now().Format(time.RFC3339)))
+	options := metav1.PatchOptions{FieldManager: FieldManager}
+	apps := client.Clientset.AppsV1()
+
+	var err error
+
+	switch target.kind {
+	case "Deployment":
+		_, err = apps.Deployments(target.namespace).
+			Patch(ctx, target.name, types.StrategicMergePatchType, patch, options)
+
+	case "StatefulSet":
+		_, err = apps.StatefulSets(target.namespace).
+			Patch(ctx, target.name, types.StrategicMergePatchType, patch, options)
+
+	case "DaemonSet":
+		_, err = apps.DaemonSets(target.namespace).
+			Patch(ctx, target.name, types.StrategicMergePatchType, patch, options)
+	}
+
+	return err
+}
@@ -0,0 +1,264 @@
+package jira
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// requestTimeout bounds every call to Jira.
+const requestTimeout = 30 * time.Second
+
+// Issue is the part of a Jira issue the bot uses.
+type Issue struct {
+	ID     string `json:"id"`
+	Key    string `json:"key"`
+	Fields struct {
+		Summary string `json:"summary"`
+		Status  struct {
+			Name string `json:"name"`
+			// StatusCategory groups the statuses of every workflow, its
+			// key is new, indeterminate or done.
+			StatusCategory struct {
+				Key string `json:"key"`
+			} `json:"statusCategory"`
+		} `json:"status"`
+	} `json:"fields"`
+}
+
+// Transition moves an issue to another status.
+type Transition struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	To   struct {
+		Name string `json:"name"`
+	} `json:"to"`
+}
+
+// Client calls the REST API v2 of Jira, so that descriptions and comments
+// are plain text with the Jira wiki markup.
+type Client interface {
+	// BrowseURL returns the link to the issue key in the web UI.
+	BrowseURL(key string) string
+
+	CreateIssue(project, issueType, summary, description string, labels []string) (*Issue, error)
+	Issue(key string) (*Issue, error)
+	AddComment(key, body string) error
+	AddAttachment(key, fileName string, content []byte) error
+	Transitions(key string) ([]Transition, error)
+	DoTransition(key, transitionId, comment string) error
+}
+
+type clientImpl struct {
+	baseURL string
+	user    string
+	token   string
+	client  *http.Client
+}
+
+// NewClient talks to the Jira at baseURL, e.g. https://acme.atlassian.net,
+// authenticated with user and its API token. A local stand-in of the API
+// may be used as baseURL.
+func NewClient(baseURL, user, token string) Client {
+	return &clientImpl{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		user:    user,
+		token:   token,
+		client:  &http.Client{Timeout: requestTimeout},
+	}
+}
+
+func (self *clientImpl) BrowseURL(key string) string {
+	return fmt.Sprintf("%s/browse/%s", self.baseURL, key)
+}
+
+func (self *clientImpl) CreateIssue(
+	project, issueType, summary, description string,
+	labels []string,
+) (*Issue, error) {
+	params := map[string]interface{}{
+		"fields": map[string]interface{}{
+			"project":     map[string]string{"key": project},
+			"issuetype":   map[string]string{"name": issueType},
+			"summary":     summary,
+			"description": description,
+			"labels":      labels,
+		},
+	}
+
+	created := &Issue{}
+	if err := self.request("POST", "/rest/api/2/issue", params, created); err != nil {
+		return nil, err
+	}
+
+	// The creation only returns the key, read the issue for its status
+	return self.Issue(created.Key)
+}
+
+func (self *clientImpl) Issue(key string) (*Issue, error) {
+	issue := &Issue{}
+
+	err := self.request("GET", "/rest/api/2/issue/"+url.PathEscape(key)+"?fields=summary,status",
+		nil, issue)
+	if err != nil {
+		return nil, err
+	}
+
+	return issue, nil
+}
+
+func (self *clientImpl) AddComment(key, body string) error {
+	return self.request("POST", "/rest/api/2/issue/"+url.PathEscape(key)+"/comment",
+		map[string]string{"body": body}, nil)
+}
+
+func (self *clientImpl) AddAttachment(key, fileName string, content []byte) error {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+
+	part, err := writer.CreateFormFile("file", fileName)
+	if err != nil {
+		return err
+	}
+
+	if _, err = part.Write(content); err != nil {
+		return err
+	}
+
+	if err = writer.Close(); err != nil {
+		return err
+	}
+
+	request, err := http.NewRequest("POST",
+		self.baseURL+"/rest/api/2/issue/"+url.PathEscape(key)+"/attachments", body)
+	if err != nil {
+		return err
+	}
+
+	request.Header.Set("Content-Type", writer.FormDataContentType())
+	// Jira rejects uploads without this header as a CSRF protection
+	request.Header.Set("X-Atlassian-Token", "no-check")
+
+	return self.do(request, nil)
+}
+
+func (self *clientImpl) Transitions(key string) ([]Transition, error) {
+	result := struct {
+		Transitions []Transition `json:"transitions"`
+	}{}
+
+	err := self.request("GET", "/rest/api/2/issue/"+url.PathEscape(key)+"/transitions",
+		nil, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	return result.Transitions, nil
+}
+
+func (self *clientImpl) DoTransition(key, transitionId, comment string) error {
+	params := map[string]interface{}{
+		"transition": map[string]string{"id": transitionId},
+	}
+
+	if len(comment) > 0 {
+		params["update"] = map[string]interface{}{
+			"comment": []interface{}{
+				map[string]interface{}{
+					"add": map[string]string{"body": comment},
+				},
+			},
+		}
+	}
+
+	return self.request("POST", "/rest/api/2/issue/"+url.PathEscape(key)+"/transitions",
+		params, nil)
+}
+
+func (self *clientImpl) request(method, path string, params, result interface{}) error {
+	var body io.Reader
+
+	if params != nil {
+		encoded, err := json.Marshal(params)
+		if err != nil {
+			return err
+		}
+
+		body = bytes.NewReader(encoded)
+	}
+
+	request, err := http.NewRequest(method, self.baseURL+path, body)
+	if err != nil {
+		return err
+	}
+
+	request.Header.Set("Accept", "application/json")
+	if params != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+
+	return self.do(request, result)
+}
+
+func (self *clientImpl) do(request *http.Request, result interface{}) error {
+	if len(self.user) > 0 || len(self.token) > 0 {
+		request.SetBasicAuth(self.user, self.token)
+	}
+
+	resp, err := self.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return newError(request, resp)
+	}
+
+	if result == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+
+	if err = json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("Error parsing response of Jira: %v", err)
+	}
+
+	return nil
+}
+
+// newError reports the messages of a failing call, Jira lists them in
+// errorMessages and per field in errors.
+func newError(request *http.Request, resp *http.Response) error {
+	failure := struct {
+		ErrorMessages []string          `json:"errorMessages"`
+		Errors        map[string]string `json:"errors"`
+	}{}
+
+	messages := []string{}
+
+	if err := json.NewDecoder(resp.Body).Decode(&failure); err == nil {
+		messages = append(messages, failure.ErrorMessages...)
+
+		fields := make([]string, 0, len(failure.Errors))
+		for field, message := range failure.Errors {
+			fields = append(fields, fmt.Sprintf("%s: %s", field, message))
+		}
+
+		sort.Strings(fields)
+		messages = append(messages, fields...)
+	}
+
+	if len(messages) == 0 {
+		messages = append(messages, resp.Status)
+	}
+
+	return fmt.Errorf("Jira fails to %s %s: %s", request.Method, request.URL.Path,
+		strings.Join(messages, "; "))
+}
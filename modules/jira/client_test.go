@@ -0,0 +1,223 @@
+package jira
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// standIn records the requests of the client and answers them like Jira.
+type standIn struct {
+	t        *testing.T
+	requests []*http.Request
+	bodies   []string
+}
+
+func newStandIn(t *testing.T, handler http.HandlerFunc) (*standIn, Client) {
+	stand := &standIn{t: t}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, token, ok := r.BasicAuth()
+		if !ok || user != "bot@acme.com" || token != "secret" {
+			t.Errorf("%s %s isn't authenticated", r.Method, r.URL.Path)
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		stand.requests = append(stand.requests, r)
+		stand.bodies = append(stand.bodies, string(body))
+
+		r.Body = io.NopCloser(strings.NewReader(string(body)))
+		handler(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	return stand, NewClient(server.URL+"/", "bot@acme.com", "secret")
+}
+
+func (self *standIn) json(index int, value interface{}) {
+	if err := json.Unmarshal([]byte(self.bodies[index]), value); err != nil {
+		self.t.Fatalf("Body of request %d isn't JSON: %v", index, err)
+	}
+}
+
+func TestCreateIssue(t *testing.T) {
+	stand, client := newStandIn(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method + " " + r.URL.Path {
+		case "POST /rest/api/2/issue":
+			w.WriteHeader(http.StatusCreated)
+			io.WriteString(w, `{"id":"10001","key":"OPS-1"}`)
+
+		case "GET /rest/api/2/issue/OPS-1":
+			io.WriteString(w, `{"id":"10001","key":"OPS-1","fields":{"summary":"API is down","status":{"name":"Open"}}}`)
+
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	issue, err := client.CreateIssue("OPS", "Task", "API is down", "Opened from Telegram", []string{"telegram-bot"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if issue.Key != "OPS-1" || issue.Fields.Status.Name != "Open" {
+		t.Errorf("Issue %s is %q, expected OPS-1 to be Open", issue.Key, issue.Fields.Status.Name)
+	}
+
+	created := struct {
+		Fields struct {
+			Project   map[string]string `json:"project"`
+			IssueType map[string]string `json:"issuetype"`
+			Summary   string            `json:"summary"`
+			Labels    []string          `json:"labels"`
+		} `json:"fields"`
+	}{}
+	stand.json(0, &created)
+
+	if created.Fields.Project["key"] != "OPS" || created.Fields.IssueType["name"] != "Task" {
+		t.Errorf("Issue is created in %v as %v", created.Fields.Project, created.Fields.IssueType)
+	}
+
+	if created.Fields.Summary != "API is down" || len(created.Fields.Labels) != 1 {
+		t.Errorf("Issue is created with summary %q and labels %v",
+			created.Fields.Summary, created.Fields.Labels)
+	}
+
+	// The trailing slash of the base URL is dropped
+	if url := client.BrowseURL("OPS-1"); strings.Contains(url, "//browse") ||
+		!strings.HasSuffix(url, "/browse/OPS-1") {
+		t.Errorf("Issue is browsed at %s", url)
+	}
+}
+
+func TestAddComment(t *testing.T) {
+	stand, client := newStandIn(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/rest/api/2/issue/OPS-1/comment" {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, `{"id":"1"}`)
+	})
+
+	if err := client.AddComment("OPS-1", "Rolled back"); err != nil {
+		t.Fatal(err)
+	}
+
+	comment := map[string]string{}
+	stand.json(0, &comment)
+
+	if comment["body"] != "Rolled back" {
+		t.Errorf("Comment is %q", comment["body"])
+	}
+}
+
+func TestTransition(t *testing.T) {
+	stand, client := newStandIn(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method + " " + r.URL.Path {
+		case "GET /rest/api/2/issue/OPS-1/transitions":
+			io.WriteString(w, `{"transitions":[{"id":"11","name":"Start","to":{"name":"In Progress"}},`+
+				`{"id":"31","name":"Resolve","to":{"name":"Done"}}]}`)
+
+		case "POST /rest/api/2/issue/OPS-1/transitions":
+			w.WriteHeader(http.StatusNoContent)
+
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	transitions, err := client.Transitions("OPS-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(transitions) != 2 || transitions[1].ID != "31" || transitions[1].To.Name != "Done" {
+		t.Fatalf("Transitions are %+v", transitions)
+	}
+
+	if err = client.DoTransition("OPS-1", "31", "Closed from Telegram"); err != nil {
+		t.Fatal(err)
+	}
+
+	done := struct {
+		Transition map[string]string `json:"transition"`
+		Update     struct {
+			Comment []struct {
+				Add map[string]string `json:"add"`
+			} `json:"comment"`
+		} `json:"update"`
+	}{}
+	stand.json(1, &done)
+
+	if done.Transition["id"] != "31" {
+		t.Errorf("Transition %v is done instead of 31", done.Transition)
+	}
+
+	if len(done.Update.Comment) != 1 || done.Update.Comment[0].Add["body"] != "Closed from Telegram" {
+		t.Errorf("Transition is commented with %+v", done.Update.Comment)
+	}
+}
+
+func TestAddAttachment(t *testing.T) {
+	stand, client := newStandIn(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/rest/api/2/issue/OPS-1/attachments" {
+			http.NotFound(w, r)
+			return
+		}
+
+		if r.Header.Get("X-Atlassian-Token") != "no-check" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+
+		content, _ := io.ReadAll(file)
+		if header.Filename != "transcript.txt" || string(content) != "alice: the API is down" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		io.WriteString(w, `[{"id":"1","filename":"transcript.txt"}]`)
+	})
+
+	if err := client.AddAttachment("OPS-1", "transcript.txt", []byte("alice: the API is down")); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(stand.requests) != 1 {
+		t.Errorf("%d requests are sent to upload one file", len(stand.requests))
+	}
+}
+
+func TestError(t *testing.T) {
+	_, client := newStandIn(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"errorMessages":["Issue is closed"],"errors":{"summary":"is required"}}`)
+	})
+
+	err := client.AddComment("OPS-1", "Too late")
+	if err == nil {
+		t.Fatal("A rejected comment doesn't fail")
+	}
+
+	for _, expected := range []string{"Issue is closed", "summary: is required"} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("Error %q doesn't report %q", err, expected)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package jira
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/hung0913208/telegram-bot-for-kubernetes/modules/cluster"
+)
+
+// eventCount is how many events are written in the description of an
+// incident.
+const eventCount = 30
+
+// selectedCluster returns the cluster and the namespace selected by the
+// chat.
+func selectedCluster(chatId int64) (cluster.Selection, error) {
+	clusters, err := cluster.Default()
+	if err != nil {
+		return cluster.Selection{}, err
+	}
+
+	return clusters.Selection(chatId)
+}
+
+// recentEvents lists the latest events of the selected namespace, the oldest
+// first. The caller checks that the user may read the cluster.
+func recentEvents(selection cluster.Selection) (string, error) {
+	clusters, err := cluster.Default()
+	if err != nil {
+		return "", err
+	}
+
+	client, err := clusters.Client(selection.Cluster)
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	events, err := client.Clientset.CoreV1().
+		Events(selection.Namespace).
+		List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return "", err
+	}
+
+	items := events.Items
+	sort.Slice(items, func(i, j int) bool {
+		return eventTime(&items[i]).Before(eventTime(&items[j]))
+	})
+
+	if len(items) > eventCount {
+		items = items[len(items)-eventCount:]
+	}
+
+	if len(items) == 0 {
+		return "No event\n", nil
+	}
+
+	var builder strings.Builder
+
+	for i := range items {
+		event := &items[i]
+
+		builder.WriteString(fmt.Sprintf("%s %s %s %s/%s: %s\n",
+			eventTime(event).UTC().Format(time.RFC3339),
+			event.Type,
+			event.Reason,
+			strings.ToLower(event.InvolvedObject.Kind),
+			event.InvolvedObject.Name,
+			strings.TrimSpace(event.Message)))
+	}
+
+	return builder.String(), nil
+}
+
+// eventTime returns when the event was last seen, the events.k8s.io API only
+// fills EventTime.
+func eventTime(event *corev1.Event) time.Time {
+	switch {
+	case !event.LastTimestamp.IsZero():
+		return event.LastTimestamp.Time
+
+	case !event.EventTime.IsZero():
+		return event.EventTime.Time
+
+	default:
+		return event.CreationTimestamp.Time
+	}
+}
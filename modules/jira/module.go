@@ -0,0 +1,382 @@
+package jira
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/audit"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/container"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/jobs"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/mux"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/rbac"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/render"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/state"
+)
+
+const ModuleName = "jira"
+
+type Jira interface {
+	container.Module
+
+	Commands() []mux.Command
+	UpdateKinds() []string
+	HandleUpdate(ctx *mux.UpdateContext) (bool, error)
+}
+
+// incident is the issue opened from a chat, a chat has one open incident at
+// a time.
+type incident struct {
+	Key       string    `json:"key"`
+	Summary   string    `json:"summary"`
+	Cluster   string    `json:"cluster"`
+	Namespace string    `json:"namespace"`
+	OpenedBy  int64     `json:"opened_by"`
+	OpenedAt  time.Time `json:"opened_at"`
+}
+
+type jiraImpl struct {
+	store           state.Store
+	client          Client
+	project         string
+	issueType       string
+	closeTransition string
+}
+
+// NewModule opens the incidents in the Jira configured by $JIRA_URL,
+// $JIRA_USER and $JIRA_TOKEN, as issues of $JIRA_ISSUE_TYPE, default to
+// Task, in the project $JIRA_PROJECT. They are closed by the transition
+// $JIRA_CLOSE_TRANSITION, default to Done.
+func NewModule(store state.Store) Jira {
+	return &jiraImpl{
+		store: store,
+	}
+}
+
+func (self *jiraImpl) Init() error {
+	baseURL := os.Getenv("JIRA_URL")
+	if len(baseURL) == 0 {
+		return errors.New("JIRA_URL must be set")
+	}
+
+	self.project = os.Getenv("JIRA_PROJECT")
+	if len(self.project) == 0 {
+		return errors.New("JIRA_PROJECT must be set")
+	}
+
+	self.issueType = os.Getenv("JIRA_ISSUE_TYPE")
+	if len(self.issueType) == 0 {
+		self.issueType = "Task"
+	}
+
+	self.closeTransition = os.Getenv("JIRA_CLOSE_TRANSITION")
+	if len(self.closeTransition) == 0 {
+		self.closeTransition = "Done"
+	}
+
+	self.client = NewClient(baseURL, os.Getenv("JIRA_USER"), os.Getenv("JIRA_TOKEN"))
+
+	jobs.Handle(statusJobKind, self.runStatusJob)
+	return nil
+}
+
+func (self *jiraImpl) Deinit() error {
+	return nil
+}
+
+func (self *jiraImpl) Commands() []mux.Command {
+	return []mux.Command{
+		{
+			Name:        "incident",
+			Description: "Open a Jira incident, or show its status, add a note or close it",
+			Role:        rbac.RoleOperator,
+			Handler:     self.handleIncident,
+		},
+	}
+}
+
+func (self *jiraImpl) UpdateKinds() []string {
+	return []string{mux.UpdateMessage}
+}
+
+// HandleUpdate keeps the transcript of the chats, it never stops the mux from
+// handling the messages.
+func (self *jiraImpl) HandleUpdate(ctx *mux.UpdateContext) (bool, error) {
+	if err := self.recordMessage(ctx); err != nil {
+		ctx.Logger.Warnf("Fail recording the transcript of chat %d: %v",
+			ctx.Update.Message.Chat.ID, err)
+	}
+
+	return false, nil
+}
+
+func (self *jiraImpl) handleIncident(ctx *mux.Context) error {
+	if len(ctx.Args) == 0 {
+		return ctx.Reply("Usage: /incident <summary> | status | note <text> | close [comment]")
+	}
+
+	current, err := self.incident(ctx.Message.Chat.ID)
+	if err != nil {
+		return err
+	}
+
+	action := strings.ToLower(ctx.Args[0])
+
+	switch action {
+	case "status", "note", "close":
+		if current == nil {
+			return ctx.Reply("This chat has no open incident, open one with /incident <summary>")
+		}
+
+		ctx.Audit.Target(current.Cluster, current.Namespace, current.Key)
+
+		allowed, err := authorize(ctx, current.Cluster)
+		if !allowed || err != nil {
+			return err
+		}
+	}
+
+	switch action {
+	case "status":
+		return self.showIncident(ctx, current)
+
+	case "note":
+		return self.noteIncident(ctx, current, strings.Join(ctx.Args[1:], " "))
+
+	case "close":
+		return self.closeIncident(ctx, current, strings.Join(ctx.Args[1:], " "))
+	}
+
+	if current != nil {
+		return ctx.Reply(fmt.Sprintf("Incident %s is still open, close it first with /incident close",
+			current.Key))
+	}
+
+	return self.openIncident(ctx, strings.Join(ctx.Args, " "))
+}
+
+func (self *jiraImpl) openIncident(ctx *mux.Context, summary string) error {
+	opened := incident{
+		Summary:  summary,
+		OpenedAt: time.Now(),
+	}
+
+	if ctx.Message.From != nil {
+		opened.OpenedBy = ctx.Message.From.ID
+	}
+
+	description := &strings.Builder{}
+	description.WriteString(fmt.Sprintf("Opened from the Telegram chat %s (%d) by %s.\n\n",
+		chatTitle(ctx), ctx.Message.Chat.ID, nameOf(ctx.Message.From)))
+
+	labels := []string{"telegram-bot"}
+
+	selection, err := selectedCluster(ctx.Message.Chat.ID)
+	if err != nil {
+		ctx.Logger.Warnf("Fail reading the cluster of chat %d: %v", ctx.Message.Chat.ID, err)
+		description.WriteString(fmt.Sprintf("The events can't be read: %v\n", err))
+	} else {
+		// The events of the cluster are copied into Jira
+		allowed, err := authorize(ctx, selection.Cluster)
+		if !allowed || err != nil {
+			return err
+		}
+
+		opened.Cluster = selection.Cluster
+		opened.Namespace = selection.Namespace
+		labels = append(labels, "cluster-"+strings.ReplaceAll(selection.Cluster, " ", "-"))
+
+		description.WriteString(fmt.Sprintf("*Cluster:* %s\n*Namespace:* %s\n\n",
+			selection.Cluster, selection.Namespace))
+
+		events, err := recentEvents(selection)
+		if err != nil {
+			ctx.Logger.Warnf("Fail reading the events of chat %d: %v", ctx.Message.Chat.ID, err)
+			description.WriteString(fmt.Sprintf("The events can't be read: %v\n", err))
+		} else {
+			description.WriteString("h3. Recent events\n{noformat}\n" + events + "{noformat}\n")
+		}
+	}
+
+	ctx.Audit.Target(opened.Cluster, opened.Namespace, "")
+
+	issue, err := self.client.CreateIssue(self.project, self.issueType, summary,
+		description.String(), labels)
+	if err != nil {
+		return err
+	}
+
+	opened.Key = issue.Key
+	ctx.Audit.Target("", "", issue.Key)
+
+	if err = self.store.Set(incidentKey(ctx.Message.Chat.ID), opened, 0); err != nil {
+		return err
+	}
+
+	self.attachTranscript(ctx, issue.Key, "transcript.txt", time.Time{})
+
+	builder := render.NewHTML().
+		Text("Incident ").
+		Link(issue.Key, self.client.BrowseURL(issue.Key)).
+		Text(" is opened: ").
+		Bold(summary).
+		Line("").
+		Line("Status: " + issue.Fields.Status.Name)
+
+	followed, err := self.followIncident(ctx.Message.Chat.ID, issue)
+
+	switch {
+	case err != nil:
+		ctx.Logger.Warnf("Fail following the status of %s: %v", issue.Key, err)
+		builder.Text("Its status changes can't be followed, see /incident status")
+
+	case followed:
+		builder.Text("Its status changes are posted here")
+
+	default:
+		builder.Text("Its status changes aren't followed without REDIS_URL, see /incident status")
+	}
+
+	return ctx.Send(builder)
+}
+
+func (self *jiraImpl) showIncident(ctx *mux.Context, current *incident) error {
+	issue, err := self.client.Issue(current.Key)
+	if err != nil {
+		return err
+	}
+
+	return ctx.Send(render.NewHTML().
+		Text("Incident ").
+		Link(issue.Key, self.client.BrowseURL(issue.Key)).
+		Text(": ").
+		Bold(issue.Fields.Summary).
+		Line("").
+		Line("Status: " + issue.Fields.Status.Name).
+		Line(fmt.Sprintf("Cluster %s, namespace %s, opened %s ago",
+			current.Cluster, current.Namespace,
+			time.Since(current.OpenedAt).Round(time.Minute))))
+}
+
+func (self *jiraImpl) noteIncident(ctx *mux.Context, current *incident, text string) error {
+	if len(text) == 0 {
+		return ctx.Reply("Usage: /incident note <text>")
+	}
+
+	err := self.client.AddComment(current.Key,
+		fmt.Sprintf("%s on Telegram: %s", nameOf(ctx.Message.From), text))
+	if err != nil {
+		return err
+	}
+
+	return ctx.Reply(fmt.Sprintf("The note is added to %s", current.Key))
+}
+
+// closeIncident moves the issue through the close transition, attaching the
+// transcript since the incident was opened.
+func (self *jiraImpl) closeIncident(ctx *mux.Context, current *incident, comment string) error {
+	transitions, err := self.client.Transitions(current.Key)
+	if err != nil {
+		return err
+	}
+
+	var transition *Transition
+	names := make([]string, 0, len(transitions))
+
+	for i := range transitions {
+		names = append(names, transitions[i].Name)
+
+		if strings.EqualFold(transitions[i].Name, self.closeTransition) ||
+			strings.EqualFold(transitions[i].To.Name, self.closeTransition) {
+			transition = &transitions[i]
+		}
+	}
+
+	if transition == nil {
+		return ctx.Reply(fmt.Sprintf("%s can't be moved to %s, its transitions are: %s",
+			current.Key, self.closeTransition, strings.Join(names, ", ")))
+	}
+
+	self.attachTranscript(ctx, current.Key, "transcript-closed.txt", current.OpenedAt)
+
+	text := fmt.Sprintf("Closed from Telegram by %s", nameOf(ctx.Message.From))
+	if len(comment) > 0 {
+		text += ": " + comment
+	}
+
+	if err = self.client.DoTransition(current.Key, transition.ID, text); err != nil {
+		return err
+	}
+
+	if err = self.store.Delete(incidentKey(ctx.Message.Chat.ID)); err != nil {
+		return err
+	}
+
+	return ctx.Send(render.NewHTML().
+		Text("Incident ").
+		Link(current.Key, self.client.BrowseURL(current.Key)).
+		Text(fmt.Sprintf(" is closed after %s", time.Since(current.OpenedAt).Round(time.Minute))))
+}
+
+// attachTranscript uploads the transcript of the chat since a time, failing
+// to attach it doesn't fail the command.
+func (self *jiraImpl) attachTranscript(ctx *mux.Context, key, fileName string, since time.Time) {
+	transcript, err := self.transcript(ctx.Message.Chat.ID, since)
+	if err == nil && len(transcript) > 0 {
+		err = self.client.AddAttachment(key, fileName, []byte(transcript))
+	}
+
+	if err != nil {
+		ctx.Logger.Warnf("Fail attaching the transcript to %s: %v", key, err)
+	}
+}
+
+func (self *jiraImpl) incident(chatId int64) (*incident, error) {
+	current := &incident{}
+
+	found, err := self.store.Get(incidentKey(chatId), current)
+	if !found || err != nil {
+		return nil, err
+	}
+
+	return current, nil
+}
+
+// authorize checks that the author of the command operates cluster, the
+// incidents opened without cluster are left to the role checked by the mux.
+func authorize(ctx *mux.Context, cluster string) (bool, error) {
+	if len(cluster) == 0 {
+		return true, nil
+	}
+
+	if ctx.Message.From == nil {
+		return false, ctx.Reply("Commands sent on behalf of a chat can't be authorized")
+	}
+
+	allowed, err := rbac.Allowed(ctx.Message.From.ID, cluster, rbac.RoleOperator)
+	if err != nil {
+		return false, err
+	}
+
+	if !allowed {
+		ctx.Audit.Result = audit.ResultDenied
+		return false, ctx.Reply(fmt.Sprintf("You need the %s role on cluster %s to run /%s",
+			rbac.RoleOperator, cluster, ctx.Command))
+	}
+
+	return true, nil
+}
+
+func incidentKey(chatId int64) string {
+	return fmt.Sprintf("jira:incident:%d", chatId)
+}
+
+func chatTitle(ctx *mux.Context) string {
+	if len(ctx.Message.Chat.Title) > 0 {
+		return ctx.Message.Chat.Title
+	}
+
+	return nameOf(ctx.Message.From)
+}
@@ -0,0 +1,98 @@
+package jira
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/mux"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/telegram"
+)
+
+const (
+	// transcriptSize is how many messages of a chat are kept.
+	transcriptSize = 100
+	// transcriptTTL forgets the chats which have been quiet for a while.
+	transcriptTTL = 24 * time.Hour
+)
+
+// line is a message of the transcript of a chat.
+type line struct {
+	Time time.Time `json:"time"`
+	From string    `json:"from"`
+	Text string    `json:"text"`
+}
+
+func transcriptKey(chatId int64) string {
+	return fmt.Sprintf("jira:transcript:%d", chatId)
+}
+
+// recordMessage appends the messages the bot receives to the transcript of
+// their chat. In groups the bot only receives the commands and the messages
+// mentioning it, unless its privacy mode is disabled with BotFather.
+func (self *jiraImpl) recordMessage(ctx *mux.UpdateContext) error {
+	message := ctx.Update.Message
+
+	text := message.Text
+	if len(text) == 0 {
+		text = message.Caption
+	}
+
+	if len(text) == 0 && message.Document != nil {
+		text = "[document " + message.Document.FileName + "]"
+	}
+
+	if len(text) == 0 {
+		return nil
+	}
+
+	lines := make([]line, 0)
+	if _, err := self.store.Get(transcriptKey(message.Chat.ID), &lines); err != nil {
+		return err
+	}
+
+	lines = append(lines, line{
+		Time: message.Time(),
+		From: nameOf(message.From),
+		Text: text,
+	})
+
+	if len(lines) > transcriptSize {
+		lines = lines[len(lines)-transcriptSize:]
+	}
+
+	return self.store.Set(transcriptKey(message.Chat.ID), lines, transcriptTTL)
+}
+
+// transcript returns the messages of the chat since a time as text.
+func (self *jiraImpl) transcript(chatId int64, since time.Time) (string, error) {
+	lines := make([]line, 0)
+	if _, err := self.store.Get(transcriptKey(chatId), &lines); err != nil {
+		return "", err
+	}
+
+	var builder strings.Builder
+
+	for _, line := range lines {
+		if line.Time.Before(since) {
+			continue
+		}
+
+		builder.WriteString(fmt.Sprintf("[%s] %s: %s\n",
+			line.Time.UTC().Format(time.RFC3339), line.From, line.Text))
+	}
+
+	return builder.String(), nil
+}
+
+func nameOf(user *telegram.User) string {
+	if user == nil {
+		return "anonymous"
+	}
+
+	if len(user.UserName) > 0 {
+		return "@" + user.UserName
+	}
+
+	return strings.TrimSpace(user.FirstName + " " + user.LastName)
+}
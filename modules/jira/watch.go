@@ -0,0 +1,130 @@
+package jira
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/jobs"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/render"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/telegram"
+)
+
+// The status of an open incident is followed by the worker of `bot watch`,
+// Jira is polled rather than calling a webhook of the bot so that the bot
+// needs no write access to the Jira configuration.
+const (
+	statusJobKind = "jira:status"
+
+	// statusPollInterval spaces the reads of the status of an incident.
+	statusPollInterval = time.Minute
+)
+
+// statusJob posts the status changes of the incident key to the chat, until
+// the incident is closed.
+type statusJob struct {
+	ChatID int64  `json:"chat_id"`
+	Key    string `json:"key"`
+	// Status is the status of the issue when it was opened.
+	Status string `json:"status"`
+}
+
+// followIncident hands the incident over to the worker, the status changes
+// aren't posted when the store isn't shared with it.
+func (self *jiraImpl) followIncident(chatId int64, issue *Issue) (bool, error) {
+	_, err := jobs.Enqueue(self.store, statusJobKind, statusJob{
+		ChatID: chatId,
+		Key:    issue.Key,
+		Status: issue.Fields.Status.Name,
+	})
+	if errors.Is(err, jobs.ErrNotShared) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+func (self *jiraImpl) runStatusJob(ctx context.Context, bot telegram.Telegram, job jobs.Job) error {
+	request := statusJob{}
+	if err := job.Decode(&request); err != nil {
+		return err
+	}
+
+	// An interrupted job resumes from the last status it posted
+	last := request.Status
+	if _, err := self.store.Get(statusKey(request.Key), &last); err != nil {
+		return err
+	}
+
+	defer func() {
+		// An interrupted job resumes on the next worker from the saved status
+		if ctx.Err() == nil {
+			self.store.Delete(statusKey(request.Key))
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+
+		case <-time.After(statusPollInterval):
+		}
+
+		current, err := self.incident(request.ChatID)
+		if err != nil {
+			return err
+		}
+
+		if current == nil || current.Key != request.Key {
+			return nil
+		}
+
+		issue, err := self.client.Issue(request.Key)
+		if err != nil || issue.Fields.Status.Name == last {
+			// Jira being unreachable for a while doesn't stop the job
+			continue
+		}
+
+		last = issue.Fields.Status.Name
+		if err = self.store.Set(statusKey(request.Key), last, 0); err != nil {
+			return err
+		}
+
+		builder := render.NewHTML().
+			Text("Incident ").
+			Link(issue.Key, self.client.BrowseURL(issue.Key)).
+			Text(" moved to ").
+			Bold(last)
+
+		// An incident closed in Jira itself frees the chat for the next one
+		closed := self.closed(issue)
+		if closed {
+			builder.Text(", it's closed")
+
+			if err = self.store.Delete(incidentKey(request.ChatID)); err != nil {
+				return err
+			}
+		}
+
+		if _, err = bot.SendMessage(builder.Config(request.ChatID)); err != nil {
+			return err
+		}
+
+		if closed {
+			return nil
+		}
+	}
+}
+
+// closed tells if issue reached the end of its workflow.
+func (self *jiraImpl) closed(issue *Issue) bool {
+	return issue.Fields.Status.StatusCategory.Key == "done" ||
+		strings.EqualFold(issue.Fields.Status.Name, self.closeTransition)
+}
+
+func statusKey(key string) string {
+	return fmt.Sprintf("jira:status:%s", key)
+}
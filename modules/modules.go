@@ -0,0 +1,101 @@
+package modules
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/audit"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/container"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/jobs"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/mux"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/rbac"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/state"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/modules/alert"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/modules/alertmanager"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/modules/cluster"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/modules/jira"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/modules/storage"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/modules/terraform"
+)
+
+// Register setups every module the bot is shipped with, the registration
+// order is the order of their commands in the command menu.
+func Register() error {
+	store := state.NewStore()
+
+	err := container.Register("state", store)
+	if err != nil {
+		return fmt.Errorf("Can't register module `state`: %v", err)
+	}
+
+	policy := rbac.NewEnvPolicy()
+	log := audit.NewLog()
+	chats := mux.NewStoreChats(store)
+
+	// The database keeps the users, the roles, the chats, the clusters, the
+	// jobs and the audit log when it's configured
+	if dsn := os.Getenv("STORAGE_DSN"); len(dsn) > 0 {
+		database := storage.NewStorage(dsn)
+
+		err = container.Register(storage.ModuleName, database)
+		if err != nil {
+			return fmt.Errorf("Can't register module `storage`: %v", err)
+		}
+
+		policy = storage.NewPolicy(database, policy)
+		chats = storage.NewChats(database)
+		jobs.UseJournal(storage.NewJournal(database))
+
+		if len(os.Getenv("AUDIT_DSN")) == 0 {
+			log = audit.NewSQLLogWithDB(database.DB())
+		}
+	}
+
+	err = container.Register("rbac", policy)
+	if err != nil {
+		return fmt.Errorf("Can't register module `rbac`: %v", err)
+	}
+
+	err = container.Register(audit.ModuleName, log)
+	if err != nil {
+		return fmt.Errorf("Can't register module `audit`: %v", err)
+	}
+
+	err = container.Register(mux.ChatsModuleName, chats)
+	if err != nil {
+		return fmt.Errorf("Can't register module `%s`: %v", mux.ChatsModuleName, err)
+	}
+
+	err = container.Register(cluster.ModuleName, cluster.NewModule(store))
+	if err != nil {
+		return fmt.Errorf("Can't register module `cluster`: %v", err)
+	}
+
+	err = container.Register(alert.ModuleName, alert.NewModule(store))
+	if err != nil {
+		return fmt.Errorf("Can't register module `alert`: %v", err)
+	}
+
+	if len(os.Getenv("ALERTMANAGER_ROUTES")) > 0 {
+		err = container.Register(alertmanager.ModuleName, alertmanager.NewModule(store))
+		if err != nil {
+			return fmt.Errorf("Can't register module `alertmanager`: %v", err)
+		}
+	}
+
+	if len(os.Getenv("JIRA_URL")) > 0 {
+		err = container.Register(jira.ModuleName, jira.NewModule(store))
+		if err != nil {
+			return fmt.Errorf("Can't register module `jira`: %v", err)
+		}
+	}
+
+	if len(os.Getenv("TERRAFORM_DIR")) > 0 {
+		err = container.Register(terraform.ModuleName, terraform.NewModule(store))
+		if err != nil {
+			return fmt.Errorf("Can't register module `terraform`: %v", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/mux"
+)
+
+type chatsImpl struct {
+	storage Storage
+}
+
+// NewChats keeps the chats registered by the mux in the table chats.
+func NewChats(storage Storage) mux.Chats {
+	return &chatsImpl{storage: storage}
+}
+
+func (self *chatsImpl) Init() error {
+	return nil
+}
+
+func (self *chatsImpl) Deinit() error {
+	return nil
+}
+
+func (self *chatsImpl) Register(chat mux.RegisteredChat) error {
+	return self.storage.SaveChat(Chat{
+		ID:      chat.ID,
+		Type:    chat.Type,
+		Title:   chat.Title,
+		AddedBy: chat.AddedBy,
+		AddedAt: chat.AddedAt,
+	})
+}
+
+func (self *chatsImpl) Unregister(chatId int64) error {
+	return self.storage.DeleteChat(chatId)
+}
+
+func (self *chatsImpl) All() (map[int64]mux.RegisteredChat, error) {
+	chats, err := self.storage.Chats()
+	if err != nil {
+		return nil, err
+	}
+
+	registered := make(map[int64]mux.RegisteredChat, len(chats))
+
+	for _, chat := range chats {
+		registered[chat.ID] = mux.RegisteredChat{
+			ID:      chat.ID,
+			Type:    chat.Type,
+			Title:   chat.Title,
+			AddedBy: chat.AddedBy,
+			AddedAt: chat.AddedAt,
+		}
+	}
+
+	return registered, nil
+}
@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"time"
+
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/jobs"
+)
+
+type journalImpl struct {
+	storage Storage
+}
+
+// NewJournal records the jobs of the worker in the table jobs.
+func NewJournal(storage Storage) jobs.Journal {
+	return &journalImpl{storage: storage}
+}
+
+func (self *journalImpl) Enqueued(job jobs.Job) error {
+	return self.save(job, JobPending)
+}
+
+func (self *journalImpl) Started(job jobs.Job) error {
+	return self.save(job, JobRunning)
+}
+
+func (self *journalImpl) Finished(job jobs.Job, err error) error {
+	if err != nil {
+		return self.save(job, JobFailed)
+	}
+
+	return self.save(job, JobDone)
+}
+
+func (self *journalImpl) Unfinished() ([]jobs.Job, error) {
+	unfinished := make([]jobs.Job, 0)
+
+	for _, status := range []string{JobPending, JobRunning} {
+		due, err := self.storage.DueJobs(status, time.Now())
+		if err != nil {
+			return nil, err
+		}
+
+		for _, job := range due {
+			unfinished = append(unfinished, jobs.Job{
+				ID:         job.ID,
+				Kind:       job.Kind,
+				Payload:    []byte(job.Payload),
+				EnqueuedAt: job.RunAt,
+			})
+		}
+	}
+
+	return unfinished, nil
+}
+
+func (self *journalImpl) save(job jobs.Job, status string) error {
+	return self.storage.SaveJob(Job{
+		ID:      job.ID,
+		Kind:    job.Kind,
+		Payload: string(job.Payload),
+		RunAt:   job.EnqueuedAt,
+		Status:  status,
+	})
+}
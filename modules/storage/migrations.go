@@ -0,0 +1,234 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+const (
+	// migrationLock is the named lock of MySQL taken while migrating, so
+	// that the instances starting together migrate one after the other.
+	migrationLock = "telegram-bot:schema_migrations"
+	// migrationLockTimeout is how long an instance waits for the others to
+	// migrate, in seconds.
+	migrationLockTimeout = 60
+)
+
+// migration changes the schema from the previous version to version.
+type migration struct {
+	version    int
+	name       string
+	statements func(dialect dialect) []string
+}
+
+// migrations are applied in order and never edited once released, a change
+// of the schema is a new migration.
+var migrations = []migration{
+	{
+		version: 1,
+		name:    "create users",
+		statements: func(dialect dialect) []string {
+			return []string{`CREATE TABLE IF NOT EXISTS users (
+				id BIGINT NOT NULL PRIMARY KEY,
+				username VARCHAR(64) NOT NULL,
+				first_name VARCHAR(255) NOT NULL,
+				language_code VARCHAR(16) NOT NULL,
+				updated_at BIGINT NOT NULL
+			)`}
+		},
+	},
+	{
+		version: 2,
+		name:    "create roles",
+		statements: func(dialect dialect) []string {
+			return []string{`CREATE TABLE IF NOT EXISTS roles (
+				user_id BIGINT NOT NULL,
+				cluster VARCHAR(255) NOT NULL,
+				role VARCHAR(16) NOT NULL,
+				PRIMARY KEY (user_id, cluster)
+			)`}
+		},
+	},
+	{
+		version: 3,
+		name:    "create chats",
+		statements: func(dialect dialect) []string {
+			return []string{`CREATE TABLE IF NOT EXISTS chats (
+				id BIGINT NOT NULL PRIMARY KEY,
+				type VARCHAR(16) NOT NULL,
+				title VARCHAR(255) NOT NULL,
+				added_by BIGINT NOT NULL,
+				added_at BIGINT NOT NULL
+			)`}
+		},
+	},
+	{
+		version: 4,
+		name:    "create clusters",
+		statements: func(dialect dialect) []string {
+			return []string{`CREATE TABLE IF NOT EXISTS clusters (
+				name VARCHAR(255) NOT NULL PRIMARY KEY,
+				server VARCHAR(1024) NOT NULL,
+				namespace VARCHAR(255) NOT NULL,
+				updated_at BIGINT NOT NULL
+			)`}
+		},
+	},
+	{
+		version: 5,
+		name:    "create audit entries",
+		statements: func(dialect dialect) []string {
+			// Same columns as audit.NewSQLLog, so both can share a database
+			return []string{`CREATE TABLE IF NOT EXISTS audit_entries (
+				id ` + dialect.serial() + `,
+				created_at BIGINT NOT NULL,
+				user_id BIGINT NOT NULL,
+				username VARCHAR(64) NOT NULL,
+				chat_id BIGINT NOT NULL,
+				command VARCHAR(64) NOT NULL,
+				args TEXT NOT NULL,
+				cluster VARCHAR(255) NOT NULL,
+				namespace VARCHAR(255) NOT NULL,
+				resource VARCHAR(255) NOT NULL,
+				confirmation VARCHAR(16) NOT NULL,
+				result VARCHAR(16) NOT NULL,
+				error TEXT NOT NULL,
+				duration_ms BIGINT NOT NULL
+			)`}
+		},
+	},
+	{
+		version: 6,
+		name:    "create jobs",
+		statements: func(dialect dialect) []string {
+			return []string{
+				`CREATE TABLE IF NOT EXISTS jobs (
+					id VARCHAR(64) NOT NULL PRIMARY KEY,
+					kind VARCHAR(64) NOT NULL,
+					chat_id BIGINT NOT NULL,
+					payload TEXT NOT NULL,
+					run_at BIGINT NOT NULL,
+					status VARCHAR(16) NOT NULL,
+					updated_at BIGINT NOT NULL
+				)`,
+				`CREATE INDEX jobs_status_run_at ON jobs (status, run_at)`,
+			}
+		},
+	},
+}
+
+// migrate applies the migrations newer than the version of the database,
+// each migration runs in its own transaction. MySQL commits the schema
+// changes implicitly, so a migration failing there may be partially applied
+// and need to be fixed by hand.
+func migrate(db *sql.DB, dialect dialect) error {
+	unlock, err := lockSchema(db, dialect)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version BIGINT NOT NULL PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		applied_at BIGINT NOT NULL
+	)`)
+	if err != nil {
+		return err
+	}
+
+	current, err := schemaVersion(db)
+	if err != nil {
+		return err
+	}
+
+	for _, step := range migrations {
+		if step.version <= current {
+			continue
+		}
+
+		if err = apply(db, dialect, step); err != nil {
+			// A server ignoring the lock lets another instance apply it first
+			if version, versionErr := schemaVersion(db); versionErr == nil && version >= step.version {
+				continue
+			}
+
+			return fmt.Errorf("Migration %d (%s) fails: %v", step.version, step.name, err)
+		}
+	}
+
+	return nil
+}
+
+// lockSchema waits for the other instances to finish migrating the database
+// and returns the function releasing the lock. SQLite locks the whole
+// database by itself.
+func lockSchema(db *sql.DB, dialect dialect) (func(), error) {
+	if dialect != dialectMySQL {
+		return func() {}, nil
+	}
+
+	// The named locks of MySQL belong to a connection of the pool
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	var locked sql.NullInt64
+
+	err = conn.QueryRowContext(context.Background(), `SELECT GET_LOCK(?, ?)`,
+		migrationLock, migrationLockTimeout).Scan(&locked)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if locked.Int64 != 1 {
+		conn.Close()
+		return nil, fmt.Errorf("Can't lock the schema within %ds, another instance is migrating it",
+			migrationLockTimeout)
+	}
+
+	return func() {
+		conn.ExecContext(context.Background(), `SELECT RELEASE_LOCK(?)`, migrationLock)
+		conn.Close()
+	}, nil
+}
+
+func apply(db *sql.DB, dialect dialect, step migration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	for _, statement := range step.statements(dialect) {
+		if _, err = tx.Exec(statement); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	_, err = tx.Exec(
+		`INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`,
+		step.version, step.name, time.Now().UnixMilli(),
+	)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func schemaVersion(db *sql.DB) (int, error) {
+	var version sql.NullInt64
+
+	err := db.QueryRow(`SELECT MAX(version) FROM schema_migrations`).Scan(&version)
+	if err != nil {
+		return 0, err
+	}
+
+	return int(version.Int64), nil
+}
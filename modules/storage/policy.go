@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/rbac"
+)
+
+type policyImpl struct {
+	storage  Storage
+	fallback rbac.Policy
+}
+
+// NewPolicy reads the roles of the users from the table roles, the users
+// without row there get their role from fallback.
+func NewPolicy(storage Storage, fallback rbac.Policy) rbac.Policy {
+	return &policyImpl{
+		storage:  storage,
+		fallback: fallback,
+	}
+}
+
+func (self *policyImpl) Init() error {
+	return self.fallback.Init()
+}
+
+func (self *policyImpl) Deinit() error {
+	return self.fallback.Deinit()
+}
+
+func (self *policyImpl) RoleOf(userId int64, cluster string) (rbac.Role, error) {
+	bindings, err := self.storage.RoleBindings(userId)
+	if err != nil {
+		return rbac.RoleNone, err
+	}
+
+	if len(bindings) == 0 {
+		return self.fallback.RoleOf(userId, cluster)
+	}
+
+	role := rbac.RoleNone
+
+	for _, binding := range bindings {
+		if rbac.Matches(binding.Cluster, cluster) {
+			if binding.Role > role {
+				role = binding.Role
+			}
+		}
+	}
+
+	return role, nil
+}
+
+func (self *policyImpl) ClustersOf(userId int64, role rbac.Role) ([]string, error) {
+	bindings, err := self.storage.RoleBindings(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(bindings) == 0 {
+		return self.fallback.ClustersOf(userId, role)
+	}
+
+	clusters := make([]string, 0)
+
+	for _, binding := range bindings {
+		if len(binding.Cluster) > 0 && binding.Role >= role {
+			clusters = append(clusters, binding.Cluster)
+		}
+	}
+
+	return clusters, nil
+}
@@ -0,0 +1,285 @@
+package storage
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/rbac"
+)
+
+// User is a Telegram user who talked to the bot.
+type User struct {
+	ID           int64
+	Username     string
+	FirstName    string
+	LanguageCode string
+	UpdatedAt    time.Time
+}
+
+// RoleBinding grants a role to a user on a cluster, or on every cluster
+// when Cluster is empty.
+type RoleBinding struct {
+	UserID  int64
+	Cluster string
+	Role    rbac.Role
+}
+
+// Chat is a group or a channel the bot has been added to.
+type Chat struct {
+	ID      int64
+	Type    string
+	Title   string
+	AddedBy int64
+	AddedAt time.Time
+}
+
+// Cluster is a cluster known by the bot.
+type Cluster struct {
+	Name      string
+	Server    string
+	Namespace string
+	UpdatedAt time.Time
+}
+
+// Job statuses.
+const (
+	JobPending = "pending"
+	JobRunning = "running"
+	JobDone    = "done"
+	JobFailed  = "failed"
+)
+
+// Job is a scheduled or long running task which must survive restarts, its
+// Payload is owned by the module handling Kind.
+type Job struct {
+	ID        string
+	Kind      string
+	ChatID    int64
+	Payload   string
+	RunAt     time.Time
+	Status    string
+	UpdatedAt time.Time
+}
+
+// SaveUser upserts user, like the other Save methods it uses REPLACE INTO
+// which both MySQL and SQLite support.
+func (self *storageImpl) SaveUser(user User) error {
+	_, err := self.db.Exec(
+		`REPLACE INTO users (id, username, first_name, language_code, updated_at)
+		VALUES (?, ?, ?, ?, ?)`,
+		user.ID, user.Username, user.FirstName, user.LanguageCode,
+		time.Now().UnixMilli(),
+	)
+	return err
+}
+
+func (self *storageImpl) User(id int64) (*User, error) {
+	var updatedAt int64
+
+	user := &User{}
+
+	err := self.db.QueryRow(
+		`SELECT id, username, first_name, language_code, updated_at
+		FROM users WHERE id = ?`,
+		id,
+	).Scan(&user.ID, &user.Username, &user.FirstName, &user.LanguageCode, &updatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	user.UpdatedAt = time.UnixMilli(updatedAt)
+	return user, nil
+}
+
+func (self *storageImpl) SetRole(userId int64, cluster string, role rbac.Role) error {
+	_, err := self.db.Exec(
+		`REPLACE INTO roles (user_id, cluster, role) VALUES (?, ?, ?)`,
+		userId, cluster, role.String(),
+	)
+	return err
+}
+
+func (self *storageImpl) DeleteRole(userId int64, cluster string) error {
+	_, err := self.db.Exec(
+		`DELETE FROM roles WHERE user_id = ? AND cluster = ?`,
+		userId, cluster,
+	)
+	return err
+}
+
+func (self *storageImpl) RoleBindings(userId int64) ([]RoleBinding, error) {
+	rows, err := self.db.Query(
+		`SELECT cluster, role FROM roles WHERE user_id = ? ORDER BY cluster`,
+		userId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	bindings := make([]RoleBinding, 0)
+
+	for rows.Next() {
+		var name string
+
+		binding := RoleBinding{UserID: userId}
+
+		if err = rows.Scan(&binding.Cluster, &name); err != nil {
+			return nil, err
+		}
+
+		if binding.Role, err = rbac.ParseRole(name); err != nil {
+			return nil, err
+		}
+
+		bindings = append(bindings, binding)
+	}
+
+	return bindings, rows.Err()
+}
+
+func (self *storageImpl) SaveChat(chat Chat) error {
+	_, err := self.db.Exec(
+		`REPLACE INTO chats (id, type, title, added_by, added_at)
+		VALUES (?, ?, ?, ?, ?)`,
+		chat.ID, chat.Type, chat.Title, chat.AddedBy, chat.AddedAt.UnixMilli(),
+	)
+	return err
+}
+
+func (self *storageImpl) DeleteChat(id int64) error {
+	_, err := self.db.Exec(`DELETE FROM chats WHERE id = ?`, id)
+	return err
+}
+
+func (self *storageImpl) Chats() ([]Chat, error) {
+	rows, err := self.db.Query(
+		`SELECT id, type, title, added_by, added_at FROM chats ORDER BY id`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	chats := make([]Chat, 0)
+
+	for rows.Next() {
+		var addedAt int64
+
+		chat := Chat{}
+
+		err = rows.Scan(&chat.ID, &chat.Type, &chat.Title, &chat.AddedBy, &addedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		chat.AddedAt = time.UnixMilli(addedAt)
+		chats = append(chats, chat)
+	}
+
+	return chats, rows.Err()
+}
+
+func (self *storageImpl) SaveCluster(cluster Cluster) error {
+	_, err := self.db.Exec(
+		`REPLACE INTO clusters (name, server, namespace, updated_at)
+		VALUES (?, ?, ?, ?)`,
+		cluster.Name, cluster.Server, cluster.Namespace, time.Now().UnixMilli(),
+	)
+	return err
+}
+
+func (self *storageImpl) Clusters() ([]Cluster, error) {
+	rows, err := self.db.Query(
+		`SELECT name, server, namespace, updated_at FROM clusters ORDER BY name`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	clusters := make([]Cluster, 0)
+
+	for rows.Next() {
+		var updatedAt int64
+
+		cluster := Cluster{}
+
+		err = rows.Scan(&cluster.Name, &cluster.Server, &cluster.Namespace, &updatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		cluster.UpdatedAt = time.UnixMilli(updatedAt)
+		clusters = append(clusters, cluster)
+	}
+
+	return clusters, rows.Err()
+}
+
+func (self *storageImpl) SaveJob(job Job) error {
+	_, err := self.db.Exec(
+		`REPLACE INTO jobs (id, kind, chat_id, payload, run_at, status, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		job.ID, job.Kind, job.ChatID, job.Payload, job.RunAt.UnixMilli(),
+		job.Status, time.Now().UnixMilli(),
+	)
+	return err
+}
+
+func (self *storageImpl) Job(id string) (*Job, error) {
+	rows, err := self.db.Query(
+		`SELECT id, kind, chat_id, payload, run_at, status, updated_at
+		FROM jobs WHERE id = ?`,
+		id,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	jobs, err := scanJobs(rows)
+	if err != nil || len(jobs) == 0 {
+		return nil, err
+	}
+
+	return &jobs[0], nil
+}
+
+func (self *storageImpl) DueJobs(status string, before time.Time) ([]Job, error) {
+	rows, err := self.db.Query(
+		`SELECT id, kind, chat_id, payload, run_at, status, updated_at
+		FROM jobs WHERE status = ? AND run_at <= ? ORDER BY run_at`,
+		status, before.UnixMilli(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanJobs(rows)
+}
+
+func scanJobs(rows *sql.Rows) ([]Job, error) {
+	defer rows.Close()
+
+	jobs := make([]Job, 0)
+
+	for rows.Next() {
+		var runAt, updatedAt int64
+
+		job := Job{}
+
+		err := rows.Scan(&job.ID, &job.Kind, &job.ChatID, &job.Payload,
+			&runAt, &job.Status, &updatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		job.RunAt = time.UnixMilli(runAt)
+		job.UpdatedAt = time.UnixMilli(updatedAt)
+		jobs = append(jobs, job)
+	}
+
+	return jobs, rows.Err()
+}
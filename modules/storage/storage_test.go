@@ -0,0 +1,316 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/jobs"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/mux"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/rbac"
+)
+
+// newTestStorage migrates a SQLite database in memory, standing in for TiDB.
+func newTestStorage(t *testing.T) (Storage, *sql.DB) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every connection of the pool would open its own database in memory
+	db.SetMaxOpenConns(1)
+
+	storage := NewStorageWithDB("sqlite3", db)
+	if err = storage.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { storage.Deinit() })
+	return storage, db
+}
+
+func TestMigrate(t *testing.T) {
+	storage, db := newTestStorage(t)
+
+	version, err := storage.Version()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	latest := migrations[len(migrations)-1].version
+	if version != latest {
+		t.Errorf("Schema is at version %d instead of %d", version, latest)
+	}
+
+	// A second instance starting on the migrated database does nothing
+	if err = migrate(db, dialectSQLite); err != nil {
+		t.Fatalf("Migrating again fails: %v", err)
+	}
+
+	var count int
+	if err = db.QueryRow(`SELECT COUNT(*) FROM schema_migrations`).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+
+	if count != len(migrations) {
+		t.Errorf("%d migrations are recorded instead of %d", count, len(migrations))
+	}
+}
+
+func TestMigrateFailing(t *testing.T) {
+	_, db := newTestStorage(t)
+	last := migrations[len(migrations)-1]
+
+	// The index of the last migration exists while it isn't recorded, its
+	// statements fail and nobody else recorded it
+	_, err := db.Exec(`DELETE FROM schema_migrations WHERE version = ?`, last.version)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = migrate(db, dialectSQLite); err == nil {
+		t.Fatal("A failing migration which isn't recorded is ignored")
+	}
+
+	version, err := schemaVersion(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if version != last.version-1 {
+		t.Errorf("Schema is at version %d after a failing migration %d", version, last.version)
+	}
+}
+
+func TestUsers(t *testing.T) {
+	storage, _ := newTestStorage(t)
+
+	missing, err := storage.User(1)
+	if err != nil || missing != nil {
+		t.Fatalf("Missing user is %+v, %v", missing, err)
+	}
+
+	for _, name := range []string{"alice", "alice_ops"} {
+		err = storage.SaveUser(User{ID: 1, Username: name, FirstName: "Alice", LanguageCode: "en"})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	user, err := storage.User(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if user == nil || user.Username != "alice_ops" || user.FirstName != "Alice" {
+		t.Errorf("User is %+v after being saved twice", user)
+	}
+}
+
+func TestRoles(t *testing.T) {
+	storage, _ := newTestStorage(t)
+
+	steps := []struct {
+		cluster string
+		role    rbac.Role
+	}{
+		{"", rbac.RoleViewer},
+		{"staging", rbac.RoleOperator},
+		{"staging", rbac.RoleAdmin},
+	}
+
+	for _, step := range steps {
+		if err := storage.SetRole(1, step.cluster, step.role); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	bindings, err := storage.RoleBindings(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(bindings) != 2 || bindings[0].Role != rbac.RoleViewer ||
+		bindings[1].Cluster != "staging" || bindings[1].Role != rbac.RoleAdmin {
+		t.Fatalf("Bindings are %+v", bindings)
+	}
+
+	if err = storage.DeleteRole(1, "staging"); err != nil {
+		t.Fatal(err)
+	}
+
+	bindings, err = storage.RoleBindings(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(bindings) != 1 || len(bindings[0].Cluster) != 0 {
+		t.Errorf("Bindings are %+v after deleting staging", bindings)
+	}
+}
+
+func TestChats(t *testing.T) {
+	storage, _ := newTestStorage(t)
+	addedAt := time.UnixMilli(time.Now().UnixMilli())
+
+	for _, chat := range []Chat{
+		{ID: -2, Type: "group", Title: "ops", AddedBy: 1, AddedAt: addedAt},
+		{ID: -1, Type: "supergroup", Title: "dev", AddedBy: 1, AddedAt: addedAt},
+		{ID: -2, Type: "group", Title: "ops team", AddedBy: 1, AddedAt: addedAt},
+	} {
+		if err := storage.SaveChat(chat); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := storage.DeleteChat(-1); err != nil {
+		t.Fatal(err)
+	}
+
+	chats, err := storage.Chats()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(chats) != 1 || chats[0].Title != "ops team" || !chats[0].AddedAt.Equal(addedAt) {
+		t.Errorf("Chats are %+v", chats)
+	}
+}
+
+func TestClusters(t *testing.T) {
+	storage, _ := newTestStorage(t)
+
+	for _, cluster := range []Cluster{
+		{Name: "staging", Server: "https://staging:6443", Namespace: "default"},
+		{Name: "production", Server: "https://production:6443", Namespace: "api"},
+		{Name: "staging", Server: "https://staging:6443", Namespace: "web"},
+	} {
+		if err := storage.SaveCluster(cluster); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	clusters, err := storage.Clusters()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(clusters) != 2 || clusters[0].Name != "production" || clusters[1].Namespace != "web" {
+		t.Errorf("Clusters are %+v", clusters)
+	}
+}
+
+func TestJobs(t *testing.T) {
+	storage, _ := newTestStorage(t)
+	now := time.UnixMilli(time.Now().UnixMilli())
+
+	for _, job := range []Job{
+		{ID: "later", Kind: "report", RunAt: now.Add(time.Hour), Status: JobPending},
+		{ID: "second", Kind: "report", RunAt: now.Add(-time.Minute), Status: JobPending},
+		{ID: "first", Kind: "report", RunAt: now.Add(-time.Hour), Status: JobPending},
+		{ID: "done", Kind: "report", RunAt: now.Add(-time.Hour), Status: JobDone},
+	} {
+		if err := storage.SaveJob(job); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	due, err := storage.DueJobs(JobPending, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(due) != 2 || due[0].ID != "first" || due[1].ID != "second" {
+		t.Fatalf("Due jobs are %+v", due)
+	}
+
+	due[0].Status = JobRunning
+	if err = storage.SaveJob(due[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	job, err := storage.Job("first")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if job == nil || job.Status != JobRunning || !job.RunAt.Equal(now.Add(-time.Hour)) {
+		t.Errorf("Job is %+v after being started", job)
+	}
+
+	if missing, err := storage.Job("missing"); missing != nil || err != nil {
+		t.Errorf("Missing job is %+v, %v", missing, err)
+	}
+}
+
+func TestRegisteredChats(t *testing.T) {
+	storage, _ := newTestStorage(t)
+	chats := NewChats(storage)
+
+	for _, chat := range []mux.RegisteredChat{
+		{ID: -2, Type: "group", Title: "ops", AddedBy: 1, AddedAt: time.Now()},
+		{ID: -1, Type: "channel", Title: "releases", AddedBy: 1, AddedAt: time.Now()},
+	} {
+		if err := chats.Register(chat); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := chats.Unregister(-1); err != nil {
+		t.Fatal(err)
+	}
+
+	registered, err := chats.All()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(registered) != 1 || registered[-2].Title != "ops" {
+		t.Errorf("Registered chats are %+v", registered)
+	}
+}
+
+func TestJournal(t *testing.T) {
+	storage, _ := newTestStorage(t)
+	journal := NewJournal(storage)
+	enqueuedAt := time.UnixMilli(time.Now().Add(-time.Minute).UnixMilli())
+
+	for _, id := range []string{"pending", "running", "done", "failed"} {
+		job := jobs.Job{ID: id, Kind: "rollout", Payload: []byte(`{"name":"api"}`), EnqueuedAt: enqueuedAt}
+
+		if err := journal.Enqueued(job); err != nil {
+			t.Fatal(err)
+		}
+
+		switch id {
+		case "running":
+			journal.Started(job)
+
+		case "done":
+			journal.Finished(job, nil)
+
+		case "failed":
+			journal.Finished(job, errors.New("Cluster is gone"))
+		}
+	}
+
+	unfinished, err := journal.Unfinished()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(unfinished) != 2 || unfinished[0].ID != "pending" || unfinished[1].ID != "running" {
+		t.Fatalf("Unfinished jobs are %+v", unfinished)
+	}
+
+	if string(unfinished[0].Payload) != `{"name":"api"}` || !unfinished[0].EnqueuedAt.Equal(enqueuedAt) {
+		t.Errorf("Job is restored as %+v", unfinished[0])
+	}
+
+	if failed, err := storage.Job("failed"); err != nil || failed == nil || failed.Status != JobFailed {
+		t.Errorf("Failed job is %+v, %v", failed, err)
+	}
+}
@@ -0,0 +1,44 @@
+package storage
+
+import (
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/mux"
+)
+
+func (self *storageImpl) UpdateKinds() []string {
+	return []string{mux.UpdateMessage, mux.UpdateCallbackQuery, mux.UpdateInlineQuery}
+}
+
+// HandleUpdate saves the user sending the update when they changed since
+// this instance last saw them, it never stops the mux.
+func (self *storageImpl) HandleUpdate(ctx *mux.UpdateContext) (bool, error) {
+	from := ctx.Update.SentFrom()
+	if from == nil || from.IsBot {
+		return false, nil
+	}
+
+	user := User{
+		ID:           from.ID,
+		Username:     from.UserName,
+		FirstName:    from.FirstName,
+		LanguageCode: from.LanguageCode,
+	}
+
+	self.mutex.Lock()
+	seen, ok := self.users[user.ID]
+	self.mutex.Unlock()
+
+	if ok && seen == user {
+		return false, nil
+	}
+
+	if err := self.SaveUser(user); err != nil {
+		ctx.Logger.Warnf("Fail saving user %d: %v", user.ID, err)
+		return false, nil
+	}
+
+	self.mutex.Lock()
+	self.users[user.ID] = user
+	self.mutex.Unlock()
+
+	return false, nil
+}
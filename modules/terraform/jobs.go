@@ -0,0 +1,284 @@
+package terraform
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/jobs"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/mux"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/render"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/telegram"
+)
+
+// The plans and the applies run in the worker of `bot watch`, a run takes
+// far longer than a request of the webhook. The plan files are kept in the
+// store, so the apply runs on any worker.
+const (
+	planJobKind  = "terraform:plan"
+	applyJobKind = "terraform:apply"
+
+	// runningPollInterval spaces the attempts to run while another run
+	// holds the lock.
+	runningPollInterval = 5 * time.Second
+)
+
+// planJob plans a node pool size in the status message of /nodepool.
+type planJob struct {
+	ID          string `json:"id"`
+	ChatID      int64  `json:"chat_id"`
+	MessageID   int    `json:"message_id"`
+	Pool        string `json:"pool"`
+	Size        int    `json:"size"`
+	RequestedBy int64  `json:"requested_by"`
+}
+
+// applyJob applies an approved plan in the message of its review.
+type applyJob struct {
+	ID        string      `json:"id"`
+	ChatID    int64       `json:"chat_id"`
+	MessageID int         `json:"message_id"`
+	Plan      pendingPlan `json:"plan"`
+	Approvers []string    `json:"approvers"`
+}
+
+func (self *terraformImpl) runPlanJob(ctx context.Context, bot telegram.Telegram, job jobs.Job) error {
+	request := planJob{}
+	if err := job.Decode(&request); err != nil {
+		return err
+	}
+
+	title := fmt.Sprintf("Planning node pool %s with %d nodes", request.Pool, request.Size)
+	status := mux.NewStatus(bot, request.ChatID, request.MessageID)
+
+	if err := self.acquire(ctx, status, title, job.ID); err != nil {
+		return err
+	}
+	defer self.store.Unlock(runningKey, job.ID)
+
+	if err := self.cleanPlans(); err != nil {
+		return self.fail(status, title, "", err)
+	}
+
+	planFile := filepath.Join(planDirName, request.ID+".tfplan")
+	output, err := self.stream(ctx, status, title,
+		"plan", "-no-color", "-input=false",
+		"-out="+planFile,
+		fmt.Sprintf("-var=%s=%d", self.pools[request.Pool], request.Size))
+	if ctx.Err() != nil {
+		return ctx.Err()
+	} else if err != nil {
+		return self.fail(status, title, output, err)
+	}
+
+	summary := strings.Join(summarize(output), "\n")
+
+	if strings.Contains(output, "No changes.") {
+		os.Remove(filepath.Join(self.directory, planFile))
+		return status.Finish(render.NewHTML().
+			Bold(fmt.Sprintf("Node pool %s already has %d nodes", request.Pool, request.Size)).
+			Line("").
+			Pre(summary, ""), nil)
+	}
+
+	if err = self.savePlanFile(request.ID, planFile); err != nil {
+		return self.fail(status, title, output, err)
+	}
+
+	plan := pendingPlan{
+		ChatID:      request.ChatID,
+		Cluster:     self.cluster,
+		Pool:        request.Pool,
+		Size:        request.Size,
+		RequestedBy: request.RequestedBy,
+		PlanFile:    planFile,
+		Summary:     summary,
+	}
+
+	if err = self.store.Set(planKey(request.ID), plan, planTTL); err != nil {
+		return err
+	}
+
+	keyboard, err := self.keyboard(request.ID)
+	if err != nil {
+		return err
+	}
+
+	if err = status.Finish(self.review(plan, nil), keyboard); err != nil {
+		return err
+	}
+
+	// The whole plan is worth reading before approving it
+	_, err = bot.SendDocument(telegram.DocumentConfig{
+		ChatID: request.ChatID,
+		Document: telegram.InputFile{
+			Name:   fmt.Sprintf("plan-%s-%d.txt", request.Pool, request.Size),
+			Reader: strings.NewReader(output),
+		},
+		Caption:          "Plan of node pool " + request.Pool,
+		ReplyToMessageID: status.MessageID(),
+	})
+	return err
+}
+
+// runApplyJob applies the saved plan, streaming its output in the message
+// of the review.
+func (self *terraformImpl) runApplyJob(ctx context.Context, bot telegram.Telegram, job jobs.Job) error {
+	request := applyJob{}
+	if err := job.Decode(&request); err != nil {
+		return err
+	}
+
+	plan := request.Plan
+	title := fmt.Sprintf("Resizing node pool %s to %d nodes, approved by %s",
+		plan.Pool, plan.Size, strings.Join(request.Approvers, ", "))
+	status := mux.NewStatus(bot, request.ChatID, request.MessageID)
+
+	if err := self.acquire(ctx, status, title, job.ID); err != nil {
+		return err
+	}
+	defer self.store.Unlock(runningKey, job.ID)
+
+	if err := self.restorePlanFile(request.ID, plan.PlanFile); err != nil {
+		return self.fail(status, title, "", err)
+	}
+
+	output, err := self.stream(ctx, status, title,
+		"apply", "-no-color", "-input=false", plan.PlanFile)
+	os.Remove(filepath.Join(self.directory, plan.PlanFile))
+
+	// An interrupted apply restores the plan file on the next worker
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	self.store.Delete(planFileKey(request.ID))
+
+	if err != nil {
+		return self.fail(status, title, output, err)
+	}
+
+	return status.Finish(render.NewHTML().
+		Bold("Done: "+title).
+		Line("").
+		Pre(strings.Join(summarize(output), "\n"), ""), nil)
+}
+
+// savePlanFile moves the plan file into the store, the worker applying it
+// may run on another host. The margin keeps it for the applies waiting for
+// their run.
+func (self *terraformImpl) savePlanFile(id, planFile string) error {
+	path := filepath.Join(self.directory, planFile)
+	defer os.Remove(path)
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	return self.store.Set(planFileKey(id), content, 2*planTTL)
+}
+
+// restorePlanFile writes the plan file saved by savePlanFile back into the
+// configuration.
+func (self *terraformImpl) restorePlanFile(id, planFile string) error {
+	content := make([]byte, 0)
+
+	found, err := self.store.Get(planFileKey(id), &content)
+	if err != nil {
+		return err
+	}
+
+	if !found {
+		return errors.New("The plan file has expired, run /nodepool again")
+	}
+
+	if err = os.MkdirAll(filepath.Join(self.directory, planDirName), 0700); err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(self.directory, planFile), content, 0600)
+}
+
+// acquire waits until no other worker runs terraform.
+func (self *terraformImpl) acquire(ctx context.Context, status mux.Status, title, owner string) error {
+	for {
+		taken, err := self.store.Lock(runningKey, owner, runTimeout+time.Minute)
+		if err != nil || taken {
+			return err
+		}
+
+		status.Update(render.NewHTML().Bold(title).Line("").
+			Line("Waiting for another terraform run to finish"), nil)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+
+		case <-time.After(runningPollInterval):
+		}
+	}
+}
+
+// cleanPlans removes the plan files left behind by the runs which didn't
+// end, e.g. when the worker crashed.
+func (self *terraformImpl) cleanPlans() error {
+	directory := filepath.Join(self.directory, planDirName)
+
+	if err := os.MkdirAll(directory, 0700); err != nil {
+		return err
+	}
+
+	entries, err := os.ReadDir(directory)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err == nil && time.Since(info.ModTime()) > 2*planTTL {
+			os.Remove(filepath.Join(directory, entry.Name()))
+		}
+	}
+
+	return nil
+}
+
+// stream runs terraform, showing the tail of its output in status.
+func (self *terraformImpl) stream(
+	ctx context.Context,
+	status mux.Status,
+	title string,
+	args ...string,
+) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, runTimeout)
+	defer cancel()
+
+	lines := &tail{}
+
+	return self.run(ctx, func(line string) {
+		lines.add(line)
+
+		// A failing edit mustn't stop terraform, the final edit reports it
+		status.Update(render.NewHTML().Bold(title).Line("").Pre(lines.String(), ""), nil)
+	}, args...)
+}
+
+func (self *terraformImpl) fail(status mux.Status, title, output string, err error) error {
+	if len(output) == 0 {
+		output = err.Error()
+	}
+
+	if finishErr := status.Finish(render.NewHTML().
+		Bold("Failed: "+title).
+		Line("").
+		Pre(lastLines(output), ""), nil); finishErr != nil {
+		return finishErr
+	}
+
+	return err
+}
@@ -0,0 +1,468 @@
+package terraform
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/audit"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/container"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/env"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/jobs"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/mux"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/rbac"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/render"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/state"
+	"github.com/hung0913208/telegram-bot-for-kubernetes/lib/telegram"
+)
+
+// ModuleName is the name the module is registered with, it routes the
+// callbacks of its buttons.
+const ModuleName = "terraform"
+
+const (
+	planTTL     = time.Hour
+	runTimeout  = 30 * time.Minute
+	defaultMax  = 100
+	planDirName = ".telegram-bot-plans"
+	// runningKey serializes the runs of every worker, terraform locks its
+	// state anyway.
+	runningKey = "terraform:running"
+)
+
+type Terraform interface {
+	container.Module
+
+	Commands() []mux.Command
+	HandleCallback(ctx *mux.CallbackContext) error
+}
+
+// pendingPlan is a saved plan waiting for its approvals, which are kept in
+// sets of the store so that concurrent approvals don't overwrite each other.
+type pendingPlan struct {
+	ChatID      int64  `json:"chat_id"`
+	Cluster     string `json:"cluster"`
+	Pool        string `json:"pool"`
+	Size        int    `json:"size"`
+	RequestedBy int64  `json:"requested_by"`
+	PlanFile    string `json:"plan_file"`
+	Summary     string `json:"summary"`
+}
+
+type terraformImpl struct {
+	store     state.Store
+	binary    string
+	directory string
+	workspace string
+	cluster   string
+	pools     map[string]string
+	maxSize   int
+	approvals int
+}
+
+// NewModule plans and applies node-pool size changes of the cluster
+// $TERRAFORM_CLUSTER with the terraform configuration of $TERRAFORM_DIR in
+// the workspace $TERRAFORM_WORKSPACE. $TERRAFORM_NODE_POOLS maps the pools
+// to the variables holding their size, like
+// `default=default_pool_size;gpu=gpu_pool_size`. An apply needs the
+// approvals of $TERRAFORM_APPROVALS admins of the cluster other than the
+// requester, default to 2. Terraform runs in the worker of `bot watch`, the
+// plan files are kept in store so that any worker applies them, which needs
+// the same $TERRAFORM_DIR and $TERRAFORM_WORKSPACE on every worker.
+func NewModule(store state.Store) Terraform {
+	return &terraformImpl{
+		store: store,
+	}
+}
+
+func (self *terraformImpl) Init() error {
+	self.directory = os.Getenv("TERRAFORM_DIR")
+	if len(self.directory) == 0 {
+		return errors.New("TERRAFORM_DIR must be set")
+	}
+
+	self.cluster = os.Getenv("TERRAFORM_CLUSTER")
+	if len(self.cluster) == 0 {
+		return errors.New("TERRAFORM_CLUSTER must name the cluster of the node pools")
+	}
+
+	self.binary = os.Getenv("TERRAFORM_BIN")
+	if len(self.binary) == 0 {
+		self.binary = "terraform"
+	}
+
+	self.workspace = os.Getenv("TERRAFORM_WORKSPACE")
+	self.pools = make(map[string]string)
+
+	for _, item := range strings.Split(os.Getenv("TERRAFORM_NODE_POOLS"), ";") {
+		if len(strings.TrimSpace(item)) == 0 {
+			continue
+		}
+
+		parts := strings.SplitN(item, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("Node pool %q must look like <pool>=<variable>", item)
+		}
+
+		self.pools[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+
+	if len(self.pools) == 0 {
+		return errors.New("TERRAFORM_NODE_POOLS must list at least a node pool")
+	}
+
+	var err error
+
+	self.maxSize, err = env.Int("TERRAFORM_MAX_POOL_SIZE", defaultMax)
+	if err != nil {
+		return err
+	}
+
+	self.approvals, err = env.Int("TERRAFORM_APPROVALS", 2)
+	if err != nil {
+		return err
+	}
+
+	jobs.Handle(planJobKind, self.runPlanJob)
+	jobs.Handle(applyJobKind, self.runApplyJob)
+	return nil
+}
+
+func (self *terraformImpl) Deinit() error {
+	return nil
+}
+
+func (self *terraformImpl) Commands() []mux.Command {
+	return []mux.Command{
+		{
+			Name:        "nodepool",
+			Description: "Plan resizing a node pool with terraform, applied after approvals",
+			Role:        rbac.RoleAdmin,
+			Handler:     self.planNodePool,
+		},
+	}
+}
+
+func (self *terraformImpl) HandleCallback(ctx *mux.CallbackContext) error {
+	switch ctx.Callback.Action {
+	case "approve", "reject":
+		return self.answerPlan(ctx)
+	}
+
+	return ctx.Alert("This button isn't supported anymore")
+}
+
+// planNodePool hands `terraform plan` changing the size of a pool over to
+// the worker, the plan is saved so that exactly the reviewed changes are
+// applied.
+func (self *terraformImpl) planNodePool(ctx *mux.Context) error {
+	if len(ctx.Args) != 2 {
+		return ctx.Reply(fmt.Sprintf("Usage: /nodepool <pool> <size>, pools: %s",
+			strings.Join(self.poolNames(), ", ")))
+	}
+
+	pool := ctx.Args[0]
+
+	if _, ok := self.pools[pool]; !ok {
+		return ctx.Reply(fmt.Sprintf("Node pool %s isn't managed, pools: %s",
+			pool, strings.Join(self.poolNames(), ", ")))
+	}
+
+	size, err := strconv.Atoi(ctx.Args[1])
+	if err != nil || size < 0 || size > self.maxSize {
+		return ctx.Reply(fmt.Sprintf("The size must be a number between 0 and %d", self.maxSize))
+	}
+
+	ctx.Audit.Target(self.cluster, self.workspace, "nodepool/"+pool)
+
+	if ctx.Message.From == nil {
+		return ctx.Reply("Commands sent on behalf of a chat can't be authorized")
+	}
+
+	allowed, err := rbac.Allowed(ctx.Message.From.ID, self.cluster, rbac.RoleAdmin)
+	if err != nil {
+		return err
+	}
+
+	if !allowed {
+		ctx.Audit.Result = audit.ResultDenied
+		return ctx.Reply("You need the admin role on cluster " + self.cluster)
+	}
+
+	if !self.store.Shared() {
+		return ctx.Reply("Terraform runs in the background, " + jobs.ErrNotShared.Error())
+	}
+
+	id, err := newPlanID()
+	if err != nil {
+		return err
+	}
+
+	title := fmt.Sprintf("Planning node pool %s with %d nodes", pool, size)
+
+	status, err := mux.SendStatus(ctx.Telegram, ctx.Message.Chat.ID, ctx.Message.MessageID,
+		render.NewHTML().Bold(title))
+	if err != nil {
+		return err
+	}
+
+	_, err = jobs.Enqueue(self.store, planJobKind, planJob{
+		ID:          id,
+		ChatID:      status.ChatID(),
+		MessageID:   status.MessageID(),
+		Pool:        pool,
+		Size:        size,
+		RequestedBy: ctx.Message.From.ID,
+	})
+	if err != nil {
+		return err
+	}
+
+	ctx.Audit.Confirm(audit.ConfirmationPending)
+	return nil
+}
+
+// answerPlan records the approval of an admin, the plan is handed over to
+// the worker once it has enough approvals from admins other than its
+// requester, or it's dropped when an admin rejects it.
+func (self *terraformImpl) answerPlan(ctx *mux.CallbackContext) error {
+	id := ctx.Callback.Args["id"]
+	plan := &pendingPlan{}
+
+	found, err := self.store.Get(planKey(id), plan)
+	if err != nil {
+		return err
+	}
+
+	if !found || plan.ChatID != ctx.ChatID() {
+		return ctx.Alert("This plan doesn't exist or has expired")
+	}
+
+	ctx.Audit.Target(plan.Cluster, self.workspace, "nodepool/"+plan.Pool)
+
+	allowed, err := rbac.Allowed(ctx.Query.From.ID, plan.Cluster, rbac.RoleAdmin)
+	if err != nil {
+		return err
+	}
+
+	if !allowed {
+		ctx.Audit.Result = audit.ResultDenied
+		return ctx.Alert("Only admins of cluster " + plan.Cluster + " can approve or reject a plan")
+	}
+
+	name := ctx.Query.From.FirstName
+	if len(ctx.Query.From.UserName) > 0 {
+		name = "@" + ctx.Query.From.UserName
+	}
+
+	if ctx.Callback.Action == "reject" {
+		if !self.decide(ctx, id) {
+			return ctx.Alert("This plan is already being applied")
+		}
+
+		ctx.Audit.Confirm(audit.ConfirmationDiscarded)
+
+		if err = self.forget(id); err != nil {
+			return err
+		}
+
+		self.store.Delete(planFileKey(id))
+
+		return ctx.Edit(render.NewHTML().
+			Text(fmt.Sprintf("Resizing node pool %s to %d nodes is rejected by %s",
+				plan.Pool, plan.Size, name)), nil)
+	}
+
+	if ctx.Query.From.ID == plan.RequestedBy {
+		return ctx.Alert("You requested this plan, other admins must approve it")
+	}
+
+	added, err := self.store.Add(approvalsKey(id), strconv.FormatInt(ctx.Query.From.ID, 10))
+	if err != nil {
+		return err
+	}
+
+	if !added {
+		return ctx.Alert("You have already approved this plan")
+	}
+
+	if _, err = self.store.Add(approversKey(id), name); err != nil {
+		return err
+	}
+
+	approvals, err := self.store.Members(approvalsKey(id))
+	if err != nil {
+		return err
+	}
+
+	approvers, err := self.approvers(id)
+	if err != nil {
+		return err
+	}
+
+	if len(approvals) < self.approvals {
+		ctx.Audit.Confirm(audit.ConfirmationPending)
+
+		keyboard, err := self.keyboard(id)
+		if err != nil {
+			return err
+		}
+
+		if err = ctx.Edit(self.review(*plan, approvers), keyboard); err != nil {
+			return err
+		}
+
+		return ctx.Toast(fmt.Sprintf("Approved, %d more approval(s) needed",
+			self.approvals-len(approvals)))
+	}
+
+	// Two last approvals may arrive together, only one of them applies
+	if !self.decide(ctx, id) {
+		return ctx.Toast("Approved, the plan is being applied")
+	}
+
+	ctx.Audit.Confirm(audit.ConfirmationConfirmed)
+
+	_, err = jobs.Enqueue(self.store, applyJobKind, applyJob{
+		ID:        id,
+		ChatID:    ctx.ChatID(),
+		MessageID: ctx.Query.Message.MessageID,
+		Plan:      *plan,
+		Approvers: approvers,
+	})
+	if err != nil {
+		self.store.Unlock(decisionKey(id), ctx.Query.ID)
+		return err
+	}
+
+	if err = self.forget(id); err != nil {
+		return err
+	}
+
+	title := fmt.Sprintf("Resizing node pool %s to %d nodes, approved by %s",
+		plan.Pool, plan.Size, strings.Join(approvers, ", "))
+
+	if err = ctx.Edit(render.NewHTML().Bold(title), nil); err != nil {
+		return err
+	}
+
+	return ctx.Toast("Applying")
+}
+
+// decide takes the decision on a plan for the callback, only the first
+// callback applying or rejecting a plan gets it.
+func (self *terraformImpl) decide(ctx *mux.CallbackContext, id string) bool {
+	taken, err := self.store.Lock(decisionKey(id), ctx.Query.ID, planTTL)
+	return err == nil && taken
+}
+
+// forget drops a plan and its approvals from the store.
+func (self *terraformImpl) forget(id string) error {
+	if err := self.store.Delete(planKey(id)); err != nil {
+		return err
+	}
+
+	self.store.Delete(approvalsKey(id))
+	self.store.Delete(approversKey(id))
+	return nil
+}
+
+func (self *terraformImpl) approvers(id string) ([]string, error) {
+	approvers, err := self.store.Members(approversKey(id))
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(approvers)
+	return approvers, nil
+}
+
+func (self *terraformImpl) review(plan pendingPlan, approvers []string) render.Builder {
+	builder := render.NewHTML().
+		Bold(fmt.Sprintf("Resize node pool %s of cluster %s to %d nodes?",
+			plan.Pool, plan.Cluster, plan.Size)).
+		Line("").
+		Pre(plan.Summary, "").
+		Line(fmt.Sprintf("Approvals: %d/%d", len(approvers), self.approvals))
+
+	if len(approvers) > 0 {
+		builder.Line("Approved by " + strings.Join(approvers, ", "))
+	}
+
+	return builder
+}
+
+func (self *terraformImpl) keyboard(id string) (*telegram.InlineKeyboardMarkup, error) {
+	codec, err := mux.DefaultCodec()
+	if err != nil {
+		return nil, err
+	}
+
+	return mux.NewKeyboard(codec, planTTL).
+		Button("Approve", mux.Callback{
+			Module: ModuleName,
+			Action: "approve",
+			Args:   map[string]string{"id": id},
+		}).
+		Button("Reject", mux.Callback{
+			Module: ModuleName,
+			Action: "reject",
+			Args:   map[string]string{"id": id},
+		}).
+		Markup()
+}
+
+func (self *terraformImpl) poolNames() []string {
+	names := make([]string, 0, len(self.pools))
+	for name := range self.pools {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+func lastLines(output string) string {
+	lines := &tail{}
+	for _, line := range strings.Split(output, "\n") {
+		lines.add(line)
+	}
+
+	return lines.String()
+}
+
+func planKey(id string) string {
+	return "terraform:plan:" + id
+}
+
+// planFileKey keeps the content of the plan file of a plan.
+func planFileKey(id string) string {
+	return "terraform:planfile:" + id
+}
+
+func approvalsKey(id string) string {
+	return "terraform:plan:" + id + ":approvals"
+}
+
+func approversKey(id string) string {
+	return "terraform:plan:" + id + ":approvers"
+}
+
+func decisionKey(id string) string {
+	return "terraform:plan:" + id + ":decision"
+}
+
+func newPlanID() (string, error) {
+	buffer := make([]byte, 6)
+	if _, err := rand.Read(buffer); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(buffer), nil
+}
@@ -0,0 +1,120 @@
+package terraform
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+// tailSize is how many lines of output a status message shows.
+const tailSize = 15
+
+var (
+	// changePattern matches the header of a resource change in a plan, e.g.
+	// `  # google_container_node_pool.default will be updated in-place`.
+	changePattern = regexp.MustCompile(`^\s*# (\S+) (will be .+|must be .+)$`)
+	// planPattern matches `Plan: 0 to add, 1 to change, 0 to destroy.`
+	planPattern = regexp.MustCompile(`^(Plan|Apply complete!).*`)
+)
+
+// run executes terraform with args in the working directory, onLine is
+// called for every line of its output. It returns the whole output.
+func (self *terraformImpl) run(
+	ctx context.Context,
+	onLine func(line string),
+	args ...string,
+) (string, error) {
+	command := exec.CommandContext(ctx, self.binary, args...)
+	command.Dir = self.directory
+	command.Env = append(os.Environ(), "TF_IN_AUTOMATION=true", "TF_INPUT=0")
+
+	if len(self.workspace) > 0 {
+		command.Env = append(command.Env, "TF_WORKSPACE="+self.workspace)
+	}
+
+	reader, writer := io.Pipe()
+	command.Stdout = writer
+	command.Stderr = writer
+
+	if err := command.Start(); err != nil {
+		return "", err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		err := command.Wait()
+		writer.Close()
+		done <- err
+	}()
+
+	var output strings.Builder
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		output.WriteString(line)
+		output.WriteString("\n")
+
+		if onLine != nil {
+			onLine(line)
+		}
+	}
+
+	// Drain the output if the scanner stopped early, so that Wait returns
+	io.Copy(io.Discard, reader)
+
+	if err := <-done; err != nil {
+		return output.String(), fmt.Errorf("terraform %s fails: %v", args[0], err)
+	}
+
+	return output.String(), nil
+}
+
+// summarize keeps the changes and the totals of a plan or an apply.
+func summarize(output string) []string {
+	summary := make([]string, 0)
+
+	for _, line := range strings.Split(output, "\n") {
+		if match := changePattern.FindStringSubmatch(line); match != nil {
+			summary = append(summary, fmt.Sprintf("%s %s", match[1], match[2]))
+		} else if planPattern.MatchString(line) || strings.HasPrefix(line, "No changes.") {
+			summary = append(summary, strings.TrimSpace(line))
+		}
+	}
+
+	return summary
+}
+
+// tail collects the last lines of the output for a status message.
+type tail struct {
+	lines []string
+}
+
+func (self *tail) add(line string) {
+	line = strings.TrimRight(line, " ")
+	if len(line) == 0 {
+		return
+	}
+
+	// Keep the status message far below the limit of a message
+	if runes := []rune(line); len(runes) > 160 {
+		line = string(runes[:159]) + "…"
+	}
+
+	self.lines = append(self.lines, line)
+	if len(self.lines) > tailSize {
+		self.lines = self.lines[len(self.lines)-tailSize:]
+	}
+}
+
+func (self *tail) String() string {
+	return strings.Join(self.lines, "\n")
+}